@@ -1,12 +1,15 @@
 package randomx
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/argon2"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/blake2"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/keys"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
-	"runtime"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -18,13 +21,26 @@ func (m *MemoryBlock) GetLine(addr uint64) *RegisterLine {
 }
 
 type Cache struct {
-	blocks *[RANDOMX_ARGON_MEMORY]MemoryBlock
+	blocks []MemoryBlock
 
-	programs [RANDOMX_PROGRAM_COUNT]SuperScalarProgram
+	programs []SuperScalarProgram
 
-	jitPrograms [RANDOMX_PROGRAM_COUNT]SuperScalarProgramFunc
+	// jitDatasetInit Compiled routine generating dataset items from all programs, nil when not compiled
+	jitDatasetInit SuperScalarProgramFunc
 
 	flags Flags
+
+	// argonImpl Argon2 block implementation selected by RANDOMX_FLAG_ARGON2 flags
+	argonImpl argon2.Impl
+
+	config *params
+
+	// key Key value the Cache was last initialized with, nil when not initialized
+	key []byte
+	// generation Incremented every time the Cache contents change
+	generation atomic.Uint64
+
+	closed atomic.Bool
 }
 
 // NewCache Creates a randomx_cache structure and allocates memory for RandomX Cache.
@@ -38,6 +54,7 @@ type Cache struct {
 // *                                   makes subsequent cache initialization faster
 // *        RANDOMX_FLAG_ARGON2_AVX2 - optimized Argon2 for CPUs with the AVX2 instruction set
 // *                                   makes subsequent cache initialization faster
+// *        If both are set, as returned by GetFlags, the AVX2 implementation is used.
 // *
 // * @return Pointer to an allocated randomx_cache structure.
 // *         Returns NULL if:
@@ -46,19 +63,45 @@ type Cache struct {
 // *         (3) an invalid or unsupported RANDOMX_FLAG_ARGON2 value is set
 // */
 func NewCache(flags Flags) (c *Cache, err error) {
+	return newCache(flags, defaultParams)
+}
 
-	var blocks *[RANDOMX_ARGON_MEMORY]MemoryBlock
+// NewCacheWithConfig Same as NewCache, using the RandomX parameters in config instead of ConfigMonero
+func NewCacheWithConfig(flags Flags, config Config) (c *Cache, err error) {
+	p, err := config.params()
+	if err != nil {
+		return nil, err
+	}
+	return newCache(flags, p)
+}
+
+func newCache(flags Flags, config *params) (c *Cache, err error) {
+
+	argonImpl := argon2.ImplGeneric
+	if flags.Has(RANDOMX_FLAG_ARGON2_AVX2) {
+		if argon2.ImplAVX2 == nil {
+			return nil, errors.New("argon2 AVX2 not supported")
+		}
+		argonImpl = argon2.ImplAVX2
+	} else if flags.Has(RANDOMX_FLAG_ARGON2_SSSE3) {
+		if argon2.ImplSSSE3 == nil {
+			return nil, errors.New("argon2 SSSE3 not supported")
+		}
+		argonImpl = argon2.ImplSSSE3
+	}
+
+	var blocks []MemoryBlock
 
 	if flags.Has(RANDOMX_FLAG_LARGE_PAGES) {
 		if largePageAllocator == nil {
 			return nil, errors.New("huge pages not supported")
 		}
-		blocks, err = memory.Allocate[[RANDOMX_ARGON_MEMORY]MemoryBlock](largePageAllocator)
+		blocks, err = memory.AllocateSlice[MemoryBlock](largePageAllocator, config.ArgonMemory)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		blocks, err = memory.Allocate[[RANDOMX_ARGON_MEMORY]MemoryBlock](cacheLineAlignedAllocator)
+		blocks, err = memory.AllocateSlice[MemoryBlock](cacheLineAlignedAllocator, config.ArgonMemory)
 
 		if err != nil {
 			return nil, err
@@ -66,64 +109,114 @@ func NewCache(flags Flags) (c *Cache, err error) {
 	}
 
 	return &Cache{
-		flags:  flags,
-		blocks: blocks,
+		flags:     flags,
+		argonImpl: argonImpl,
+		blocks:    blocks,
+		programs:  make([]SuperScalarProgram, config.CacheAccesses),
+		config:    config,
 	}, nil
 }
 
+// Config Returns the RandomX parameters this Cache was created with
+func (c *Cache) Config() Config {
+	return c.config.Config
+}
+
 func (c *Cache) hasInitializedJIT() bool {
-	return c.flags.HasJIT() && c.jitPrograms[0] != nil
+	return c.flags.HasJIT() && c.jitDatasetInit != nil
 }
 
 // Close Releases all memory occupied by the Cache structure.
+// Returns ErrClosed if called more than once.
 func (c *Cache) Close() error {
-	for _, p := range c.jitPrograms {
-		if p != nil {
-			err := p.Close()
-			if err != nil {
-				return err
-			}
+	if c.closed.Swap(true) {
+		return ErrClosed
+	}
+
+	if c.jitDatasetInit != nil {
+		err := c.jitDatasetInit.Close()
+		if err != nil {
+			return err
 		}
 	}
 
+	blocks := c.blocks
+	c.blocks = nil
+	c.key = nil
+
 	if c.flags.Has(RANDOMX_FLAG_LARGE_PAGES) {
-		return memory.Free(largePageAllocator, c.blocks)
+		return memory.FreeSlice(largePageAllocator, blocks)
 	} else {
-		return memory.Free(cacheLineAlignedAllocator, c.blocks)
+		return memory.FreeSlice(cacheLineAlignedAllocator, blocks)
 	}
 }
 
 // Init Initializes the cache memory and SuperscalarHash using the provided key value.
 // Does nothing if called again with the same key value.
-func (c *Cache) Init(key []byte) {
-	//TODO: cache key and do not regenerate
+// VMs using this Cache must be updated via VM.SetCache after the key changes.
+// Returns ErrClosed if the Cache was closed.
+func (c *Cache) Init(key []byte) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	if c.key != nil && bytes.Equal(c.key, key) {
+		return nil
+	}
 
-	argonBlocks := unsafe.Slice((*argon2.Block)(unsafe.Pointer(c.blocks)), len(c.blocks))
+	argonBlocks := unsafe.Slice((*argon2.Block)(unsafe.Pointer(unsafe.SliceData(c.blocks))), len(c.blocks))
 
-	argon2.BuildBlocks(argonBlocks, key, []byte(RANDOMX_ARGON_SALT), RANDOMX_ARGON_ITERATIONS, RANDOMX_ARGON_MEMORY, RANDOMX_ARGON_LANES)
+	argon2.BuildBlocks(argonBlocks, key, []byte(c.config.ArgonSalt), c.config.ArgonIterations, c.config.ArgonMemory, uint8(c.config.ArgonLanes), c.argonImpl)
 
 	const nonce uint32 = 0
 
 	gen := blake2.New(key, nonce)
 	for i := range c.programs {
 		// build a superscalar program
-		prog := BuildSuperScalarProgram(gen)
-
-		if c.flags.HasJIT() {
-			c.jitPrograms[i] = generateSuperscalarCode(prog)
-			// fallback if can't compile program
-			if c.jitPrograms[i] == nil {
-				c.programs[i] = prog
-			} else if err := memory.PageReadExecute(c.jitPrograms[i]); err != nil {
-				c.programs[i] = prog
-			} else {
-				c.programs[i] = SuperScalarProgram{prog[0]}
-			}
-		} else {
-			c.programs[i] = prog
-		}
+		c.programs[i] = buildSuperScalarProgram(gen, int(c.config.SuperscalarLatency))
 	}
 
+	c.compilePrograms()
+
+	c.key = append([]byte{}, key...)
+	c.generation.Add(1)
+
+	return nil
+}
+
+// compilePrograms Compiles the superscalar programs into a single dataset item routine if JIT is enabled,
+// releasing the previously compiled one. Falls back to the interpreter if it cannot be compiled.
+func (c *Cache) compilePrograms() {
+	c.closeJIT()
+
+	if !c.flags.HasJIT() {
+		return
+	}
+
+	c.jitDatasetInit = generateDatasetInitCode(c.programs, c.config.cacheMask)
+	if c.jitDatasetInit == nil || memory.PageReadExecute(c.jitDatasetInit) != nil {
+		c.closeJIT()
+	}
+}
+
+func (c *Cache) closeJIT() {
+	if c.jitDatasetInit != nil {
+		_ = c.jitDatasetInit.Close()
+		c.jitDatasetInit = nil
+	}
+}
+
+// Key Returns a copy of the key value the Cache was initialized with, or nil if not initialized.
+func (c *Cache) Key() []byte {
+	if c.key == nil {
+		return nil
+	}
+	return append([]byte{}, c.key...)
+}
+
+// Generation Returns a counter that is incremented every time the Cache is initialized with a new key.
+// Zero means the Cache has never been initialized.
+func (c *Cache) Generation() uint64 {
+	return c.generation.Load()
 }
 
 const Mask = CacheSize/CacheLineSize - 1
@@ -131,17 +224,31 @@ const Mask = CacheSize/CacheLineSize - 1
 // getMixBlock fetch a 64 byte block in uint64 form
 func (c *Cache) getMixBlock(addr uint64) *RegisterLine {
 
-	addr = (addr & Mask) * CacheLineSize
+	addr = (addr & c.config.cacheMask) * CacheLineSize
 
 	block := addr / 1024
 	return c.blocks[block].GetLine(addr % 1024)
 }
 
+// GetMemory Returns the cache memory, or nil when the Cache was not created with the default ArgonMemory
 func (c *Cache) GetMemory() *[RANDOMX_ARGON_MEMORY]MemoryBlock {
+	if len(c.blocks) != RANDOMX_ARGON_MEMORY {
+		return nil
+	}
+	return (*[RANDOMX_ARGON_MEMORY]MemoryBlock)(c.blocks)
+}
+
+// Memory Returns the cache memory, sized by the ArgonMemory of its Config
+func (c *Cache) Memory() []MemoryBlock {
 	return c.blocks
 }
 
 func (c *Cache) initDataset(rl *RegisterLine, itemNumber uint64) {
+	if c.hasInitializedJIT() {
+		c.jitDatasetInit.initDataset(c.blocks, unsafe.Slice(rl, 1), itemNumber)
+		return
+	}
+
 	registerValue := itemNumber
 
 	rl[0] = (itemNumber + 1) * keys.SuperScalar_Constants[0]
@@ -153,45 +260,124 @@ func (c *Cache) initDataset(rl *RegisterLine, itemNumber uint64) {
 	rl[6] = rl[0] ^ keys.SuperScalar_Constants[6]
 	rl[7] = rl[0] ^ keys.SuperScalar_Constants[7]
 
-	if c.hasInitializedJIT() {
-		if c.flags.HasJIT() {
-			// Lock due to external JIT madness
-			runtime.LockOSThread()
-			defer runtime.UnlockOSThread()
-		}
+	for i := range c.programs {
+		mix := c.getMixBlock(registerValue)
 
-		for i := 0; i < RANDOMX_CACHE_ACCESSES; i++ {
-			mix := c.getMixBlock(registerValue)
+		program := c.programs[i]
 
-			c.jitPrograms[i].Execute(uintptr(unsafe.Pointer(rl)))
+		executeSuperscalar(program.Program(), rl)
 
-			for q := range rl {
-				rl[q] ^= mix[q]
-			}
+		for q := range rl {
+			rl[q] ^= mix[q]
+		}
 
-			registerValue = rl[c.programs[i].AddressRegister()]
+		registerValue = rl[program.AddressRegister()]
 
-		}
-	} else {
-		for i := 0; i < RANDOMX_CACHE_ACCESSES; i++ {
-			mix := c.getMixBlock(registerValue)
+	}
+}
 
-			program := c.programs[i]
+// datasetItemWorker Computes single Dataset items on a helper goroutine owned by a VM.
+// The goroutine is started on the first request and blocks while idle, until close.
+// Only one item can be pending at a time: request, then wait before the next request.
+type datasetItemWorker struct {
+	request chan datasetItemRequest
+	done    chan struct{}
 
-			executeSuperscalar(program.Program(), rl)
+	item RegisterLine
+}
 
-			for q := range rl {
-				rl[q] ^= mix[q]
-			}
+type datasetItemRequest struct {
+	cache      *Cache
+	itemNumber uint64
+}
 
-			registerValue = rl[program.AddressRegister()]
+func (w *datasetItemWorker) run(request <-chan datasetItemRequest, done chan<- struct{}) {
+	for r := range request {
+		r.cache.initDataset(&w.item, r.itemNumber)
+		done <- struct{}{}
+	}
+}
 
-		}
+// requestItem Starts computing itemNumber from c
+func (w *datasetItemWorker) requestItem(c *Cache, itemNumber uint64) {
+	if w.request == nil {
+		w.request = make(chan datasetItemRequest, 1)
+		w.done = make(chan struct{}, 1)
+		go w.run(w.request, w.done)
+	}
+	w.request <- datasetItemRequest{cache: c, itemNumber: itemNumber}
+}
+
+// wait Returns the requested item, valid until the next request
+func (w *datasetItemWorker) wait() *RegisterLine {
+	<-w.done
+	return &w.item
+}
+
+// close Stops the helper goroutine, if started. No request must be pending.
+func (w *datasetItemWorker) close() {
+	if w.request != nil {
+		close(w.request)
+		w.request, w.done = nil, nil
 	}
 }
 
 func (c *Cache) datasetInit(dataset []RegisterLine, startItem, endItem uint64) {
+	if c.hasInitializedJIT() {
+		c.jitDatasetInit.initDataset(c.blocks, dataset[:endItem-startItem], startItem)
+		return
+	}
 	for itemNumber := startItem; itemNumber < endItem; itemNumber, dataset = itemNumber+1, dataset[1:] {
 		c.initDataset(&dataset[0], itemNumber)
 	}
 }
+
+// datasetInitChunkItems Number of items initialized between cancellation checks and progress reports
+const datasetInitChunkItems = 1024
+
+// datasetInitContext Initializes dataset items starting at startItem using n goroutines.
+// progress, if not nil, is called serialized with the number of items initialized so far.
+// Returns ctx.Err() if ctx is cancelled before all items are initialized.
+func (c *Cache) datasetInitContext(ctx context.Context, dataset []RegisterLine, startItem uint64, n int, progress func(itemsDone uint64)) error {
+	n = max(1, n)
+	itemCount := uint64(len(dataset))
+
+	var nextItem, itemsDone atomic.Uint64
+
+	var progressLock sync.Mutex
+
+	worker := func() {
+		for ctx.Err() == nil {
+			a := nextItem.Add(datasetInitChunkItems) - datasetInitChunkItems
+			if a >= itemCount {
+				return
+			}
+			b := min(a+datasetInitChunkItems, itemCount)
+
+			c.datasetInit(dataset[a:b], startItem+a, startItem+b)
+
+			if progress != nil {
+				progressLock.Lock()
+				progress(itemsDone.Add(b - a))
+				progressLock.Unlock()
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
+	}
+	worker()
+	wg.Wait()
+
+	if nextItem.Load() < itemCount {
+		// not all items were claimed by workers
+		return ctx.Err()
+	}
+	return nil
+}
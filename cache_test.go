@@ -1,19 +1,15 @@
 package randomx
 
-import "testing"
+import (
+	"encoding/hex"
+	"errors"
+	"runtime"
+	"testing"
+)
 
 func Test_Cache_Init(t *testing.T) {
 	t.Parallel()
 
-	cache, err := NewCache(GetFlags())
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer cache.Close()
-	cache.Init(Tests[1].key)
-
-	memory := cache.GetMemory()
-
 	var tests = []struct {
 		index int
 		value uint64
@@ -23,13 +19,43 @@ func Test_Cache_Init(t *testing.T) {
 		{33554431, 0x1f47f056d05cd99b},
 	}
 
-	for i, tt := range tests {
-		if memory[tt.index/128][tt.index%128] != tt.value {
-			t.Errorf("i=%d, index=%d", i, tt.index)
-			t.Errorf("expected=%016x, actual=%016x", tt.value, memory[tt.index/128][tt.index%128])
-		}
+	var impls = []struct {
+		name      string
+		flag      Flags
+		supported bool
+	}{
+		{"generic", 0, true},
+		{"ssse3", RANDOMX_FLAG_ARGON2_SSSE3, GetFlags().Has(RANDOMX_FLAG_ARGON2_SSSE3)},
+		{"avx2", RANDOMX_FLAG_ARGON2_AVX2, GetFlags().Has(RANDOMX_FLAG_ARGON2_AVX2)},
 	}
 
+	// not parallel, each Cache holds 256 MiB
+	for _, impl := range impls {
+		impl := impl
+		t.Run(impl.name, func(t *testing.T) {
+			if !impl.supported {
+				t.Skip("not supported on this CPU")
+			}
+
+			cache, err := NewCache((GetFlags() &^ RANDOMX_FLAG_ARGON2) | impl.flag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cache.Close()
+			if err := cache.Init(Tests[1].key); err != nil {
+				t.Fatal(err)
+			}
+
+			memory := cache.GetMemory()
+
+			for i, tt := range tests {
+				if memory[tt.index/128][tt.index%128] != tt.value {
+					t.Errorf("i=%d, index=%d", i, tt.index)
+					t.Errorf("expected=%016x, actual=%016x", tt.value, memory[tt.index/128][tt.index%128])
+				}
+			}
+		})
+	}
 }
 
 func Test_Cache_InitDataset(t *testing.T) {
@@ -56,7 +82,9 @@ func Test_Cache_InitDataset(t *testing.T) {
 			t.Fatal(err)
 		}
 		defer cache.Close()
-		cache.Init(Tests[1].key)
+		if err := cache.Init(Tests[1].key); err != nil {
+			t.Fatal(err)
+		}
 
 		var datasetItem RegisterLine
 
@@ -83,7 +111,9 @@ func Test_Cache_InitDataset(t *testing.T) {
 			t.Fatal(err)
 		}
 		defer cache.Close()
-		cache.Init(Tests[1].key)
+		if err := cache.Init(Tests[1].key); err != nil {
+			t.Fatal(err)
+		}
 		if !cache.hasInitializedJIT() {
 			t.Skip("not supported on this platform")
 		}
@@ -99,3 +129,158 @@ func Test_Cache_InitDataset(t *testing.T) {
 		}
 	})
 }
+
+func Test_Cache_DatasetInit(t *testing.T) {
+	t.Parallel()
+
+	flags := GetFlags() | RANDOMX_FLAG_JIT
+	if !flags.HasJIT() {
+		t.Skip("not supported on this platform")
+	}
+
+	cache, err := NewCache(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.hasInitializedJIT() {
+		t.Skip("not supported on this platform")
+	}
+
+	const startItem, itemCount = 1568000, 1000
+
+	items := make([]RegisterLine, itemCount)
+	cache.datasetInit(items, startItem, startItem+itemCount)
+
+	// compare full items against the interpreter
+	cache.flags &^= RANDOMX_FLAG_JIT
+	defer func() {
+		cache.flags |= RANDOMX_FLAG_JIT
+	}()
+
+	var expected RegisterLine
+	for i := range items {
+		cache.initDataset(&expected, startItem+uint64(i))
+		if items[i] != expected {
+			t.Fatalf("item %d: expected=%016x, actual=%016x", startItem+i, expected, items[i])
+		}
+	}
+}
+
+func Test_Cache_Key(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	if cache.Key() != nil || cache.Generation() != 0 {
+		t.Fatal("expected uninitialized cache")
+	}
+
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+	if string(cache.Key()) != string(Tests[1].key) {
+		t.Fatalf("expected key=%x, actual=%x", Tests[1].key, cache.Key())
+	}
+	generation := cache.Generation()
+	if generation == 0 {
+		t.Fatal("expected non-zero generation")
+	}
+
+	memory := cache.GetMemory()
+	memory[0][0] ^= 1
+	// same key must not regenerate
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Generation() != generation {
+		t.Fatal("cache was regenerated with the same key")
+	}
+	if memory[0][0] != 0x191e0e1d23c02186^1 {
+		t.Fatal("cache memory was regenerated with the same key")
+	}
+
+	if err := cache.Init(Tests[4].key); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Generation() == generation {
+		t.Fatal("expected generation to change with a new key")
+	}
+	if string(cache.Key()) != string(Tests[4].key) {
+		t.Fatalf("expected key=%x, actual=%x", Tests[4].key, cache.Key())
+	}
+}
+
+func Test_Cache_Rekey(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err := cache.Init(Tests[0].key); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+
+	var outputHash [RANDOMX_HASH_SIZE]byte
+
+	if err := vm.CalculateHash(Tests[1].input, &outputHash); !errors.Is(err, ErrCacheChanged) {
+		t.Errorf("expected ErrCacheChanged when cache was re-initialized without SetCache, got %v", err)
+	}
+
+	if err := vm.SetCache(cache); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CalculateHash(Tests[1].input, &outputHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if outputHex := hex.EncodeToString(outputHash[:]); outputHex != Tests[1].expected {
+		t.Errorf("expected=%s, actual=%s", Tests[1].expected, outputHex)
+	}
+}
+
+// Benchmark_Cache_ItemWorker Round trip of a single Dataset item through the RANDOMX_FLAG_LIGHT_CONCURRENT helper
+func Benchmark_Cache_ItemWorker(b *testing.B) {
+	b.ReportAllocs()
+
+	var w datasetItemWorker
+	defer w.close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.requestItem(BenchmarkCache, uint64(i))
+		runtime.KeepAlive(w.wait())
+	}
+}
+
+// Benchmark_Cache_Item Single Dataset item computed inline, as in light mode without the helper
+func Benchmark_Cache_Item(b *testing.B) {
+	b.ReportAllocs()
+
+	var item RegisterLine
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BenchmarkCache.initDataset(&item, uint64(i))
+		runtime.KeepAlive(item)
+	}
+}
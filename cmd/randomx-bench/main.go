@@ -0,0 +1,298 @@
+// Command randomx-bench benchmarks RandomX hashing on a fixed, deterministic workload.
+//
+// A fixed blob is hashed under a fixed key for nonces 0 to -n - 1, split across -threads goroutines.
+// The XOR of all hashes does not depend on mode, threads or backend, and is compared against known results,
+// so that a wrong implementation is reported as well as a slow one.
+//
+//	randomx-bench -n 1M -full -threads 8
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// benchmarkKey Key of the benchmark Cache
+var benchmarkKey = []byte("go-randomx benchmark key")
+
+// benchmarkBlob Monero style hashing blob, nonces are written at nonceOffset
+var benchmarkBlob, _ = hex.DecodeString("101080e2cfaa06a0a1a2a3a4a5a6a7a8a9aaabacadaeafb0b1b2b3b4b5b6b7b8b9babbbcbdbebf000000002b3da55faf0ff5df5f02746c5e8009b6f019b336bed9414f3dca21b479a4e4fd05")
+
+const nonceOffset = 39
+
+// maxChunkSize Maximum number of nonces claimed by a thread at once
+const maxChunkSize = 64
+
+// knownResults XOR of all hashes of the first n nonces, for ConfigMonero
+var knownResults = map[uint64]string{
+	16:      "3c21a0f631f83da88c1b41c9e9a472c0be4800a9803c0ca419965f444c440d84",
+	64:      "ebeaf6be8b2fb7729b1426405eb877118d4cca2232a8b0b2ab7cf9e14d8bc898",
+	256:     "5747d7c508ddaaa095ba64baa7119580d7594135cbc063a4185ddbc326a8e7b2",
+	1000:    "60fad8e961399e0c486b378764276206f696a5d104c4e193878ef2c3224586ac",
+	10000:   "eefe58d576cb75afa60b188b636d42852678bd2e7083d63d10977eee88f9b869",
+	100000:  "c1c8427653115b898efd60b05057a4b008dcdda7f58619d2d2597ece004a4c98",
+	1000000: "65f0876f898ace3466a88ff13fffd551eccbd9149ed4744ddceffac67da6dc07",
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "randomx-bench: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// errMismatch Benchmark result differs from the known result
+var errMismatch = errors.New("result mismatch")
+
+// parseCount Parses a hash count with an optional K or M suffix
+func parseCount(s string) (uint64, error) {
+	multiplier := uint64(1)
+	switch {
+	case strings.HasSuffix(s, "K"), strings.HasSuffix(s, "k"):
+		multiplier = 1000
+		s = s[:len(s)-1]
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		multiplier = 1000 * 1000
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hash count %q", s)
+	}
+	n *= multiplier
+	if n == 0 || n > math.MaxUint32+1 {
+		return 0, fmt.Errorf("hash count %d out of range", n)
+	}
+	return n, nil
+}
+
+// formatCount Formats a hash count as accepted by parseCount
+func formatCount(n uint64) string {
+	switch {
+	case n%(1000*1000) == 0:
+		return strconv.FormatUint(n/(1000*1000), 10) + "M"
+	case n%1000 == 0:
+		return strconv.FormatUint(n/1000, 10) + "K"
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// threadResult Work done by a single benchmark thread
+type threadResult struct {
+	hashes   uint64
+	duration time.Duration
+	xor      [randomx.RANDOMX_HASH_SIZE]byte
+	err      error
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	defaults := randomx.GetFlags()
+
+	fs := flag.NewFlagSet("randomx-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		count       = fs.String("n", "1K", "number of hashes, with optional K or M suffix")
+		threads     = fs.Int("threads", runtime.NumCPU(), "hashing threads")
+		initThreads = fs.Int("init-threads", runtime.NumCPU(), "threads for dataset initialization in full mode")
+		full        = fs.Bool("full", false, "full (dataset) mode instead of light mode")
+		jit         = fs.Bool("jit", defaults.Has(randomx.RANDOMX_FLAG_JIT), "use the JIT compiler")
+		hardAES     = fs.Bool("hard-aes", defaults.Has(randomx.RANDOMX_FLAG_HARD_AES), "use hardware AES")
+		largePages  = fs.Bool("large-pages", false, "allocate memory in large pages")
+		secure      = fs.Bool("secure", defaults.Has(randomx.RANDOMX_FLAG_SECURE), "W^X for JIT code")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	n, err := parseCount(*count)
+	if err != nil {
+		return err
+	}
+	*threads = max(*threads, 1)
+	*initThreads = max(*initThreads, 1)
+
+	flags := defaults &^ (randomx.RANDOMX_FLAG_JIT | randomx.RANDOMX_FLAG_HARD_AES | randomx.RANDOMX_FLAG_SECURE)
+	for _, f := range []struct {
+		set  bool
+		flag randomx.Flags
+	}{
+		{*full, randomx.RANDOMX_FLAG_FULL_MEM},
+		{*jit, randomx.RANDOMX_FLAG_JIT},
+		{*hardAES, randomx.RANDOMX_FLAG_HARD_AES},
+		{*largePages, randomx.RANDOMX_FLAG_LARGE_PAGES},
+		{*secure, randomx.RANDOMX_FLAG_SECURE},
+	} {
+		if f.set {
+			flags |= f.flag
+		}
+	}
+
+	mode := "light"
+	if *full {
+		mode = "full"
+	}
+	fmt.Fprintf(stdout, "benchmark: %s hashes, %s mode, %d threads, jit=%v hard-aes=%v large-pages=%v secure=%v\n",
+		formatCount(n), mode, *threads, flags.HasJIT(), *hardAES, *largePages, *secure)
+
+	start := time.Now()
+	cache, err := randomx.NewCache(flags)
+	if err != nil {
+		return err
+	}
+	defer cache.Close()
+	if err = cache.Init(benchmarkKey); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "cache init: %s\n", time.Since(start).Round(time.Millisecond))
+
+	var dataset *randomx.Dataset
+	if *full {
+		start = time.Now()
+		if dataset, err = randomx.NewDataset(flags); err != nil {
+			return err
+		}
+		defer dataset.Close()
+		if err = dataset.InitDatasetParallel(cache, *initThreads); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "dataset init: %s\n", time.Since(start).Round(time.Millisecond))
+	}
+
+	results := make([]threadResult, *threads)
+	// small enough that all threads get work on short runs
+	chunkSize := min(maxChunkSize, max(n/uint64(8**threads), 1))
+	var next atomic.Uint64
+	var wg sync.WaitGroup
+	start = time.Now()
+	for i := range results {
+		wg.Add(1)
+		go func(r *threadResult) {
+			defer wg.Done()
+			r.err = hashThread(flags, cache, dataset, n, chunkSize, &next, r)
+		}(&results[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var xor [randomx.RANDOMX_HASH_SIZE]byte
+	rates := make([]float64, 0, len(results))
+	for i, r := range results {
+		if r.err != nil {
+			return r.err
+		}
+		for j := range xor {
+			xor[j] ^= r.xor[j]
+		}
+		var rate float64
+		if r.duration > 0 {
+			rate = float64(r.hashes) / r.duration.Seconds()
+		}
+		rates = append(rates, rate)
+		fmt.Fprintf(stdout, "thread %d: %d hashes, %.2f H/s\n", i, r.hashes, rate)
+	}
+
+	mean, stddev := meanStdDev(rates)
+	var variance float64
+	if mean > 0 {
+		variance = stddev / mean * 100
+	}
+	fmt.Fprintf(stdout, "hashrate: %.2f H/s in %s, per thread %.2f H/s ±%.1f%%\n",
+		float64(n)/elapsed.Seconds(), elapsed.Round(time.Millisecond), mean, variance)
+
+	result := hex.EncodeToString(xor[:])
+	expected, ok := knownResults[n]
+	switch {
+	case !ok:
+		fmt.Fprintf(stdout, "result: %s (no known result for %s hashes)\n", result, formatCount(n))
+	case expected == result:
+		fmt.Fprintf(stdout, "result: %s OK\n", result)
+	default:
+		fmt.Fprintf(stdout, "result: %s MISMATCH, expected %s\n", result, expected)
+		return errMismatch
+	}
+	return nil
+}
+
+// hashThread Hashes chunks of nonces claimed from next until n nonces have been claimed,
+// accumulating the XOR of hashes into r
+func hashThread(flags randomx.Flags, cache *randomx.Cache, dataset *randomx.Dataset, n, chunkSize uint64, next *atomic.Uint64, r *threadResult) error {
+	if dataset != nil {
+		// the Cache is only needed to initialize the Dataset
+		cache = nil
+	}
+	vm, err := randomx.NewVM(flags, cache, dataset)
+	if err != nil {
+		return err
+	}
+	defer vm.Close()
+
+	blob := make([]byte, len(benchmarkBlob))
+	copy(blob, benchmarkBlob)
+	nonce := blob[nonceOffset : nonceOffset+4]
+
+	var hash [randomx.RANDOMX_HASH_SIZE]byte
+	start := time.Now()
+	defer func() {
+		r.duration = time.Since(start)
+	}()
+
+	for {
+		first := next.Add(chunkSize) - chunkSize
+		if first >= n {
+			return nil
+		}
+		last := min(first+chunkSize, n)
+
+		binary.LittleEndian.PutUint32(nonce, uint32(first))
+		if err = vm.CalculateHashFirst(blob); err != nil {
+			return err
+		}
+		for i := first + 1; i <= last; i++ {
+			if i == last {
+				err = vm.CalculateHashLast(&hash)
+			} else {
+				binary.LittleEndian.PutUint32(nonce, uint32(i))
+				err = vm.CalculateHashNext(blob, &hash)
+			}
+			if err != nil {
+				return err
+			}
+			for j := range hash {
+				r.xor[j] ^= hash[j]
+			}
+			r.hashes++
+		}
+	}
+}
+
+func meanStdDev(values []float64) (mean, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	for _, v := range values {
+		stddev += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(stddev / float64(len(values)))
+}
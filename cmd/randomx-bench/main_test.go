@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_ParseCount(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		s        string
+		expected uint64
+	}{
+		{"16", 16},
+		{"1K", 1000},
+		{"10k", 10000},
+		{"1M", 1000 * 1000},
+		{"4294967296", 0},
+		{"4295M", 0},
+		{"0", 0},
+		{"", 0},
+		{"1G", 0},
+	} {
+		n, err := parseCount(test.s)
+		if test.expected == 0 {
+			if err == nil {
+				t.Errorf("%q: expected error", test.s)
+			}
+			continue
+		}
+		if err != nil || n != test.expected {
+			t.Errorf("%q: expected %d, got %d %v", test.s, test.expected, n, err)
+			continue
+		}
+		if formatted := formatCount(n); formatted != strings.ToUpper(test.s) {
+			t.Errorf("%d: expected %q, got %q", n, test.s, formatted)
+		}
+	}
+}
+
+func Test_Run(t *testing.T) {
+	// modifies knownResults
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-n", "16", "-threads", "2"}, &stdout, &stderr); err != nil {
+		t.Fatalf("%s\n%s", err, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "OK\n") {
+		t.Fatalf("expected known result:\n%s", stdout.String())
+	}
+
+	expected := knownResults[16]
+	defer func() {
+		knownResults[16] = expected
+	}()
+	knownResults[16] = strings.Repeat("00", 32)
+
+	stdout.Reset()
+	if err := run([]string{"-n", "16", "-threads", "3"}, &stdout, &stderr); !errors.Is(err, errMismatch) {
+		t.Fatalf("expected errMismatch, got %v\n%s", err, stdout.String())
+	}
+}
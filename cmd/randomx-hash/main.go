@@ -0,0 +1,348 @@
+// Command randomx-hash calculates RandomX hashes of inputs under a key.
+//
+// Key and input are hex encoded, or literal text with -text. The input is read from -input, -input-file or stdin.
+// Each hash is printed as a line of lowercase hex, followed by the commitment when -commitment is set,
+// the same format as the expected values of the reference test vectors.
+//
+// With -batch, one input is read per line and hashes are streamed in order as they are calculated, pipelining
+// consecutive inputs via CalculateHashFirst / CalculateHashNext.
+//
+//	randomx-hash -text -key "test key 000" -input "This is a test"
+//	printf 'This is a test\nLorem ipsum dolor sit amet\n' | randomx-hash -text -key "test key 000" -batch
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// configs Selectable configuration presets
+var configs = map[string]randomx.Config{
+	"monero": randomx.ConfigMonero,
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "randomx-hash: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// options Parsed command line
+type options struct {
+	key        []byte
+	text       bool
+	batch      bool
+	commitment bool
+	threads    int
+	flags      randomx.Flags
+	config     randomx.Config
+	input      io.Reader
+}
+
+func parse(args []string, stdin io.Reader, stderr io.Writer) (*options, error) {
+	defaults := randomx.GetFlags()
+
+	fs := flag.NewFlagSet("randomx-hash", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		keyHex     = fs.String("key", "", "key, hex encoded unless -text is set")
+		keyFile    = fs.String("key-file", "", "read the key from `path`, - for stdin")
+		inputHex   = fs.String("input", "", "input, hex encoded unless -text is set")
+		inputFile  = fs.String("input-file", "-", "read input from `path`, - for stdin. Ignored if -input is set")
+		text       = fs.Bool("text", false, "key and inputs are literal text instead of hex")
+		batch      = fs.Bool("batch", false, "hash one input per line")
+		commitment = fs.Bool("commitment", false, "also print the commitment of each hash")
+		full       = fs.Bool("full", false, "full (dataset) mode instead of light mode")
+		threads    = fs.Int("threads", runtime.NumCPU(), "threads for dataset initialization in full mode")
+		jit        = fs.Bool("jit", defaults.Has(randomx.RANDOMX_FLAG_JIT), "use the JIT compiler")
+		hardAES    = fs.Bool("hard-aes", defaults.Has(randomx.RANDOMX_FLAG_HARD_AES), "use hardware AES")
+		largePages = fs.Bool("large-pages", false, "allocate memory in large pages")
+		secure     = fs.Bool("secure", defaults.Has(randomx.RANDOMX_FLAG_SECURE), "W^X for JIT code")
+		configName = fs.String("config", "monero", "configuration preset, one of "+strings.Join(configNames(), ", "))
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: randomx-hash -key <hex> [-input <hex>] [options]\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	o := &options{
+		text:       *text,
+		batch:      *batch,
+		commitment: *commitment,
+		threads:    max(*threads, 1),
+		flags:      defaults &^ (randomx.RANDOMX_FLAG_JIT | randomx.RANDOMX_FLAG_HARD_AES | randomx.RANDOMX_FLAG_SECURE),
+	}
+
+	var ok bool
+	if o.config, ok = configs[*configName]; !ok {
+		return nil, fmt.Errorf("unknown config %q", *configName)
+	}
+
+	for _, f := range []struct {
+		set  bool
+		flag randomx.Flags
+	}{
+		{*full, randomx.RANDOMX_FLAG_FULL_MEM},
+		{*jit, randomx.RANDOMX_FLAG_JIT},
+		{*hardAES, randomx.RANDOMX_FLAG_HARD_AES},
+		{*largePages, randomx.RANDOMX_FLAG_LARGE_PAGES},
+		{*secure, randomx.RANDOMX_FLAG_SECURE},
+	} {
+		if f.set {
+			o.flags |= f.flag
+		}
+	}
+
+	keyFromStdin := *keyFile == "-"
+	switch {
+	case *keyHex != "" && *keyFile != "":
+		return nil, errors.New("-key and -key-file are mutually exclusive")
+	case *keyHex != "":
+		key, err := o.decode([]byte(*keyHex))
+		if err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+		o.key = key
+	case *keyFile != "":
+		data, err := readFile(*keyFile, stdin)
+		if err != nil {
+			return nil, err
+		}
+		if o.key, err = o.decode(data); err != nil {
+			return nil, fmt.Errorf("key: %w", err)
+		}
+	default:
+		return nil, errors.New("-key or -key-file is required")
+	}
+
+	switch {
+	case *inputHex != "":
+		if o.batch {
+			return nil, errors.New("-input cannot be used with -batch")
+		}
+		o.input = strings.NewReader(*inputHex)
+	case *inputFile == "-":
+		if keyFromStdin {
+			return nil, errors.New("key and input cannot both be read from stdin")
+		}
+		o.input = stdin
+	default:
+		f, err := os.Open(*inputFile)
+		if err != nil {
+			return nil, err
+		}
+		o.input = f
+	}
+
+	return o, nil
+}
+
+func configNames() []string {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readFile(path string, stdin io.Reader) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// decode Decodes a key or input. In text mode data is used as is.
+func (o *options) decode(data []byte) ([]byte, error) {
+	if o.text {
+		return data, nil
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	o, err := parse(args, stdin, stderr)
+	if err != nil {
+		return err
+	}
+	if c, ok := o.input.(io.Closer); ok && o.input != stdin {
+		defer c.Close()
+	}
+
+	vm, release, err := o.newVM()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	w := bufio.NewWriter(stdout)
+	if o.batch {
+		err = o.hashLines(vm, w)
+	} else {
+		err = o.hashAll(vm, w)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// newVM Creates a VM with a Cache, and a Dataset in full mode, initialized with the key.
+// The returned function closes the VM and its Cache or Dataset.
+func (o *options) newVM() (*randomx.VM, func(), error) {
+	cache, err := randomx.NewCacheWithConfig(o.flags, o.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = cache.Init(o.key); err != nil {
+		_ = cache.Close()
+		return nil, nil, err
+	}
+	release := func() {
+		_ = cache.Close()
+	}
+
+	var dataset *randomx.Dataset
+	if o.flags.Has(randomx.RANDOMX_FLAG_FULL_MEM) {
+		dataset, err = randomx.NewDatasetWithConfig(o.flags, o.config)
+		if err == nil {
+			err = dataset.InitDatasetParallel(cache, o.threads)
+		}
+		// the Cache is no longer needed once the Dataset is initialized
+		_ = cache.Close()
+		cache = nil
+		if err != nil {
+			if dataset != nil {
+				_ = dataset.Close()
+			}
+			return nil, nil, err
+		}
+		release = func() {
+			_ = dataset.Close()
+		}
+	}
+
+	vm, err := randomx.NewVM(o.flags, cache, dataset)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return vm, func() {
+		_ = vm.Close()
+		release()
+	}, nil
+}
+
+// write Prints a hash, and its commitment if requested
+func (o *options) write(w io.Writer, hash, commitment *[randomx.RANDOMX_HASH_SIZE]byte) error {
+	var err error
+	if o.commitment {
+		_, err = fmt.Fprintf(w, "%x %x\n", hash[:], commitment[:])
+	} else {
+		_, err = fmt.Fprintf(w, "%x\n", hash[:])
+	}
+	return err
+}
+
+// hashAll Hashes the whole input
+func (o *options) hashAll(vm *randomx.VM, w io.Writer) error {
+	data, err := io.ReadAll(o.input)
+	if err != nil {
+		return err
+	}
+	input, err := o.decode(data)
+	if err != nil {
+		return fmt.Errorf("input: %w", err)
+	}
+
+	var hash, commitment [randomx.RANDOMX_HASH_SIZE]byte
+	if o.commitment {
+		err = vm.CalculateCommitment(input, &hash, &commitment)
+	} else {
+		err = vm.CalculateHash(input, &hash)
+	}
+	if err != nil {
+		return err
+	}
+	return o.write(w, &hash, &commitment)
+}
+
+// hashLines Hashes each input line, writing each hash as soon as it is calculated
+func (o *options) hashLines(vm *randomx.VM, w *bufio.Writer) error {
+	scanner := bufio.NewScanner(o.input)
+	scanner.Buffer(nil, 1<<24)
+
+	var hash, commitment [randomx.RANDOMX_HASH_SIZE]byte
+	var line uint64
+	for scanner.Scan() {
+		line++
+		input, err := o.decode(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("input line %d: %w", line, err)
+		}
+
+		if line == 1 {
+			if o.commitment {
+				err = vm.CalculateCommitmentFirst(input)
+			} else {
+				err = vm.CalculateHashFirst(input)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if o.commitment {
+			err = vm.CalculateCommitmentNext(input, &hash, &commitment)
+		} else {
+			err = vm.CalculateHashNext(input, &hash)
+		}
+		if err != nil {
+			return err
+		}
+		if err = o.write(w, &hash, &commitment); err != nil {
+			return err
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if line == 0 {
+		return nil
+	}
+
+	var err error
+	if o.commitment {
+		err = vm.CalculateCommitmentLast(&hash, &commitment)
+	} else {
+		err = vm.CalculateHashLast(&hash)
+	}
+	if err != nil {
+		return err
+	}
+	return o.write(w, &hash, &commitment)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_Run(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name     string
+		args     []string
+		stdin    string
+		expected string
+	}{
+		{
+			name: "batch",
+			args: []string{"-text", "-key", "test key 000", "-batch"},
+			stdin: "This is a test\n" +
+				"Lorem ipsum dolor sit amet\n" +
+				"sed do eiusmod tempor incididunt ut labore et dolore magna aliqua\n",
+			expected: "639183aae1bf4c9a35884cb46b09cad9175f04efd7684e7262a0ac1c2f0b4e3f\n" +
+				"300a0adb47603dedb42228ccb2b211104f4da45af709cd7547cd049e9489c969\n" +
+				"c36d4ed4191e617309867ed66a443be4075014e2b061bcdaf9ce7b721d2b77a8\n",
+		},
+		{
+			name: "commitment",
+			// hex encoded test_a of the reference tests
+			args:  []string{"-key", "74657374206b657920303030", "-commitment"},
+			stdin: "5468697320697320612074657374\n",
+			expected: "639183aae1bf4c9a35884cb46b09cad9175f04efd7684e7262a0ac1c2f0b4e3f " +
+				"d53ccf348b75291b7be76f0a7ac8208bbced734b912f6fca60539ab6f86be919\n",
+		},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+			if err := run(test.args, strings.NewReader(test.stdin), &stdout, &stderr); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != test.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", test.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func Test_Run_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][]string{
+		{},
+		{"-key", "zz"},
+		{"-key", "00", "-key-file", "key"},
+		{"-key-file", "-"},
+		{"-key", "00", "-input", "00", "-batch"},
+		{"-key", "00", "-config", "unknown"},
+		{"-key", "00", "extra"},
+	} {
+		var stdout, stderr bytes.Buffer
+		if err := run(args, strings.NewReader(""), &stdout, &stderr); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
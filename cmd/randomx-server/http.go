@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/monero"
+)
+
+// maxRequestSize Limit of HTTP request bodies
+const maxRequestSize = 1 << 20
+
+type hashRequest struct {
+	// Key RandomX key, hex encoded
+	Key string `json:"key"`
+	// Input hex encoded
+	Input string `json:"input"`
+}
+
+type hashResponse struct {
+	Hash randomx.Hash `json:"hash"`
+}
+
+type verifyRequest struct {
+	Key   string       `json:"key"`
+	Input string       `json:"input"`
+	Hash  randomx.Hash `json:"hash"`
+	// Difficulty If set, the hash must also meet this difficulty
+	Difficulty *randomx.Difficulty `json:"difficulty,omitempty"`
+}
+
+type verifyResponse struct {
+	Valid bool `json:"valid"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// JSON-RPC request and response, as used by monerod /json_rpc
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes. rpcErrorWrongBlockBlob is the monerod CORE_RPC_ERROR_CODE_WRONG_BLOCKBLOB.
+const (
+	rpcErrorWrongBlockBlob = -6
+	rpcErrorInternal       = -32000
+	rpcErrorParse          = -32700
+	rpcErrorMethod         = -32601
+	rpcErrorParams         = -32602
+)
+
+// calcPowParams monerod calc_pow parameters
+type calcPowParams struct {
+	MajorVersion uint8  `json:"major_version"`
+	Height       uint64 `json:"height"`
+	// BlockBlob Block in binary serialization, hex encoded
+	BlockBlob string `json:"block_blob"`
+	// SeedHash RandomX key, hex encoded
+	SeedHash string `json:"seed_hash"`
+}
+
+// handler Serves the HTTP API:
+//
+//	POST /hash      hashRequest -> hashResponse
+//	POST /verify    verifyRequest -> verifyResponse
+//	POST /json_rpc  monerod compatible JSON-RPC, with method calc_pow
+//	GET  /stats     serviceStats
+func (s *service) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hash", func(w http.ResponseWriter, r *http.Request) {
+		var req hashRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		key, input, err := decodeHex(req.Key, req.Input)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		hash, err := s.hash(r.Context(), key, input)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, hashResponse{Hash: hash})
+	})
+	mux.HandleFunc("/verify", func(w http.ResponseWriter, r *http.Request) {
+		var req verifyRequest
+		if !decodeRequest(w, r, &req) {
+			return
+		}
+		key, input, err := decodeHex(req.Key, req.Input)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		valid, err := s.verify(r.Context(), key, input, req.Hash, req.Difficulty)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, verifyResponse{Valid: valid})
+	})
+	mux.HandleFunc("/json_rpc", func(w http.ResponseWriter, r *http.Request) {
+		var req rpcRequest
+		if r.Method != http.MethodPost {
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("0"), Error: &rpcError{Code: rpcErrorParse, Message: err.Error()}})
+			return
+		}
+		if len(req.ID) == 0 {
+			req.ID = json.RawMessage("null")
+		}
+		result, rpcErr := s.rpc(r.Context(), req.Method, req.Params)
+		writeJSON(w, http.StatusOK, rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.stats())
+	})
+	return mux
+}
+
+// verify Checks that hash is the hash of input under key, and meets difficulty if not nil
+func (s *service) verify(ctx context.Context, key, input []byte, hash randomx.Hash, difficulty *randomx.Difficulty) (bool, error) {
+	result, err := s.hash(ctx, key, input)
+	if err != nil {
+		return false, err
+	}
+	if result != hash {
+		return false, nil
+	}
+	return difficulty == nil || hash.MeetsDifficulty(*difficulty), nil
+}
+
+// rpc Handles a JSON-RPC method
+func (s *service) rpc(ctx context.Context, method string, params json.RawMessage) (any, *rpcError) {
+	if method != "calc_pow" {
+		return nil, &rpcError{Code: rpcErrorMethod, Message: "Method not found"}
+	}
+
+	var p calcPowParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &rpcError{Code: rpcErrorParams, Message: err.Error()}
+	}
+	if p.MajorVersion < monero.RandomXMajorVersion {
+		return nil, &rpcError{Code: rpcErrorParams, Message: "Only RandomX proof of work is supported"}
+	}
+	seedHash, err := hex.DecodeString(p.SeedHash)
+	if err != nil || len(seedHash) != monero.HashSize {
+		return nil, &rpcError{Code: rpcErrorParams, Message: "Invalid seed hash"}
+	}
+	data, err := hex.DecodeString(p.BlockBlob)
+	if err != nil {
+		return nil, &rpcError{Code: rpcErrorWrongBlockBlob, Message: "Wrong block blob"}
+	}
+	block, err := monero.ParseBlock(data)
+	if err != nil {
+		return nil, &rpcError{Code: rpcErrorWrongBlockBlob, Message: "Wrong block blob"}
+	}
+
+	hash, err := s.hash(ctx, seedHash, block.HashingBlob())
+	if err != nil {
+		return nil, &rpcError{Code: rpcErrorInternal, Message: err.Error()}
+	}
+	return hash, nil
+}
+
+// errBadRequest Malformed request
+type errBadRequest struct {
+	err error
+}
+
+func (e errBadRequest) Error() string {
+	return e.err.Error()
+}
+
+func decodeHex(key, input string) ([]byte, []byte, error) {
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, nil, errBadRequest{fmt.Errorf("key: %w", err)}
+	}
+	i, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, nil, errBadRequest{fmt.Errorf("input: %w", err)}
+	}
+	return k, i, nil
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestSize)).Decode(v); err != nil {
+		writeError(w, errBadRequest{err})
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var badRequest errBadRequest
+	switch {
+	case errors.As(err, &badRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, errBusy), errors.Is(err, errClosed):
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
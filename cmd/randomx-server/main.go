@@ -0,0 +1,150 @@
+// Command randomx-server serves RandomX hashing and verification to local processes, over HTTP JSON and over a
+// line protocol on a Unix domain socket.
+//
+// Caches of the most recently used keys are kept (-keys). Hashes are calculated by a bounded pool of -vms VMs,
+// requests wait for a free VM in a queue of up to -queue requests, beyond which they are rejected as busy
+// (HTTP 503 with Retry-After). Requests for a new key are also rejected as busy while all -keys Caches are in use.
+//
+// HTTP endpoints, with hex encoded keys, inputs and hashes:
+//
+//	POST /hash      {"key": "...", "input": "..."} -> {"hash": "..."}
+//	POST /verify    {"key": "...", "input": "...", "hash": "...", "difficulty": 123} -> {"valid": true}
+//	POST /json_rpc  monerod compatible calc_pow, with major_version, height, block_blob and seed_hash params
+//	GET  /stats
+//
+// Unix socket requests, one per line:
+//
+//	hash <key> <input>
+//	verify <key> <input> <hash> [difficulty]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "randomx-server: %s\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	defaults := randomx.GetFlags()
+
+	fs := flag.NewFlagSet("randomx-server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		httpAddress = fs.String("http", "127.0.0.1:18090", "HTTP listen address, empty to disable")
+		unixPath    = fs.String("unix", "", "Unix domain socket path for the line protocol, empty to disable")
+		vms         = fs.Int("vms", runtime.NumCPU(), "maximum number of VMs hashing at the same time")
+		queue       = fs.Int("queue", 64, "maximum number of requests waiting for a VM")
+		keys        = fs.Int("keys", 2, "number of keys kept initialized")
+		full        = fs.Bool("full", false, "full (dataset) mode instead of light mode, uses over 2 GiB per key")
+		initThreads = fs.Int("init-threads", runtime.NumCPU(), "threads for dataset initialization in full mode")
+		largePages  = fs.Bool("large-pages", false, "allocate memory in large pages")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *httpAddress == "" && *unixPath == "" {
+		return errors.New("-http or -unix is required")
+	}
+
+	flags := defaults
+	if *full {
+		flags |= randomx.RANDOMX_FLAG_FULL_MEM
+	}
+	if *largePages {
+		flags |= randomx.RANDOMX_FLAG_LARGE_PAGES
+	}
+
+	s := newService(flags, randomx.ConfigMonero, *vms, *queue, *keys, *initThreads)
+	defer s.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 2)
+	servers := 0
+
+	if *httpAddress != "" {
+		listener, err := net.Listen("tcp", *httpAddress)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{
+			Handler:           s.handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			BaseContext: func(net.Listener) context.Context {
+				return ctx
+			},
+		}
+		servers++
+		go func() {
+			err := server.Serve(listener)
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errs <- err
+		}()
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer shutdownCancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		fmt.Fprintf(stderr, "randomx-server: listening on http://%s\n", listener.Addr())
+	}
+
+	if *unixPath != "" {
+		// remove a stale socket of a previous run
+		if info, err := os.Lstat(*unixPath); err == nil && info.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(*unixPath)
+		}
+		listener, err := net.Listen("unix", *unixPath)
+		if err != nil {
+			return err
+		}
+		servers++
+		go func() {
+			errs <- s.serveLines(ctx, listener)
+		}()
+		go func() {
+			<-ctx.Done()
+			// also removes the socket file
+			_ = listener.Close()
+		}()
+		fmt.Fprintf(stderr, "randomx-server: listening on %s\n", *unixPath)
+	}
+
+	var err error
+	for i := 0; i < servers; i++ {
+		if serveErr := <-errs; serveErr != nil && err == nil {
+			err = serveErr
+			// stop the other listener
+			cancel()
+		}
+	}
+	return err
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// errBusy All VMs are in use and the queue is full, or all key slots are in use
+var errBusy = errors.New("server busy")
+
+// errClosed Service is shutting down
+var errClosed = errors.New("server closed")
+
+// keyEntry Cache (and Dataset in full mode) for a single key
+type keyEntry struct {
+	key string
+
+	cache   *randomx.Cache
+	dataset *randomx.Dataset
+
+	// ready closed when cache and dataset are initialized or err is set
+	ready chan struct{}
+	err   error
+
+	// lastUsed value of service.tick when last requested, for least recently used eviction
+	lastUsed uint64
+	// refs number of requests using the entry
+	refs    int
+	evicted bool
+}
+
+func (e *keyEntry) close() {
+	if e.dataset != nil {
+		_ = e.dataset.Close()
+	}
+	if e.cache != nil {
+		_ = e.cache.Close()
+	}
+}
+
+// service Hashes inputs under arbitrary keys. Caches of the most recently used keys are kept, and hashes are
+// calculated by a bounded pool of VMs rebound to the requested key on use. Requests wait for a VM in a bounded queue,
+// and fail with errBusy once it is full. At most maxKeys Caches are allocated at once, requests for a new key fail
+// with errBusy while all of them are in use. Safe for concurrent use.
+type service struct {
+	flags       randomx.Flags
+	config      randomx.Config
+	initThreads int
+	maxKeys     int
+	maxQueue    int
+
+	// sem holds one token per VM in use
+	sem chan struct{}
+	// queued number of requests waiting for a VM
+	queued atomic.Int64
+	// hashes number of hashes calculated
+	hashes atomic.Uint64
+
+	lock sync.Mutex
+	keys map[string]*keyEntry
+	// entries number of entries not closed yet, including evicted ones still in use or initializing
+	entries int
+	tick    uint64
+	vms     []*randomx.VM
+	free    []*randomx.VM
+	closed  bool
+}
+
+func newService(flags randomx.Flags, config randomx.Config, vms, maxQueue, maxKeys, initThreads int) *service {
+	return &service{
+		flags:       flags,
+		config:      config,
+		initThreads: max(initThreads, 1),
+		maxKeys:     max(maxKeys, 1),
+		maxQueue:    max(maxQueue, 0),
+		sem:         make(chan struct{}, max(vms, 1)),
+		keys:        make(map[string]*keyEntry),
+	}
+}
+
+// entry Returns the entry for key, starting its initialization if needed and evicting the least recently used
+// unused entry beyond maxKeys. Fails with errBusy when no entry can be freed. The entry must be returned via release.
+func (s *service) entry(key []byte) (*keyEntry, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil, errClosed
+	}
+
+	s.tick++
+	if e, ok := s.keys[string(key)]; ok {
+		e.refs++
+		e.lastUsed = s.tick
+		return e, nil
+	}
+
+	if s.entries >= s.maxKeys {
+		var oldest *keyEntry
+		for _, e := range s.keys {
+			if e.refs == 0 && (oldest == nil || e.lastUsed < oldest.lastUsed) {
+				oldest = e
+			}
+		}
+		if oldest != nil {
+			s.evict(oldest)
+		}
+	}
+	// evicted entries still initializing are only freed once done
+	if s.entries >= s.maxKeys {
+		return nil, errBusy
+	}
+
+	e := &keyEntry{
+		key:      string(key),
+		ready:    make(chan struct{}),
+		lastUsed: s.tick,
+		refs:     1,
+	}
+	s.keys[e.key] = e
+	s.entries++
+	go s.init(e)
+	return e, nil
+}
+
+// init Initializes the Cache, and the Dataset in full mode, of an entry
+func (s *service) init(e *keyEntry) {
+	defer close(e.ready)
+
+	cache, err := randomx.NewCacheWithConfig(s.flags, s.config)
+	if err != nil {
+		e.err = err
+		return
+	}
+	e.cache = cache
+	if err = cache.Init([]byte(e.key)); err != nil {
+		e.err = err
+		return
+	}
+
+	if s.flags.Has(randomx.RANDOMX_FLAG_FULL_MEM) {
+		dataset, err := randomx.NewDatasetWithConfig(s.flags, s.config)
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.dataset = dataset
+		if err = dataset.InitDatasetParallel(cache, s.initThreads); err != nil {
+			e.err = err
+			return
+		}
+		// only the Dataset is used from now on
+		e.cache = nil
+		_ = cache.Close()
+	}
+}
+
+// evict Removes an entry, freeing it once unused. Lock must be held.
+func (s *service) evict(e *keyEntry) {
+	if s.keys[e.key] == e {
+		delete(s.keys, e.key)
+	}
+	e.evicted = true
+	s.freeEntry(e)
+}
+
+// freeEntry Closes an evicted entry that is not used anymore, once initialized. Lock must be held.
+func (s *service) freeEntry(e *keyEntry) {
+	if !e.evicted || e.refs > 0 {
+		return
+	}
+	select {
+	case <-e.ready:
+		e.close()
+		s.entries--
+	default:
+		go func() {
+			<-e.ready
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			e.close()
+			s.entries--
+		}()
+	}
+}
+
+func (s *service) release(e *keyEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e.refs--
+	s.freeEntry(e)
+}
+
+// acquire Waits for a VM token, failing with errBusy if maxQueue requests are already waiting
+func (s *service) acquire(ctx context.Context) error {
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if s.queued.Add(1) > int64(s.maxQueue) {
+		s.queued.Add(-1)
+		return errBusy
+	}
+	defer s.queued.Add(-1)
+
+	select {
+	case s.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// vm Returns a free VM bound to e, creating one if none is free. A sem token must be held.
+func (s *service) vm(e *keyEntry) (vm *randomx.VM, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil, errClosed
+	}
+
+	if len(s.free) > 0 {
+		vm = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		if e.dataset != nil {
+			err = vm.SetDataset(e.dataset)
+		} else {
+			err = vm.SetCache(e.cache)
+		}
+		if err != nil {
+			s.free = append(s.free, vm)
+			return nil, err
+		}
+		return vm, nil
+	}
+
+	if vm, err = randomx.NewVM(s.flags, e.cache, e.dataset); err != nil {
+		return nil, err
+	}
+	s.vms = append(s.vms, vm)
+	return vm, nil
+}
+
+func (s *service) put(vm *randomx.VM) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.free = append(s.free, vm)
+}
+
+// hash Calculates the RandomX hash of input under key. Waits for the key to be initialized and for a free VM.
+func (s *service) hash(ctx context.Context, key, input []byte) (hash randomx.Hash, err error) {
+	e, err := s.entry(key)
+	if err != nil {
+		return hash, err
+	}
+	defer s.release(e)
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return hash, ctx.Err()
+	}
+	if e.err != nil {
+		// retry initialization on the next request
+		s.lock.Lock()
+		if !e.evicted {
+			s.evict(e)
+		}
+		s.lock.Unlock()
+		return hash, e.err
+	}
+
+	if err = s.acquire(ctx); err != nil {
+		return hash, err
+	}
+	defer func() {
+		<-s.sem
+	}()
+
+	vm, err := s.vm(e)
+	if err != nil {
+		return hash, err
+	}
+	defer s.put(vm)
+
+	if err = vm.CalculateHash(input, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		return hash, err
+	}
+	s.hashes.Add(1)
+	return hash, nil
+}
+
+// serviceStats Service counters, see service.stats
+type serviceStats struct {
+	Keys   int    `json:"keys"`
+	VMs    int    `json:"vms"`
+	Busy   int    `json:"busy"`
+	Queued int64  `json:"queued"`
+	Hashes uint64 `json:"hashes"`
+}
+
+func (s *service) stats() serviceStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return serviceStats{
+		Keys:   len(s.keys),
+		VMs:    len(s.vms),
+		Busy:   len(s.sem),
+		Queued: s.queued.Load(),
+		Hashes: s.hashes.Load(),
+	}
+}
+
+// close Waits for in-flight hashes, then releases all VMs and keys
+func (s *service) close() {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	// wait for all in-flight hashes to finish
+	for i := 0; i < cap(s.sem); i++ {
+		s.sem <- struct{}{}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, vm := range s.vms {
+		_ = vm.Close()
+	}
+	s.vms, s.free = nil, nil
+	for _, e := range s.keys {
+		s.evict(e)
+	}
+}
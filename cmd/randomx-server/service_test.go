@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/monero"
+)
+
+// testConfig Small configuration so that tests run quickly
+var testConfig = func() randomx.Config {
+	c := randomx.ConfigMonero
+	c.ArgonMemory = 256
+	c.ArgonSalt = "RandomX\x03test"
+	c.DatasetBaseSize = 1 << 20
+	c.DatasetExtraSize = 64 * 7
+	c.ProgramSize = 64
+	c.ProgramIterations = 128
+	c.ProgramCount = 4
+	c.ScratchpadL3 = 1 << 16
+	c.ScratchpadL2 = 1 << 14
+	c.ScratchpadL1 = 1 << 12
+	return c
+}()
+
+// expectedHash Calculates a hash directly
+func expectedHash(t *testing.T, key, input []byte) randomx.Hash {
+	t.Helper()
+
+	cache, err := randomx.NewCacheWithConfig(randomx.GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err = cache.Init(key); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := randomx.NewVM(randomx.GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var hash randomx.Hash
+	if err = vm.CalculateHash(input, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func newTestService(t *testing.T, vms, queue, keys int) *service {
+	s := newService(randomx.GetFlags(), testConfig, vms, queue, keys, 1)
+	t.Cleanup(s.close)
+	return s
+}
+
+func post(t *testing.T, url string, request, response any) int {
+	t.Helper()
+
+	body, _ := json.Marshal(request)
+	r, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if err = json.NewDecoder(r.Body).Decode(response); err != nil {
+		t.Fatal(err)
+	}
+	return r.StatusCode
+}
+
+func Test_Service_HTTP(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t, 2, 4, 1)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	key, input := []byte("test key 000"), []byte("This is a test")
+	expected := expectedHash(t, key, input)
+
+	var hashResp hashResponse
+	if status := post(t, server.URL+"/hash", hashRequest{Key: hex.EncodeToString(key), Input: hex.EncodeToString(input)}, &hashResp); status != http.StatusOK || hashResp.Hash != expected {
+		t.Fatalf("unexpected response %d %s", status, hashResp.Hash)
+	}
+
+	for _, test := range []struct {
+		hash       randomx.Hash
+		difficulty *randomx.Difficulty
+		valid      bool
+	}{
+		{expected, nil, true},
+		{expected, &randomx.Difficulty{Hi: 1}, false},
+		{randomx.Hash{}, nil, false},
+	} {
+		var verifyResp verifyResponse
+		req := verifyRequest{Key: hex.EncodeToString(key), Input: hex.EncodeToString(input), Hash: test.hash, Difficulty: test.difficulty}
+		if status := post(t, server.URL+"/verify", req, &verifyResp); status != http.StatusOK || verifyResp.Valid != test.valid {
+			t.Errorf("unexpected response %d %v for %+v", status, verifyResp.Valid, req)
+		}
+	}
+
+	var errResp errorResponse
+	if status := post(t, server.URL+"/hash", hashRequest{Key: "zz"}, &errResp); status != http.StatusBadRequest || errResp.Error == "" {
+		t.Errorf("unexpected response %d %+v", status, errResp)
+	}
+
+	// another key evicts the first one
+	key = []byte("test key 001")
+	if status := post(t, server.URL+"/hash", hashRequest{Key: hex.EncodeToString(key), Input: hex.EncodeToString(input)}, &hashResp); status != http.StatusOK || hashResp.Hash != expectedHash(t, key, input) {
+		t.Fatalf("unexpected response %d %s", status, hashResp.Hash)
+	}
+	if stats := s.stats(); stats.Keys != 1 || stats.Hashes != 5 || stats.VMs != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_Service_CalcPow(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t, 1, 4, 1)
+	server := httptest.NewServer(s.handler())
+	defer server.Close()
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "monero", "testdata", "synthetic_100.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockBlob := strings.TrimSpace(string(data))
+	blob, _ := hex.DecodeString(blockBlob)
+	block, err := monero.ParseBlock(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedHash := bytes.Repeat([]byte{0x5e}, monero.HashSize)
+	expected := expectedHash(t, seedHash, block.HashingBlob())
+
+	call := func(params calcPowParams) (result string, rpcErr *rpcError) {
+		p, _ := json.Marshal(params)
+		var resp struct {
+			ID     int       `json:"id"`
+			Result string    `json:"result"`
+			Error  *rpcError `json:"error"`
+		}
+		if status := post(t, server.URL+"/json_rpc", rpcRequest{JSONRPC: "2.0", ID: json.RawMessage("7"), Method: "calc_pow", Params: p}, &resp); status != http.StatusOK || resp.ID != 7 {
+			t.Fatalf("unexpected response %d %+v", status, resp)
+		}
+		return resp.Result, resp.Error
+	}
+
+	result, rpcErr := call(calcPowParams{MajorVersion: 16, Height: 100, BlockBlob: blockBlob, SeedHash: hex.EncodeToString(seedHash)})
+	if rpcErr != nil || result != expected.String() {
+		t.Fatalf("unexpected result %s %+v", result, rpcErr)
+	}
+
+	if _, rpcErr = call(calcPowParams{MajorVersion: 16, BlockBlob: blockBlob[:100], SeedHash: hex.EncodeToString(seedHash)}); rpcErr == nil || rpcErr.Code != rpcErrorWrongBlockBlob {
+		t.Errorf("expected wrong block blob error, got %+v", rpcErr)
+	}
+	if _, rpcErr = call(calcPowParams{MajorVersion: 1, BlockBlob: blockBlob, SeedHash: hex.EncodeToString(seedHash)}); rpcErr == nil || rpcErr.Code != rpcErrorParams {
+		t.Errorf("expected invalid params error, got %+v", rpcErr)
+	}
+	if _, rpcErr = call(calcPowParams{MajorVersion: 16, BlockBlob: blockBlob}); rpcErr == nil || rpcErr.Code != rpcErrorParams {
+		t.Errorf("expected invalid params error, got %+v", rpcErr)
+	}
+}
+
+func Test_Service_Lines(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t, 1, 4, 2)
+	path := filepath.Join(t.TempDir(), "randomx.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serveLines(ctx, listener)
+	}()
+	defer func() {
+		cancel()
+		_ = listener.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	key := hex.EncodeToString([]byte("test key 000"))
+	expected := expectedHash(t, []byte("test key 000"), []byte("This is a test"))
+	expectedEmpty := expectedHash(t, []byte("test key 000"), nil)
+
+	// pipelined requests are answered in order
+	requests := []string{
+		"hash " + key + " " + hex.EncodeToString([]byte("This is a test")),
+		"hash " + key + " ",
+		"verify " + key + " " + hex.EncodeToString([]byte("This is a test")) + " " + expected.String(),
+		"verify " + key + " " + hex.EncodeToString([]byte("This is a test")) + " " + expected.String() + " 0x10000000000000000",
+		"verify " + key + " 00 " + expected.String(),
+		"hash " + key,
+		"unknown",
+	}
+	responses := []string{
+		expected.String(),
+		expectedEmpty.String(),
+		"true",
+		"false",
+		"false",
+		"error ",
+		"error ",
+	}
+	if _, err = conn.Write([]byte(strings.Join(requests, "\n") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Minute))
+	reader := bufio.NewReader(conn)
+	for i, expected := range responses {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, expected) {
+			t.Errorf("%q: expected %q, got %q", requests[i], expected, line)
+		}
+	}
+}
+
+func Test_Service_Busy(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t, 1, 1, 1)
+	key, input := []byte("test key 000"), []byte("This is a test")
+
+	// occupy the only VM
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	queued := make(chan error, 1)
+	go func() {
+		_, err := s.hash(context.Background(), key, input)
+		queued <- err
+	}()
+	for s.stats().Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// queue is full
+	if _, err := s.hash(context.Background(), key, input); !errors.Is(err, errBusy) {
+		t.Fatalf("expected errBusy, got %v", err)
+	}
+
+	<-s.sem
+	if err := <-queued; err != nil {
+		t.Fatal(err)
+	}
+
+	s.close()
+	if _, err := s.hash(context.Background(), key, input); !errors.Is(err, errClosed) {
+		t.Fatalf("expected errClosed, got %v", err)
+	}
+}
+
+func Test_Service_BusyKeys(t *testing.T) {
+	t.Parallel()
+
+	s := newTestService(t, 1, 1, 1)
+
+	// hold the only key slot
+	e, err := s.entry([]byte("test key 000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.entry([]byte("test key 001")); !errors.Is(err, errBusy) {
+		t.Fatalf("expected errBusy, got %v", err)
+	}
+
+	// in use keys are still served
+	e2, err := s.entry([]byte("test key 000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.release(e2)
+
+	s.release(e)
+	<-e.ready
+
+	// unused key is evicted for the new one
+	e, err = s.entry([]byte("test key 001"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.release(e)
+	if stats := s.stats(); stats.Keys != 1 {
+		t.Fatalf("expected 1 key, got %d", stats.Keys)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// serveLines Serves the line protocol on listener until it is closed. Each request is a line of space separated
+// fields, hex encoded except for the command and difficulty, answered in order by a single line:
+//
+//	hash <key> <input>                       -> <hash>
+//	verify <key> <input> <hash> [difficulty] -> true | false
+//
+// Failed requests are answered with "error <message>".
+func (s *service) serveLines(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleLines(ctx, conn)
+		}()
+	}
+}
+
+func (s *service) handleLines(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// unblock reads on shutdown
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, maxRequestSize)
+	w := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		response, err := s.line(ctx, scanner.Text())
+		if err != nil {
+			response = "error " + strings.ReplaceAll(err.Error(), "\n", " ")
+		}
+		if _, err = fmt.Fprintln(w, response); err != nil {
+			return
+		}
+		if err = w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// line Handles a single request line
+func (s *service) line(ctx context.Context, line string) (string, error) {
+	// empty inputs are empty fields, so split on every space
+	fields := strings.Split(strings.TrimSuffix(line, "\r"), " ")
+
+	switch fields[0] {
+	case "hash":
+		if len(fields) != 3 {
+			return "", errors.New("usage: hash <key> <input>")
+		}
+		key, input, err := decodeHex(fields[1], fields[2])
+		if err != nil {
+			return "", err
+		}
+		hash, err := s.hash(ctx, key, input)
+		if err != nil {
+			return "", err
+		}
+		return hash.String(), nil
+	case "verify":
+		if len(fields) != 4 && len(fields) != 5 {
+			return "", errors.New("usage: verify <key> <input> <hash> [difficulty]")
+		}
+		key, input, err := decodeHex(fields[1], fields[2])
+		if err != nil {
+			return "", err
+		}
+		var hash randomx.Hash
+		if err = hash.UnmarshalText([]byte(fields[3])); err != nil {
+			return "", fmt.Errorf("hash: %w", err)
+		}
+		var difficulty *randomx.Difficulty
+		if len(fields) == 5 {
+			d, err := randomx.ParseDifficulty(fields[4])
+			if err != nil {
+				return "", fmt.Errorf("difficulty: %w", err)
+			}
+			difficulty = &d
+		}
+		valid, err := s.verify(ctx, key, input, hash, difficulty)
+		if err != nil {
+			return "", err
+		}
+		if valid {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		return "", fmt.Errorf("unknown command %q", fields[0])
+	}
+}
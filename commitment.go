@@ -1,6 +1,9 @@
 package randomx
 
-import "golang.org/x/crypto/blake2b"
+import (
+	"crypto/subtle"
+	"golang.org/x/crypto/blake2b"
+)
 
 // CalculateCommitment Calculate a RandomX commitment from a RandomX hash and its input.
 func CalculateCommitment(input []byte, hashIn, hashOut *[RANDOMX_HASH_SIZE]byte) {
@@ -13,3 +16,62 @@ func CalculateCommitment(input []byte, hashIn, hashOut *[RANDOMX_HASH_SIZE]byte)
 	hasher.Write(hashIn[:])
 	hasher.Sum(hashOut[:0])
 }
+
+// VerifyCommitment Checks that commitment was calculated from input and its RandomX hash.
+// The hash itself is not verified, use VM.CalculateHash for that.
+func VerifyCommitment(input []byte, hash, commitment *[RANDOMX_HASH_SIZE]byte) bool {
+	var expected [RANDOMX_HASH_SIZE]byte
+	CalculateCommitment(input, hash, &expected)
+	return subtle.ConstantTimeCompare(expected[:], commitment[:]) == 1
+}
+
+// CalculateCommitment Calculates a RandomX hash value and its commitment.
+func (vm *VM) CalculateCommitment(input []byte, hash, commitment *[RANDOMX_HASH_SIZE]byte) error {
+	if err := vm.CalculateHash(input, hash); err != nil {
+		return err
+	}
+	CalculateCommitment(input, hash, commitment)
+	return nil
+}
+
+// CalculateCommitmentFirst will begin a hash and commitment calculation.
+// input is copied and can be reused once CalculateCommitmentFirst returns.
+func (vm *VM) CalculateCommitmentFirst(input []byte) error {
+	vm.commitmentPending = false
+	if err := vm.CalculateHashFirst(input); err != nil {
+		return err
+	}
+	vm.commitmentInput = append(vm.commitmentInput[:0], input...)
+	vm.commitmentPending = true
+	return nil
+}
+
+// CalculateCommitmentNext will output the hash value and commitment of the previous input and begin the calculation of the next one.
+// Returns ErrNoPendingHash if not preceded by CalculateCommitmentFirst or CalculateCommitmentNext.
+func (vm *VM) CalculateCommitmentNext(nextInput []byte, hash, commitment *[RANDOMX_HASH_SIZE]byte) error {
+	if !vm.commitmentPending {
+		return ErrNoPendingHash
+	}
+	vm.commitmentPending = false
+	if err := vm.CalculateHashNext(nextInput, hash); err != nil {
+		return err
+	}
+	CalculateCommitment(vm.commitmentInput, hash, commitment)
+	vm.commitmentInput = append(vm.commitmentInput[:0], nextInput...)
+	vm.commitmentPending = true
+	return nil
+}
+
+// CalculateCommitmentLast will output the hash value and commitment of the previous input.
+// Returns ErrNoPendingHash if not preceded by CalculateCommitmentFirst or CalculateCommitmentNext.
+func (vm *VM) CalculateCommitmentLast(hash, commitment *[RANDOMX_HASH_SIZE]byte) error {
+	if !vm.commitmentPending {
+		return ErrNoPendingHash
+	}
+	vm.commitmentPending = false
+	if err := vm.CalculateHashLast(hash); err != nil {
+		return err
+	}
+	CalculateCommitment(vm.commitmentInput, hash, commitment)
+	return nil
+}
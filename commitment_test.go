@@ -2,6 +2,7 @@ package randomx
 
 import (
 	"encoding/hex"
+	"errors"
 	"testing"
 )
 
@@ -16,7 +17,9 @@ func Test_CalculateCommitment(t *testing.T) {
 
 	test := Tests[1]
 
-	cache.Init(test.key)
+	if err := cache.Init(test.key); err != nil {
+		t.Fatal(err)
+	}
 
 	vm, err := NewVM(GetFlags(), cache, nil)
 	if err != nil {
@@ -26,7 +29,9 @@ func Test_CalculateCommitment(t *testing.T) {
 
 	var outputHash [RANDOMX_HASH_SIZE]byte
 
-	vm.CalculateHash(test.input, &outputHash)
+	if err := vm.CalculateHash(test.input, &outputHash); err != nil {
+		t.Fatal(err)
+	}
 	CalculateCommitment(test.input, &outputHash, &outputHash)
 
 	outputHex := hex.EncodeToString(outputHash[:])
@@ -39,3 +44,96 @@ func Test_CalculateCommitment(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func Test_CalculateCommitment_Batch(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	tests := Tests[1:4]
+
+	if err := cache.Init(tests[0].key); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var hash, commitment [RANDOMX_HASH_SIZE]byte
+	if err := vm.CalculateCommitmentNext(tests[0].input, &hash, &commitment); !errors.Is(err, ErrNoPendingHash) {
+		t.Fatalf("expected ErrNoPendingHash, got %v", err)
+	}
+
+	var outputHash, outputCommitment [3][RANDOMX_HASH_SIZE]byte
+
+	// input buffer is reused between calls
+	input := append([]byte(nil), tests[0].input...)
+	if err := vm.CalculateCommitmentFirst(input); err != nil {
+		t.Fatal(err)
+	}
+	input = append(input[:0], tests[1].input...)
+	if err := vm.CalculateCommitmentNext(input, &outputHash[0], &outputCommitment[0]); err != nil {
+		t.Fatal(err)
+	}
+	input = append(input[:0], tests[2].input...)
+	if err := vm.CalculateCommitmentNext(input, &outputHash[1], &outputCommitment[1]); err != nil {
+		t.Fatal(err)
+	}
+	clear(input)
+	if err := vm.CalculateCommitmentLast(&outputHash[2], &outputCommitment[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.CalculateCommitmentLast(&hash, &commitment); !errors.Is(err, ErrNoPendingHash) {
+		t.Fatalf("expected ErrNoPendingHash, got %v", err)
+	}
+
+	// plain hashes replace the pending commitment input
+	if err := vm.CalculateCommitmentFirst(tests[0].input); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CalculateHashNext(tests[1].input, &hash); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.CalculateCommitmentLast(&hash, &commitment); !errors.Is(err, ErrNoPendingHash) {
+		t.Fatalf("expected ErrNoPendingHash, got %v", err)
+	}
+	if err := vm.CalculateHashLast(&hash); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range tests {
+		if outputHex := hex.EncodeToString(outputHash[i][:]); outputHex != test.expected {
+			t.Errorf("input=%v: expected=%s, actual=%s", test.input, test.expected, outputHex)
+		}
+
+		if err := vm.CalculateCommitment(test.input, &hash, &commitment); err != nil {
+			t.Fatal(err)
+		}
+		if hash != outputHash[i] || commitment != outputCommitment[i] {
+			t.Errorf("input=%v: batch and single results differ", test.input)
+		}
+
+		if !VerifyCommitment(test.input, &outputHash[i], &outputCommitment[i]) {
+			t.Errorf("input=%v: commitment not verified", test.input)
+		}
+	}
+
+	if hex.EncodeToString(outputCommitment[0][:]) != "d53ccf348b75291b7be76f0a7ac8208bbced734b912f6fca60539ab6f86be919" {
+		t.Errorf("unexpected commitment %x", outputCommitment[0])
+	}
+
+	if VerifyCommitment(tests[1].input, &outputHash[0], &outputCommitment[0]) {
+		t.Error("commitment verified for wrong input")
+	}
+	if VerifyCommitment(tests[0].input, &outputHash[1], &outputCommitment[0]) {
+		t.Error("commitment verified for wrong hash")
+	}
+}
@@ -30,11 +30,15 @@ USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 package randomx
 
 import (
+	"errors"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/aes"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/argon2"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/keys"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
 )
 
 // see reference configuration.h
+// The constants below describe the default Monero configuration, see ConfigMonero
 // Cache size in KiB. Must be a power of 2.
 const RANDOMX_ARGON_MEMORY = 262144
 
@@ -115,6 +119,369 @@ func isZeroOrPowerOf2(x uint32) bool {
 	return (x & (x - 1)) == 0
 }
 
+// InstructionFrequencies Number of opcodes assigned to each instruction type. Must sum up to 256.
+// See reference configuration.h RANDOMX_FREQ_*
+type InstructionFrequencies struct {
+	IADD_RS  uint32
+	IADD_M   uint32
+	ISUB_R   uint32
+	ISUB_M   uint32
+	IMUL_R   uint32
+	IMUL_M   uint32
+	IMULH_R  uint32
+	IMULH_M  uint32
+	ISMULH_R uint32
+	ISMULH_M uint32
+	IMUL_RCP uint32
+	INEG_R   uint32
+	IXOR_R   uint32
+	IXOR_M   uint32
+	IROR_R   uint32
+	IROL_R   uint32
+	ISWAP_R  uint32
+	FSWAP_R  uint32
+	FADD_R   uint32
+	FADD_M   uint32
+	FSUB_R   uint32
+	FSUB_M   uint32
+	FSCAL_R  uint32
+	FMUL_R   uint32
+	FDIV_M   uint32
+	FSQRT_R  uint32
+	CBRANCH  uint32
+	CFROUND  uint32
+	ISTORE   uint32
+	NOP      uint32
+}
+
+// instructionType Instruction types in the same order as InstructionFrequencies
+type instructionType uint8
+
+const (
+	instrIADD_RS = instructionType(iota)
+	instrIADD_M
+	instrISUB_R
+	instrISUB_M
+	instrIMUL_R
+	instrIMUL_M
+	instrIMULH_R
+	instrIMULH_M
+	instrISMULH_R
+	instrISMULH_M
+	instrIMUL_RCP
+	instrINEG_R
+	instrIXOR_R
+	instrIXOR_M
+	instrIROR_R
+	instrIROL_R
+	instrISWAP_R
+	instrFSWAP_R
+	instrFADD_R
+	instrFADD_M
+	instrFSUB_R
+	instrFSUB_M
+	instrFSCAL_R
+	instrFMUL_R
+	instrFDIV_M
+	instrFSQRT_R
+	instrCBRANCH
+	instrCFROUND
+	instrISTORE
+	instrNOP
+)
+
+func (f InstructionFrequencies) slice() []uint32 {
+	return []uint32{
+		f.IADD_RS, f.IADD_M, f.ISUB_R, f.ISUB_M, f.IMUL_R, f.IMUL_M, f.IMULH_R, f.IMULH_M, f.ISMULH_R, f.ISMULH_M,
+		f.IMUL_RCP, f.INEG_R, f.IXOR_R, f.IXOR_M, f.IROR_R, f.IROL_R, f.ISWAP_R, f.FSWAP_R, f.FADD_R, f.FADD_M,
+		f.FSUB_R, f.FSUB_M, f.FSCAL_R, f.FMUL_R, f.FDIV_M, f.FSQRT_R, f.CBRANCH, f.CFROUND, f.ISTORE, f.NOP,
+	}
+}
+
+// Config Runtime RandomX algorithm parameters, see reference configuration.h
+// Use one of the provided presets, or copy one and modify it for custom or test configurations.
+type Config struct {
+	// ArgonMemory Cache size in KiB. Must be a power of 2.
+	ArgonMemory uint32
+	// ArgonIterations Number of Argon2d iterations for Cache initialization.
+	ArgonIterations uint32
+	// ArgonLanes Number of parallel lanes for Cache initialization.
+	ArgonLanes uint32
+	// ArgonSalt Argon2d salt. Must be at least 8 bytes long.
+	ArgonSalt string
+
+	// CacheAccesses Number of random Cache accesses per Dataset item. Minimum is 2.
+	CacheAccesses uint32
+	// SuperscalarLatency Target latency for SuperscalarHash (in cycles of the reference CPU).
+	SuperscalarLatency uint32
+
+	// DatasetBaseSize Dataset base size in bytes. Must be a power of 2.
+	DatasetBaseSize uint64
+	// DatasetExtraSize Dataset extra size. Must be divisible by 64.
+	DatasetExtraSize uint64
+
+	// ProgramSize Number of instructions in a RandomX program. Must be divisible by 8.
+	ProgramSize uint32
+	// ProgramIterations Number of iterations during VM execution.
+	ProgramIterations uint32
+	// ProgramCount Number of chained VM executions per hash.
+	ProgramCount uint32
+
+	// ScratchpadL3 Scratchpad L3 size in bytes. Must be a power of 2.
+	ScratchpadL3 uint32
+	// ScratchpadL2 Scratchpad L2 size in bytes. Must be a power of two and less than or equal to ScratchpadL3.
+	ScratchpadL2 uint32
+	// ScratchpadL1 Scratchpad L1 size in bytes. Must be a power of two (minimum 64) and less than or equal to ScratchpadL2.
+	ScratchpadL1 uint32
+
+	// JumpBits Jump condition mask size in bits.
+	JumpBits uint32
+	// JumpOffset Jump condition mask offset in bits. The sum of JumpBits and JumpOffset must not exceed 16.
+	JumpOffset uint32
+
+	// Frequencies Instruction frequencies
+	Frequencies InstructionFrequencies
+
+	// AesGenerator4RKeys Keys used by AesGenerator4R to generate programs.
+	// Keys 0-3 are used for columns 0 and 1, keys 4-7 for columns 2 and 3.
+	AesGenerator4RKeys [8][4]uint32
+}
+
+// ConfigMonero RandomX as used by Monero and the reference implementation
+var ConfigMonero = Config{
+	ArgonMemory:     RANDOMX_ARGON_MEMORY,
+	ArgonIterations: RANDOMX_ARGON_ITERATIONS,
+	ArgonLanes:      RANDOMX_ARGON_LANES,
+	ArgonSalt:       RANDOMX_ARGON_SALT,
+
+	CacheAccesses:      RANDOMX_CACHE_ACCESSES,
+	SuperscalarLatency: RANDOMX_SUPERSCALAR_LATENCY,
+
+	DatasetBaseSize:  RANDOMX_DATASET_BASE_SIZE,
+	DatasetExtraSize: RANDOMX_DATASET_EXTRA_SIZE,
+
+	ProgramSize:       RANDOMX_PROGRAM_SIZE,
+	ProgramIterations: RANDOMX_PROGRAM_ITERATIONS,
+	ProgramCount:      RANDOMX_PROGRAM_COUNT,
+
+	ScratchpadL3: RANDOMX_SCRATCHPAD_L3,
+	ScratchpadL2: RANDOMX_SCRATCHPAD_L2,
+	ScratchpadL1: RANDOMX_SCRATCHPAD_L1,
+
+	JumpBits:   RANDOMX_JUMP_BITS,
+	JumpOffset: RANDOMX_JUMP_OFFSET,
+
+	Frequencies: InstructionFrequencies{
+		IADD_RS:  16,
+		IADD_M:   7,
+		ISUB_R:   16,
+		ISUB_M:   7,
+		IMUL_R:   16,
+		IMUL_M:   4,
+		IMULH_R:  4,
+		IMULH_M:  1,
+		ISMULH_R: 4,
+		ISMULH_M: 1,
+		IMUL_RCP: 8,
+		INEG_R:   2,
+		IXOR_R:   15,
+		IXOR_M:   5,
+		IROR_R:   8,
+		IROL_R:   2,
+		ISWAP_R:  4,
+		FSWAP_R:  4,
+		FADD_R:   16,
+		FADD_M:   5,
+		FSUB_R:   16,
+		FSUB_M:   5,
+		FSCAL_R:  6,
+		FMUL_R:   32,
+		FDIV_M:   4,
+		FSQRT_R:  6,
+		CBRANCH:  25,
+		CFROUND:  1,
+		ISTORE:   16,
+		NOP:      0,
+	},
+
+	AesGenerator4RKeys: keys.AesGenerator4R_Keys,
+}
+
+// Validate Checks the configuration values, same as reference configuration.h static asserts
+func (c Config) Validate() error {
+	if c.ArgonMemory < 8 {
+		return errors.New("ArgonMemory must be at least 8")
+	}
+	if !isZeroOrPowerOf2(c.ArgonMemory) {
+		return errors.New("ArgonMemory must be a power of 2")
+	}
+	if c.ArgonIterations == 0 || c.ArgonIterations == 0xffffffff {
+		return errors.New("ArgonIterations must be a positive 32-bit integer")
+	}
+	if c.ArgonLanes == 0 || c.ArgonLanes > 0xff {
+		return errors.New("ArgonLanes out of range")
+	}
+	if c.ArgonMemory < 8*c.ArgonLanes {
+		return errors.New("ArgonMemory must be at least 8 times ArgonLanes")
+	}
+	if len(c.ArgonSalt) < 8 {
+		return errors.New("ArgonSalt must be at least 8 characters long")
+	}
+
+	if c.CacheAccesses < 2 {
+		return errors.New("CacheAccesses must be greater than 1")
+	}
+	if c.SuperscalarLatency == 0 {
+		return errors.New("SuperscalarLatency must be greater than 0")
+	}
+	if c.SuperscalarLatency > 10000 {
+		return errors.New("SuperscalarLatency must not exceed 10000")
+	}
+
+	if c.DatasetBaseSize < 64 {
+		return errors.New("DatasetBaseSize must be at least 64")
+	}
+	if c.DatasetBaseSize&(c.DatasetBaseSize-1) != 0 {
+		return errors.New("DatasetBaseSize must be a power of 2")
+	}
+	if c.DatasetBaseSize > 4294967296 {
+		return errors.New("DatasetBaseSize must not exceed 4294967296")
+	}
+	if c.DatasetExtraSize%64 != 0 {
+		return errors.New("DatasetExtraSize must be divisible by 64")
+	}
+	if c.DatasetBaseSize+c.DatasetExtraSize > 17179869184 {
+		return errors.New("dataset size must not exceed 16 GiB")
+	}
+
+	if c.ProgramSize == 0 {
+		return errors.New("ProgramSize must be greater than 0")
+	}
+	if c.ProgramSize > 32768 {
+		return errors.New("ProgramSize must not exceed 32768")
+	}
+	if c.ProgramSize%8 != 0 {
+		return errors.New("ProgramSize must be divisible by 8")
+	}
+	if c.ProgramIterations == 0 {
+		return errors.New("ProgramIterations must be greater than 0")
+	}
+	if c.ProgramCount == 0 {
+		return errors.New("ProgramCount must be greater than 0")
+	}
+
+	if !isZeroOrPowerOf2(c.ScratchpadL3) {
+		return errors.New("ScratchpadL3 must be a power of 2")
+	}
+	if c.ScratchpadL3 < c.ScratchpadL2 {
+		return errors.New("ScratchpadL3 must be greater than or equal to ScratchpadL2")
+	}
+	if !isZeroOrPowerOf2(c.ScratchpadL2) {
+		return errors.New("ScratchpadL2 must be a power of 2")
+	}
+	if c.ScratchpadL2 < c.ScratchpadL1 {
+		return errors.New("ScratchpadL2 must be greater than or equal to ScratchpadL1")
+	}
+	if c.ScratchpadL1 < 64 {
+		return errors.New("ScratchpadL1 must be at least 64")
+	}
+	if !isZeroOrPowerOf2(c.ScratchpadL1) {
+		return errors.New("ScratchpadL1 must be a power of 2")
+	}
+
+	if c.JumpBits == 0 {
+		return errors.New("JumpBits must be greater than 0")
+	}
+	if c.JumpBits+c.JumpOffset > 16 {
+		return errors.New("JumpBits + JumpOffset must not exceed 16")
+	}
+
+	var sum uint32
+	for _, f := range c.Frequencies.slice() {
+		sum += f
+	}
+	if sum != 256 {
+		return errors.New("sum of instruction frequencies must be 256")
+	}
+
+	return nil
+}
+
+// params Validated Config along with values derived from it
+type params struct {
+	Config
+
+	cacheSize uint64
+	cacheMask uint64
+
+	datasetSize       uint64
+	datasetItemCount  uint64
+	datasetExtraItems uint64
+
+	cacheLineAlignMask uint64
+
+	superscalarMaxSize int
+
+	scratchpadL1Mask   uint32
+	scratchpadL2Mask   uint32
+	scratchpadL3Mask   uint32
+	scratchpadL3Mask64 uint32
+
+	conditionMask uint32
+
+	opcodes [256]instructionType
+
+	fillAes4Rx4Keys aes.FillAes4Rx4Keys
+}
+
+func (c Config) params() (*params, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &params{
+		Config: c,
+
+		cacheSize: uint64(c.ArgonMemory) * uint64(argon2.BlockSize),
+
+		datasetSize: c.DatasetBaseSize + c.DatasetExtraSize,
+
+		cacheLineAlignMask: (c.DatasetBaseSize - 1) & (^(CacheLineSize - 1)),
+
+		superscalarMaxSize: 3*int(c.SuperscalarLatency) + 2,
+
+		scratchpadL1Mask:   (c.ScratchpadL1/8 - 1) * 8,
+		scratchpadL2Mask:   (c.ScratchpadL2/8 - 1) * 8,
+		scratchpadL3Mask:   (c.ScratchpadL3/8 - 1) * 8,
+		scratchpadL3Mask64: (c.ScratchpadL3/64 - 1) * 64,
+
+		conditionMask: (1 << c.JumpBits) - 1,
+
+		fillAes4Rx4Keys: aes.NewFillAes4Rx4Keys(&c.AesGenerator4RKeys),
+	}
+	p.cacheMask = p.cacheSize/CacheLineSize - 1
+	p.datasetItemCount = p.datasetSize / CacheLineSize
+	p.datasetExtraItems = c.DatasetExtraSize / RANDOMX_DATASET_ITEM_SIZE
+
+	var opcode int
+	for instr, frequency := range c.Frequencies.slice() {
+		for i := uint32(0); i < frequency; i++ {
+			p.opcodes[opcode] = instructionType(instr)
+			opcode++
+		}
+	}
+
+	return p, nil
+}
+
+var defaultParams = func() *params {
+	p, err := ConfigMonero.params()
+	if err != nil {
+		panic(err)
+	}
+	return p
+}()
+
 var largePageAllocator = memory.NewLargePageAllocator()
 var pageAllocator = memory.NewPageAllocator()
 var cacheLineAlignedAllocator = memory.NewAlignedAllocator(CacheLineSize)
@@ -0,0 +1,184 @@
+package randomx
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// testConfig Small configuration used to exercise light and full mode quickly
+var testConfig = func() Config {
+	c := ConfigMonero
+	c.ArgonMemory = 256
+	c.ArgonSalt = "RandomX\x03test"
+	c.DatasetBaseSize = 1 << 20
+	c.DatasetExtraSize = 64 * 7
+	c.ProgramSize = 64
+	c.ProgramIterations = 128
+	c.ProgramCount = 4
+	c.ScratchpadL3 = 1 << 16
+	c.ScratchpadL2 = 1 << 14
+	c.ScratchpadL1 = 1 << 12
+	return c
+}()
+
+func Test_Config_Presets(t *testing.T) {
+	t.Parallel()
+
+	for name, c := range map[string]Config{
+		"monero": ConfigMonero,
+		"test":   testConfig,
+	} {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func Test_Config_Validate(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{"ArgonMemory", func(c *Config) { c.ArgonMemory = 3 }},
+		{"ArgonMemoryPow2", func(c *Config) { c.ArgonMemory = 262143 }},
+		{"ArgonIterations", func(c *Config) { c.ArgonIterations = 0 }},
+		{"ArgonLanes", func(c *Config) { c.ArgonLanes = 0 }},
+		{"ArgonSalt", func(c *Config) { c.ArgonSalt = "short" }},
+		{"CacheAccesses", func(c *Config) { c.CacheAccesses = 1 }},
+		{"SuperscalarLatency", func(c *Config) { c.SuperscalarLatency = 0 }},
+		{"DatasetBaseSize", func(c *Config) { c.DatasetBaseSize = 1000 }},
+		{"DatasetExtraSize", func(c *Config) { c.DatasetExtraSize = 63 }},
+		{"ProgramSize", func(c *Config) { c.ProgramSize = 257 }},
+		{"ProgramIterations", func(c *Config) { c.ProgramIterations = 0 }},
+		{"ProgramCount", func(c *Config) { c.ProgramCount = 0 }},
+		{"ScratchpadL3", func(c *Config) { c.ScratchpadL3 = 3 << 20 }},
+		{"ScratchpadL2", func(c *Config) { c.ScratchpadL2 = c.ScratchpadL3 * 2 }},
+		{"ScratchpadL1", func(c *Config) { c.ScratchpadL1 = 32 }},
+		{"JumpBits", func(c *Config) { c.JumpBits = 9 }},
+		{"Frequencies", func(c *Config) { c.Frequencies.NOP = 1 }},
+	}
+
+	for _, tt := range tests {
+		c := ConfigMonero
+		tt.modify(&c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+		if _, err := NewCacheWithConfig(0, c); err == nil {
+			t.Errorf("%s: expected NewCacheWithConfig error", tt.name)
+		}
+	}
+}
+
+func Test_Config_Monero(t *testing.T) {
+	t.Parallel()
+
+	c, err := NewCacheWithConfig(GetFlags(), ConfigMonero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	test := Tests[0]
+	if err := c.Init(test.key); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(GetFlags(), c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var outputHash [RANDOMX_HASH_SIZE]byte
+	if err := vm.CalculateHash(test.input, &outputHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if outputHex := hex.EncodeToString(outputHash[:]); outputHex != test.expected {
+		t.Errorf("expected=%s, actual=%s", test.expected, outputHex)
+	}
+}
+
+// Test_Config_Consistency All VM modes must agree on hashes for a non-default configuration
+func Test_Config_Consistency(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("test key 000")
+	inputs := [][]byte{
+		[]byte("This is a test"),
+		[]byte("Lorem ipsum dolor sit amet"),
+		[]byte("sed do eiusmod tempor incididunt ut labore et dolore magna aliqua"),
+	}
+
+	hashes := make(map[string][][RANDOMX_HASH_SIZE]byte)
+
+	for _, n := range []string{"interpreter", "compiler"} {
+		for _, full := range []bool{false, true} {
+			var baseFlags Flags
+			mode := n + "/light"
+			if full {
+				baseFlags = RANDOMX_FLAG_FULL_MEM
+				mode = n + "/full"
+			}
+			tFlags, skip := testFlags(n, baseFlags)
+			if skip {
+				continue
+			}
+
+			cache, err := NewCacheWithConfig(tFlags, testConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Init(key); err != nil {
+				t.Fatal(err)
+			}
+
+			var dataset *Dataset
+			if full {
+				dataset, err = NewDatasetWithConfig(tFlags, testConfig)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := dataset.InitDatasetParallel(cache, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			vm, err := NewVM(tFlags, cache, dataset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result := make([][RANDOMX_HASH_SIZE]byte, len(inputs))
+			for i, input := range inputs {
+				if err := vm.CalculateHash(input, &result[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			hashes[mode] = result
+
+			vm.Close()
+			if dataset != nil {
+				dataset.Close()
+			}
+			cache.Close()
+		}
+	}
+
+	reference := hashes["interpreter/light"]
+	for mode, result := range hashes {
+		for i := range result {
+			if result[i] != reference[i] {
+				t.Errorf("%s: input %d: expected=%x, actual=%x", mode, i, reference[i], result[i])
+			}
+		}
+	}
+
+	// a different configuration must not produce Monero hashes
+	if hex.EncodeToString(reference[0][:]) == Tests[1].expected {
+		t.Errorf("test configuration produced default configuration hash")
+	}
+}
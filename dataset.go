@@ -1,9 +1,13 @@
 package randomx
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/asm"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
-	"sync"
+	"sync/atomic"
+	"unsafe"
 )
 
 const DatasetSize = RANDOMX_DATASET_BASE_SIZE + RANDOMX_DATASET_EXTRA_SIZE
@@ -13,12 +17,37 @@ const DatasetItemCount = DatasetSize / CacheLineSize
 type Dataset struct {
 	memory []RegisterLine
 	flags  Flags
+	config *params
+
+	// complete set when all items have been initialized via InitDatasetParallel or InitDatasetContext
+	complete atomic.Bool
+	// key Cache key the Dataset was completely initialized with
+	key []byte
+
+	// mapping read-only file mapping backing memory, see NewDatasetFromFile
+	mapping       []byte
+	fileAllocator memory.Allocator
+
+	closed atomic.Bool
 }
 
 // NewDataset Creates a randomx_dataset structure and allocates memory for RandomX Dataset.
 // Only one flag is supported (can be set or not set): RANDOMX_FLAG_LARGE_PAGES - allocate memory in large pages
 // Returns nil if allocation fails
 func NewDataset(flags Flags) (result *Dataset, err error) {
+	return newDataset(flags, defaultParams)
+}
+
+// NewDatasetWithConfig Same as NewDataset, using the RandomX parameters in config instead of ConfigMonero
+func NewDatasetWithConfig(flags Flags, config Config) (result *Dataset, err error) {
+	p, err := config.params()
+	if err != nil {
+		return nil, err
+	}
+	return newDataset(flags, p)
+}
+
+func newDataset(flags Flags, config *params) (result *Dataset, err error) {
 	defer func() {
 		//catch too large memory allocation or unable to allocate, for example on 32-bit targets or out of memory
 		if r := recover(); r != nil {
@@ -37,12 +66,12 @@ func NewDataset(flags Flags) (result *Dataset, err error) {
 		if largePageAllocator == nil {
 			return nil, errors.New("huge pages not supported")
 		}
-		alignedMemory, err = memory.AllocateSlice[RegisterLine](largePageAllocator, DatasetItemCount)
+		alignedMemory, err = memory.AllocateSlice[RegisterLine](largePageAllocator, config.datasetItemCount)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		alignedMemory, err = memory.AllocateSlice[RegisterLine](cacheLineAlignedAllocator, DatasetItemCount)
+		alignedMemory, err = memory.AllocateSlice[RegisterLine](cacheLineAlignedAllocator, config.datasetItemCount)
 
 		if err != nil {
 			return nil, err
@@ -52,11 +81,17 @@ func NewDataset(flags Flags) (result *Dataset, err error) {
 	return &Dataset{
 		memory: alignedMemory,
 		flags:  flags,
+		config: config,
 	}, nil
 }
 
-func (d *Dataset) prefetchDataset(address uint64) {
+// Config Returns the RandomX parameters this Dataset was created with
+func (d *Dataset) Config() Config {
+	return d.config.Config
+}
 
+func (d *Dataset) prefetchDataset(address uint64) {
+	asm.PrefetchNTA(unsafe.Pointer(&d.memory[address/CacheLineSize]))
 }
 
 func (d *Dataset) readDataset(address uint64, r *RegisterLine) {
@@ -68,22 +103,62 @@ func (d *Dataset) readDataset(address uint64, r *RegisterLine) {
 }
 
 // Memory Returns a pointer to the internal memory buffer of the dataset structure.
-// The size of the internal memory buffer is DatasetItemCount * RANDOMX_DATASET_ITEM_SIZE.
+// The size of the internal memory buffer is DatasetItemCount * RANDOMX_DATASET_ITEM_SIZE for the default configuration.
+// The buffer is read-only for Datasets created via NewDatasetFromFile.
 func (d *Dataset) Memory() []RegisterLine {
 	return d.memory
 }
 
-func (d *Dataset) InitDataset(cache *Cache, startItem, itemCount uint64) {
-	if startItem >= DatasetItemCount || itemCount > DatasetItemCount {
-		panic("out of range")
+// InitDataset Initializes itemCount Dataset items starting at startItem.
+// Items initialized this way are not tracked by Complete, and the Dataset is marked incomplete.
+func (d *Dataset) InitDataset(cache *Cache, startItem, itemCount uint64) error {
+	if err := d.checkInit(cache); err != nil {
+		return err
+	}
+	if startItem >= d.config.datasetItemCount || itemCount > d.config.datasetItemCount {
+		return ErrOutOfRange
 	}
-	if startItem+itemCount > DatasetItemCount {
-		panic("out of range")
+	if startItem+itemCount > d.config.datasetItemCount {
+		return ErrOutOfRange
+	}
+
+	// contents may now come from another key, only one concurrent caller sees it complete
+	if d.complete.Swap(false) {
+		d.key = nil
 	}
+
 	cache.datasetInit(d.memory[startItem:startItem+itemCount], startItem, startItem+itemCount)
+	return nil
 }
 
+// checkInit Verifies the Dataset can be initialized from cache
+func (d *Dataset) checkInit(cache *Cache) error {
+	if d.closed.Load() || cache.closed.Load() {
+		return ErrClosed
+	}
+	if d.mapping != nil {
+		return ErrReadOnly
+	}
+	if cache.config.Config != d.config.Config {
+		return ErrConfigMismatch
+	}
+	if cache.key == nil {
+		return ErrNotInitialized
+	}
+	return nil
+}
+
+// Close Releases all memory occupied by the Dataset structure.
+// Returns ErrClosed if called more than once.
 func (d *Dataset) Close() error {
+	if d.closed.Swap(true) {
+		return ErrClosed
+	}
+	d.complete.Store(false)
+
+	if d.mapping != nil {
+		return d.fileAllocator.FreeMemory(d.mapping)
+	}
 	if d.flags.Has(RANDOMX_FLAG_LARGE_PAGES) {
 		return memory.FreeSlice(largePageAllocator, d.memory)
 	} else {
@@ -91,21 +166,47 @@ func (d *Dataset) Close() error {
 	}
 }
 
-func (d *Dataset) InitDatasetParallel(cache *Cache, n int) {
-	n = max(1, n)
+// InitDatasetParallel Initializes the whole Dataset using n goroutines.
+func (d *Dataset) InitDatasetParallel(cache *Cache, n int) error {
+	return d.InitDatasetContext(context.Background(), cache, 0, d.config.datasetItemCount, n, nil)
+}
 
-	var wg sync.WaitGroup
-	for i := uint64(1); i < uint64(n); i++ {
-		a := (DatasetItemCount * i) / uint64(n)
-		b := (DatasetItemCount * (i + 1)) / uint64(n)
+// InitDatasetContext Initializes itemCount Dataset items starting at startItem using n goroutines.
+// The Dataset is marked incomplete until the whole Dataset has been initialized by a successful call, see Complete.
+// progress, if not nil, is called with the number of items initialized so far. Calls are serialized, but happen on worker goroutines.
+// Returns ctx.Err() if ctx is cancelled before all items are initialized.
+func (d *Dataset) InitDatasetContext(ctx context.Context, cache *Cache, startItem, itemCount uint64, n int, progress func(itemsDone uint64)) error {
+	if err := d.checkInit(cache); err != nil {
+		return err
+	}
+	if startItem > d.config.datasetItemCount || itemCount > d.config.datasetItemCount-startItem {
+		return ErrOutOfRange
+	}
 
-		wg.Add(1)
-		go func(a, b uint64) {
-			defer wg.Done()
-			d.InitDataset(cache, a, b-a)
-		}(a, b)
+	d.complete.Store(false)
+
+	if err := cache.datasetInitContext(ctx, d.memory[startItem:startItem+itemCount], startItem, n, progress); err != nil {
+		return err
+	}
+
+	if startItem == 0 && itemCount == d.config.datasetItemCount {
+		d.key = cache.Key()
+		d.complete.Store(true)
+	}
+
+	return nil
+}
+
+// Key Returns the key of the Cache the Dataset was completely initialized from, or nil if not complete.
+func (d *Dataset) Key() []byte {
+	if !d.Complete() {
+		return nil
 	}
+	return bytes.Clone(d.key)
+}
 
-	d.InitDataset(cache, 0, DatasetItemCount/uint64(n))
-	wg.Wait()
+// Complete Returns whether the whole Dataset was initialized by the last InitDatasetParallel or InitDatasetContext call.
+// Items initialized via InitDataset are not tracked, and mark the Dataset incomplete.
+func (d *Dataset) Complete() bool {
+	return d.complete.Load()
 }
@@ -0,0 +1,121 @@
+package randomx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func Test_Dataset_InitDatasetContext(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	dataset, err := NewDatasetWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dataset.Close()
+
+	itemCount := uint64(len(dataset.Memory()))
+
+	if err = dataset.InitDatasetContext(context.Background(), cache, 0, itemCount, 2, nil); err == nil {
+		t.Fatal("expected error with uninitialized cache")
+	}
+
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		if err := dataset.InitDatasetContext(context.Background(), cache, itemCount, 1, 1, nil); err == nil {
+			t.Error("expected out of range error")
+		}
+		if err := dataset.InitDatasetContext(context.Background(), cache, 1, itemCount, 1, nil); err == nil {
+			t.Error("expected out of range error")
+		}
+
+		otherCache, err := NewCache(GetFlags())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer otherCache.Close()
+		if err := dataset.InitDatasetContext(context.Background(), otherCache, 0, itemCount, 1, nil); err == nil {
+			t.Error("expected config mismatch error")
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var reports int
+		err := dataset.InitDatasetContext(ctx, cache, 0, itemCount, 2, func(itemsDone uint64) {
+			reports++
+			cancel()
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+		if reports == 0 || reports > 2 {
+			t.Errorf("expected cancellation to stop workers promptly, got %d reports", reports)
+		}
+		if dataset.Complete() {
+			t.Error("cancelled dataset marked complete")
+		}
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		var last uint64
+		err := dataset.InitDatasetContext(context.Background(), cache, 0, itemCount, 2, func(itemsDone uint64) {
+			if itemsDone <= last {
+				t.Errorf("progress went backwards: %d -> %d", last, itemsDone)
+			}
+			last = itemsDone
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != itemCount {
+			t.Errorf("expected final progress %d, got %d", itemCount, last)
+		}
+		if !dataset.Complete() {
+			t.Error("dataset not marked complete")
+		}
+
+		var item RegisterLine
+		for _, i := range []uint64{0, 1, itemCount / 2, itemCount - 1} {
+			cache.initDataset(&item, i)
+			if item != dataset.Memory()[i] {
+				t.Errorf("item %d mismatch", i)
+			}
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		if err := dataset.InitDatasetParallel(cache, 1); err != nil {
+			t.Fatal(err)
+		}
+		if !dataset.Complete() {
+			t.Fatal("dataset not marked complete")
+		}
+
+		// part of the contents now comes from another key
+		if err := cache.Init(Tests[4].key); err != nil {
+			t.Fatal(err)
+		}
+		if err := dataset.InitDataset(cache, 0, 1); err != nil {
+			t.Fatal(err)
+		}
+		if dataset.Complete() || dataset.Key() != nil {
+			t.Error("partially re-initialized dataset marked complete")
+		}
+		if err := dataset.Save(io.Discard); err == nil {
+			t.Error("expected error saving incomplete dataset")
+		}
+	})
+}
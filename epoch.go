@@ -0,0 +1,369 @@
+package randomx
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// SeedHashEpochBlocks Number of blocks between RandomX key changes in Monero
+const SeedHashEpochBlocks = 2048
+
+// SeedHashEpochLag Number of blocks after a seed block before its hash is used as RandomX key in Monero
+const SeedHashEpochLag = 64
+
+// SeedHeight Returns the height of the block whose hash is the RandomX key at the given chain height.
+// See Monero rx_seedheight
+func SeedHeight(height uint64) uint64 {
+	if height <= SeedHashEpochBlocks+SeedHashEpochLag {
+		return 0
+	}
+	return (height - SeedHashEpochLag - 1) &^ (SeedHashEpochBlocks - 1)
+}
+
+// NextSeedHeight Returns the seed height that will be in use SeedHashEpochLag blocks after the given chain height.
+// When it differs from SeedHeight, the next key is already known and can be prepared in advance.
+// See Monero rx_seedheights
+func NextSeedHeight(height uint64) uint64 {
+	return SeedHeight(height + SeedHashEpochLag)
+}
+
+// epoch Cache and optional Dataset for a single key
+type epoch struct {
+	key string
+
+	cache   *Cache
+	dataset *Dataset
+
+	// ready closed when cache and dataset are initialized or err is set
+	ready chan struct{}
+	err   error
+	// cancel aborts Dataset initialization
+	cancel context.CancelFunc
+
+	// refs number of VMs handed out via EpochManager.Get bound to this epoch
+	refs    int
+	retired bool
+	freed   bool
+}
+
+func (e *epoch) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *epoch) close() {
+	if e.dataset != nil {
+		_ = e.dataset.Close()
+	}
+	if e.cache != nil {
+		_ = e.cache.Close()
+	}
+}
+
+// EpochManager Keeps the Cache (and Dataset in full mode) for the current and next RandomX key ready.
+// The next key is prepared in the background, and VMs obtained via Get are switched over when the key changes.
+// Memory of previous keys is released once no VM obtained via Get references it.
+// EpochManager is safe for concurrent use.
+type EpochManager struct {
+	flags   Flags
+	config  *params
+	threads int
+
+	lock sync.Mutex
+
+	current *epoch
+	next    *epoch
+	// pending epoch most recently requested via Update, not yet current
+	pending *epoch
+
+	// vms VMs handed out via Get along with the epoch they are bound to
+	vms map[*VM]*epoch
+	// free VMs returned via Put, always bound to current
+	free []*VM
+
+	closed bool
+}
+
+// NewEpochManager Creates an EpochManager using ConfigMonero, see NewEpochManagerWithConfig
+func NewEpochManager(flags Flags, threads int) *EpochManager {
+	return newEpochManager(flags, defaultParams, threads)
+}
+
+// NewEpochManagerWithConfig Creates an EpochManager using the given RandomX parameters.
+// If flags contain RANDOMX_FLAG_FULL_MEM a Dataset is initialized for each key using threads goroutines.
+func NewEpochManagerWithConfig(flags Flags, config Config, threads int) (*EpochManager, error) {
+	p, err := config.params()
+	if err != nil {
+		return nil, err
+	}
+	return newEpochManager(flags, p, threads), nil
+}
+
+func newEpochManager(flags Flags, config *params, threads int) *EpochManager {
+	return &EpochManager{
+		flags:   flags,
+		config:  config,
+		threads: max(1, threads),
+		vms:     make(map[*VM]*epoch),
+	}
+}
+
+// newEpoch Starts initialization of a new epoch in the background. Lock must be held.
+func (m *EpochManager) newEpoch(key []byte) *epoch {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e := &epoch{
+		key:    string(key),
+		ready:  make(chan struct{}),
+		cancel: cancel,
+	}
+
+	go func() {
+		defer close(e.ready)
+		defer cancel()
+
+		cache, err := newCache(m.flags, m.config)
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.cache = cache
+		if err = cache.Init(key); err != nil {
+			e.err = err
+			return
+		}
+
+		if m.flags.Has(RANDOMX_FLAG_FULL_MEM) {
+			dataset, err := newDataset(m.flags, m.config)
+			if err != nil {
+				e.err = err
+				return
+			}
+			e.dataset = dataset
+			if err = dataset.InitDatasetContext(ctx, cache, 0, m.config.datasetItemCount, m.threads, nil); err != nil {
+				e.err = err
+				return
+			}
+		}
+	}()
+
+	return e
+}
+
+// retire Marks an epoch as no longer in use by the manager, and frees it if no VM references it. Lock must be held.
+func (m *EpochManager) retire(e *epoch) {
+	if e == nil {
+		return
+	}
+	e.retired = true
+	m.release(e)
+}
+
+// release Frees a retired epoch that is not referenced anymore. Lock must be held.
+func (m *EpochManager) release(e *epoch) {
+	if !e.retired || e.refs > 0 || e.freed {
+		return
+	}
+	e.freed = true
+
+	// abort initialization if still in progress
+	e.cancel()
+
+	if e.isReady() {
+		e.close()
+	} else {
+		go func() {
+			<-e.ready
+			e.close()
+		}()
+	}
+}
+
+// bind Switches a VM over to epoch e. Lock must be held.
+func (m *EpochManager) bind(vm *VM, e *epoch) error {
+	if m.flags.Has(RANDOMX_FLAG_FULL_MEM) {
+		return vm.SetDataset(e.dataset)
+	} else {
+		return vm.SetCache(e.cache)
+	}
+}
+
+// Update Sets the RandomX key for the given chain height and waits until it is ready.
+// seedHash must be the hash of the block at SeedHeight(height).
+// nextSeedHash is the hash of the block at NextSeedHeight(height), or nil if not known yet.
+// When NextSeedHeight differs from SeedHeight, the Cache and Dataset for nextSeedHash are prepared in the background,
+// so that the Update switching to it does not block.
+func (m *EpochManager) Update(height uint64, seedHash, nextSeedHash []byte) error {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return ErrClosed
+	}
+
+	e := m.current
+	if e != nil && e.key == string(seedHash) {
+		// switching back to the current key cancels any pending switch
+		m.retire(m.pending)
+		m.pending = nil
+	} else {
+		if m.pending != nil && m.pending.key == string(seedHash) {
+			e = m.pending
+		} else {
+			if m.pending != nil {
+				m.retire(m.pending)
+			}
+			if m.next != nil && m.next.key == string(seedHash) {
+				e = m.next
+				m.next = nil
+			} else {
+				e = m.newEpoch(seedHash)
+			}
+			m.pending = e
+		}
+	}
+
+	if nextSeedHash != nil && NextSeedHeight(height) != SeedHeight(height) && string(nextSeedHash) != e.key {
+		if m.next == nil || m.next.key != string(nextSeedHash) {
+			m.retire(m.next)
+			m.next = m.newEpoch(nextSeedHash)
+		}
+	}
+	m.lock.Unlock()
+
+	<-e.ready
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e == m.current {
+		return nil
+	}
+	if m.pending != e {
+		// superseded by a later Update
+		return nil
+	}
+	m.pending = nil
+
+	if e.err != nil {
+		m.retire(e)
+		return e.err
+	}
+
+	previous := m.current
+	m.current = e
+	free := m.free[:0]
+	for _, vm := range m.free {
+		if err := m.bind(vm, e); err != nil {
+			_ = vm.Close()
+			continue
+		}
+		free = append(free, vm)
+	}
+	m.free = free
+	m.retire(previous)
+
+	return nil
+}
+
+// SeedHash Returns the current RandomX key, or nil if Update was not called yet.
+func (m *EpochManager) SeedHash() []byte {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.current == nil {
+		return nil
+	}
+	return []byte(m.current.key)
+}
+
+// Get Returns a VM bound to the current key. The VM must be returned via Put once done, and not closed directly.
+// VMs keep the key they were bound to until returned, so an in-flight hash is never computed against mixed state.
+func (m *EpochManager) Get() (*VM, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	e := m.current
+	if e == nil {
+		return nil, errors.New("no key set")
+	}
+
+	var vm *VM
+	if len(m.free) > 0 {
+		vm = m.free[len(m.free)-1]
+		m.free = m.free[:len(m.free)-1]
+	} else {
+		var err error
+		if m.flags.Has(RANDOMX_FLAG_FULL_MEM) {
+			vm, err = NewVM(m.flags, nil, e.dataset)
+		} else {
+			vm, err = NewVM(m.flags, e.cache, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.refs++
+	m.vms[vm] = e
+
+	return vm, nil
+}
+
+// Put Returns a VM obtained via Get.
+// Returns ErrUnknownVM, leaving vm untouched, if it was not obtained via Get or was already returned.
+func (m *EpochManager) Put(vm *VM) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	e, ok := m.vms[vm]
+	if !ok {
+		return ErrUnknownVM
+	}
+	delete(m.vms, vm)
+
+	if m.closed {
+		_ = vm.Close()
+	} else if e != m.current && m.bind(vm, m.current) != nil {
+		_ = vm.Close()
+	} else {
+		m.free = append(m.free, vm)
+	}
+
+	e.refs--
+	m.release(e)
+	return nil
+}
+
+// Close Releases all VMs and memory. VMs not yet returned via Put are released when returned.
+func (m *EpochManager) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	var errs []error
+	for _, vm := range m.free {
+		if err := vm.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	m.free = nil
+
+	m.retire(m.pending)
+	m.retire(m.next)
+	m.retire(m.current)
+	m.pending, m.next, m.current = nil, nil, nil
+
+	return errors.Join(errs...)
+}
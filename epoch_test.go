@@ -0,0 +1,176 @@
+package randomx
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_SeedHeight(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		height, seed, next uint64
+	}{
+		{0, 0, 0},
+		{1, 0, 0},
+		{2048, 0, 0},
+		{2048 + 64, 0, 2048},
+		{2048 + 65, 2048, 2048},
+		{4096, 2048, 2048},
+		{4096 + 1, 2048, 4096},
+		{4096 + 64, 2048, 4096},
+		{4096 + 65, 4096, 4096},
+		{3000000, 2998272, 2998272},
+	}
+
+	for _, tt := range tests {
+		if seed := SeedHeight(tt.height); seed != tt.seed {
+			t.Errorf("height=%d: expected seed=%d, actual=%d", tt.height, tt.seed, seed)
+		}
+		if next := NextSeedHeight(tt.height); next != tt.next {
+			t.Errorf("height=%d: expected next=%d, actual=%d", tt.height, tt.next, next)
+		}
+	}
+}
+
+func testEpochHash(t *testing.T, flags Flags, key, input []byte) (output [RANDOMX_HASH_SIZE]byte) {
+	cache, err := NewCacheWithConfig(flags, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err := cache.Init(key); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(flags&^RANDOMX_FLAG_FULL_MEM, cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err := vm.CalculateHash(input, &output); err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+func Test_EpochManager(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []string{"light", "full"} {
+		n := n
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			flags := GetFlags()
+			if n == "full" {
+				flags |= RANDOMX_FLAG_FULL_MEM
+			}
+
+			m, err := NewEpochManagerWithConfig(flags, testConfig, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := m.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			if _, err = m.Get(); err == nil {
+				t.Fatal("expected error before Update")
+			}
+
+			seedA, seedB := []byte("seed hash A"), []byte("seed hash B")
+			input := []byte("This is a test")
+			expectedA, expectedB := testEpochHash(t, flags, seedA, input), testEpochHash(t, flags, seedB, input)
+
+			// next seed is not known yet
+			if err = m.Update(4096+10, seedA, nil); err != nil {
+				t.Fatal(err)
+			}
+			if string(m.SeedHash()) != string(seedA) {
+				t.Fatalf("expected seed %s, got %s", seedA, m.SeedHash())
+			}
+
+			vm, err := m.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var output [RANDOMX_HASH_SIZE]byte
+			if err := vm.CalculateHash(input, &output); err != nil {
+				t.Fatal(err)
+			}
+			if output != expectedA {
+				t.Fatalf("expected=%x, actual=%x", expectedA, output)
+			}
+
+			// seed block for next epoch was found, prepare in background
+			if err = m.Update(6144+64, seedA, seedB); err != nil {
+				t.Fatal(err)
+			}
+			m.lock.Lock()
+			next := m.next
+			m.lock.Unlock()
+			if next == nil || next.key != string(seedB) {
+				t.Fatal("expected next epoch to be prepared")
+			}
+			<-next.ready
+
+			m.lock.Lock()
+			previous := m.current
+			m.lock.Unlock()
+
+			// switch epochs while a VM is still in use
+			if err = m.Update(6144+65, seedB, nil); err != nil {
+				t.Fatal(err)
+			}
+			if string(m.SeedHash()) != string(seedB) {
+				t.Fatalf("expected seed %s, got %s", seedB, m.SeedHash())
+			}
+
+			if err := vm.CalculateHash(input, &output); err != nil {
+				t.Fatal(err)
+			}
+			if output != expectedA {
+				t.Fatalf("in-flight VM changed key: expected=%x, actual=%x", expectedA, output)
+			}
+
+			m.lock.Lock()
+			freed := previous.freed
+			m.lock.Unlock()
+			if freed {
+				t.Fatal("epoch freed while referenced")
+			}
+
+			if err := m.Put(vm); err != nil {
+				t.Fatal(err)
+			}
+
+			m.lock.Lock()
+			freed = previous.freed
+			m.lock.Unlock()
+			if !freed {
+				t.Fatal("epoch not freed after last reference was released")
+			}
+
+			vm, err = m.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.CalculateHash(input, &output); err != nil {
+				t.Fatal(err)
+			}
+			if output != expectedB {
+				t.Fatalf("expected=%x, actual=%x", expectedB, output)
+			}
+			if err := m.Put(vm); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Put(vm); !errors.Is(err, ErrUnknownVM) {
+				t.Fatalf("expected ErrUnknownVM, got %v", err)
+			}
+		})
+	}
+}
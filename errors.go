@@ -0,0 +1,26 @@
+package randomx
+
+import "errors"
+
+var (
+	// ErrClosed A Cache, Dataset or VM was used after Close, or closed more than once
+	ErrClosed = errors.New("closed")
+	// ErrModeMismatch The operation does not match the light or full mode the VM was created with
+	ErrModeMismatch = errors.New("mode mismatch")
+	// ErrJITUnavailable JIT memory could not be allocated or its protection changed
+	ErrJITUnavailable = errors.New("JIT unavailable")
+	// ErrConfigMismatch Cache, Dataset or VM were created with different Config
+	ErrConfigMismatch = errors.New("config mismatch")
+	// ErrOutOfRange Dataset item range is out of bounds
+	ErrOutOfRange = errors.New("out of range")
+	// ErrNotInitialized Cache has not been initialized with a key
+	ErrNotInitialized = errors.New("cache not initialized")
+	// ErrCacheChanged Cache was initialized with a new key without calling VM.SetCache, or while a DatasetWriter used it
+	ErrCacheChanged = errors.New("cache was re-initialized")
+	// ErrReadOnly Dataset is backed by a read-only file, see NewDatasetFromFile
+	ErrReadOnly = errors.New("read-only dataset")
+	// ErrNoPendingHash CalculateCommitmentNext or CalculateCommitmentLast was called without CalculateCommitmentFirst
+	ErrNoPendingHash = errors.New("no pending hash")
+	// ErrUnknownVM EpochManager.Put was called with a VM not obtained via EpochManager.Get, or returned twice
+	ErrUnknownVM = errors.New("VM not obtained via Get")
+)
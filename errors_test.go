@@ -0,0 +1,152 @@
+package randomx
+
+import (
+	"errors"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/aes"
+)
+
+func Test_Errors_Close(t *testing.T) {
+	t.Parallel()
+
+	key := []byte("test key 000")
+
+	cache, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Init(key); err != nil {
+		t.Fatal(err)
+	}
+
+	dataset, err := NewDatasetWithConfig(GetFlags()|RANDOMX_FLAG_FULL_MEM, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dataset.InitDatasetParallel(cache, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var outputHash [RANDOMX_HASH_SIZE]byte
+	if err := vm.CalculateHash(key, &outputHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("VM double Close: expected ErrClosed, got %v", err)
+	}
+	if err := vm.CalculateHash(key, &outputHash); !errors.Is(err, ErrClosed) {
+		t.Errorf("VM CalculateHash after Close: expected ErrClosed, got %v", err)
+	}
+
+	vm, err = NewVM(GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err := dataset.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dataset.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Dataset double Close: expected ErrClosed, got %v", err)
+	}
+	if err := dataset.InitDataset(cache, 0, 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Dataset InitDataset after Close: expected ErrClosed, got %v", err)
+	}
+	if _, err := NewVM(GetFlags()|RANDOMX_FLAG_FULL_MEM, nil, dataset); !errors.Is(err, ErrClosed) {
+		t.Errorf("NewVM with closed Dataset: expected ErrClosed, got %v", err)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Cache double Close: expected ErrClosed, got %v", err)
+	}
+	if err := cache.Init(key); !errors.Is(err, ErrClosed) {
+		t.Errorf("Cache Init after Close: expected ErrClosed, got %v", err)
+	}
+	if err := vm.CalculateHash(key, &outputHash); !errors.Is(err, ErrClosed) {
+		t.Errorf("VM CalculateHash with closed Cache: expected ErrClosed, got %v", err)
+	}
+}
+
+func Test_Errors_Mismatch(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	dataset, err := NewDatasetWithConfig(GetFlags()|RANDOMX_FLAG_FULL_MEM, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dataset.Close()
+
+	if err := dataset.InitDataset(cache, 0, 1); !errors.Is(err, ErrNotInitialized) {
+		t.Errorf("InitDataset with uninitialized Cache: expected ErrNotInitialized, got %v", err)
+	}
+
+	if err := cache.Init([]byte("test key 000")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dataset.InitDataset(cache, dataset.config.datasetItemCount, 1); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("InitDataset out of range: expected ErrOutOfRange, got %v", err)
+	}
+
+	vm, err := NewVM(GetFlags()|RANDOMX_FLAG_FULL_MEM, nil, dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err := vm.SetCache(cache); !errors.Is(err, ErrModeMismatch) {
+		t.Errorf("SetCache in full mode: expected ErrModeMismatch, got %v", err)
+	}
+
+	otherCache, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer otherCache.Close()
+
+	lightVM, err := NewVM(GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lightVM.Close()
+
+	if err := lightVM.SetDataset(dataset); !errors.Is(err, ErrModeMismatch) {
+		t.Errorf("SetDataset in light mode: expected ErrModeMismatch, got %v", err)
+	}
+	if err := lightVM.SetCache(otherCache); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("SetCache with different config: expected ErrConfigMismatch, got %v", err)
+	}
+}
+
+func Test_Errors_AES(t *testing.T) {
+	t.Parallel()
+
+	var state [64]byte
+	impl := aes.NewSoftAES()
+	if err := impl.HashAes1Rx4(make([]byte, 65), &state); !errors.Is(err, aes.ErrInvalidLength) {
+		t.Errorf("HashAes1Rx4: expected ErrInvalidLength, got %v", err)
+	}
+	if err := impl.FillAes1Rx4(&state, make([]byte, 65)); !errors.Is(err, aes.ErrInvalidLength) {
+		t.Errorf("FillAes1Rx4: expected ErrInvalidLength, got %v", err)
+	}
+}
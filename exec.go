@@ -13,3 +13,11 @@ func (f SuperScalarProgramFunc) Close() error {
 func (f VMProgramFunc) Close() error {
 	return memory.FreeSlice(pageAllocator, f)
 }
+
+func (f VMProgramFunc) Execute(rf *RegisterFile, pad *ScratchPad, eMask [2]uint64) {
+	f.execute(rf, pad[:], eMask)
+}
+
+func (f VMProgramFunc) ExecuteFull(rf *RegisterFile, pad *ScratchPad, dataset *RegisterLine, iterations uint64, ma, mx uint32, eMask [2]uint64) {
+	f.executeFull(rf, pad[:], dataset, iterations, ma, mx, eMask)
+}
@@ -2,6 +2,7 @@ package randomx
 
 import (
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/aes"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/argon2"
 	"golang.org/x/sys/cpu"
 	"runtime"
 )
@@ -31,6 +32,11 @@ const (
 	RANDOMX_FLAG_SECURE
 	RANDOMX_FLAG_ARGON2_SSSE3
 	RANDOMX_FLAG_ARGON2_AVX2
+	// RANDOMX_FLAG_LIGHT_CONCURRENT Computes the next Dataset item on a helper goroutine while the program runs, in light mode.
+	// Lowers the latency of a single hash when a spare CPU is available, at the cost of keeping it busy.
+	// Only applies to the interpreter and to a JIT VM whose Cache is not compiled, it is ignored when both use the JIT.
+	// Not part of the reference flags.
+	RANDOMX_FLAG_LIGHT_CONCURRENT
 	RANDOMX_FLAG_ARGON2 = RANDOMX_FLAG_ARGON2_AVX2 | RANDOMX_FLAG_ARGON2_SSSE3
 )
 
@@ -51,11 +57,12 @@ func GetFlags() (flags Flags) {
 			flags |= RANDOMX_FLAG_HARD_AES
 		}
 
-		if cpu.X86.HasSSSE3 {
+		// only set when built with the assembly implementations
+		if argon2.ImplSSSE3 != nil {
 			flags |= RANDOMX_FLAG_ARGON2_SSSE3
 		}
 
-		if cpu.X86.HasAVX2 {
+		if argon2.ImplAVX2 != nil {
 			flags |= RANDOMX_FLAG_ARGON2_AVX2
 		}
 	}
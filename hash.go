@@ -0,0 +1,232 @@
+package randomx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Hash RandomX hash output, as written by VM.CalculateHash
+type Hash [RANDOMX_HASH_SIZE]byte
+
+// String Returns the hash in hexadecimal
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+func (h Hash) MarshalText() ([]byte, error) {
+	buf := make([]byte, hex.EncodedLen(len(h)))
+	hex.Encode(buf, h[:])
+	return buf, nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return errors.New("invalid hash length")
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+// words Returns the hash as a 256-bit little endian integer, least significant word first
+func (h *Hash) words() (w [4]uint64) {
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint64(h[i*8:])
+	}
+	return w
+}
+
+// MeetsDifficulty Checks whether hash * difficulty fits in 256 bits, with the hash read as a little endian integer.
+// A zero difficulty is never met.
+// See Monero check_hash_128
+func (h Hash) MeetsDifficulty(difficulty Difficulty) bool {
+	if difficulty.IsZero() {
+		return false
+	}
+
+	w := h.words()
+
+	// schoolbook multiplication of 256-bit hash by 128-bit difficulty, any carry out of 256 bits fails
+	var product [6]uint64
+	for j, d := range [2]uint64{difficulty.Lo, difficulty.Hi} {
+		if d == 0 {
+			continue
+		}
+		var carry uint64
+		for i := range w {
+			hi, lo := bits.Mul64(w[i], d)
+			var c uint64
+			product[i+j], c = bits.Add64(product[i+j], lo, 0)
+			hi += c
+			product[i+j], c = bits.Add64(product[i+j], carry, 0)
+			carry = hi + c
+		}
+		for k := len(w) + j; carry != 0 && k < len(product); k++ {
+			product[k], carry = bits.Add64(product[k], carry, 0)
+		}
+	}
+
+	return product[4] == 0 && product[5] == 0
+}
+
+// MeetsTarget Checks a hash against a 64-bit stratum target, comparing its most significant 64 bits.
+// See ParseTarget
+func (h Hash) MeetsTarget(target uint64) bool {
+	return binary.LittleEndian.Uint64(h[RANDOMX_HASH_SIZE-8:]) < target
+}
+
+// Difficulty 128-bit Monero difficulty
+type Difficulty struct {
+	Lo, Hi uint64
+}
+
+// NewDifficulty Returns a 64-bit difficulty
+func NewDifficulty(d uint64) Difficulty {
+	return Difficulty{Lo: d}
+}
+
+func (d Difficulty) IsZero() bool {
+	return d.Lo == 0 && d.Hi == 0
+}
+
+func (d Difficulty) Cmp(other Difficulty) int {
+	if d.Hi != other.Hi {
+		if d.Hi < other.Hi {
+			return -1
+		}
+		return 1
+	}
+	if d.Lo != other.Lo {
+		if d.Lo < other.Lo {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// Big Returns the difficulty as a big.Int
+func (d Difficulty) Big() *big.Int {
+	b := new(big.Int).SetUint64(d.Hi)
+	b.Lsh(b, 64)
+	return b.Or(b, new(big.Int).SetUint64(d.Lo))
+}
+
+// String Returns the difficulty in decimal
+func (d Difficulty) String() string {
+	if d.Hi == 0 {
+		return strconv.FormatUint(d.Lo, 10)
+	}
+	return d.Big().String()
+}
+
+// ParseDifficulty Parses a decimal difficulty, or a hexadecimal one prefixed by 0x as used by Monero wide_difficulty
+func ParseDifficulty(s string) (Difficulty, error) {
+	b, ok := new(big.Int), false
+	if hexStr, isHex := strings.CutPrefix(s, "0x"); isHex {
+		b, ok = b.SetString(hexStr, 16)
+	} else {
+		b, ok = b.SetString(s, 10)
+	}
+	if !ok || b.Sign() < 0 || b.BitLen() > 128 {
+		return Difficulty{}, errors.New("invalid difficulty")
+	}
+
+	var buf [16]byte
+	b.FillBytes(buf[:])
+	return Difficulty{
+		Hi: binary.BigEndian.Uint64(buf[:8]),
+		Lo: binary.BigEndian.Uint64(buf[8:]),
+	}, nil
+}
+
+func (d Difficulty) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Difficulty) UnmarshalText(text []byte) (err error) {
+	*d, err = ParseDifficulty(string(text))
+	return err
+}
+
+// MarshalJSON Encodes 64-bit difficulties as a JSON number, and larger ones as a decimal string
+func (d Difficulty) MarshalJSON() ([]byte, error) {
+	if d.Hi == 0 {
+		return strconv.AppendUint(nil, d.Lo, 10), nil
+	}
+	return strconv.AppendQuote(nil, d.String()), nil
+}
+
+// UnmarshalJSON Accepts a JSON number, or a string as accepted by ParseDifficulty
+func (d *Difficulty) UnmarshalJSON(data []byte) (err error) {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	*d, err = ParseDifficulty(s)
+	return err
+}
+
+// TargetFromDifficulty Returns the 64-bit stratum target for a difficulty, as used by Hash.MeetsTarget
+func TargetFromDifficulty(difficulty uint64) uint64 {
+	if difficulty <= 1 {
+		return math.MaxUint64
+	}
+	return math.MaxUint64 / difficulty
+}
+
+// DifficultyFromTarget Returns the difficulty of a 64-bit stratum target.
+// Integer division makes it an exact inverse of TargetFromDifficulty only for difficulties up to 2^32.
+func DifficultyFromTarget(target uint64) uint64 {
+	if target == 0 {
+		return math.MaxUint64
+	}
+	return math.MaxUint64 / target
+}
+
+// ParseTarget Parses a stratum job target, either a compact 32-bit one (8 hex characters) or a full 64-bit one
+// (16 hex characters), both little endian. The result can be used with Hash.MeetsTarget.
+func ParseTarget(s string) (uint64, error) {
+	var buf [8]byte
+	switch len(s) {
+	case 8:
+		if _, err := hex.Decode(buf[:4], []byte(s)); err != nil {
+			return 0, err
+		}
+		target32 := uint64(binary.LittleEndian.Uint32(buf[:]))
+		if target32 == 0 {
+			return 0, errors.New("invalid target")
+		}
+		return math.MaxUint64 / (math.MaxUint32 / target32), nil
+	case 16:
+		if _, err := hex.Decode(buf[:], []byte(s)); err != nil {
+			return 0, err
+		}
+		target := binary.LittleEndian.Uint64(buf[:])
+		if target == 0 {
+			return 0, errors.New("invalid target")
+		}
+		return target, nil
+	default:
+		return 0, errors.New("invalid target length")
+	}
+}
+
+// FormatTarget Encodes a 64-bit target for a stratum job. The compact 32-bit form is used when it decodes back
+// to the same target, which keeps older miners working at low difficulty.
+func FormatTarget(target uint64) string {
+	var buf [8]byte
+	if target32 := target >> 32; target32 != 0 {
+		if d := math.MaxUint32 / target32; d != 0 && math.MaxUint64/d == target {
+			binary.LittleEndian.PutUint32(buf[:], uint32(target32))
+			return hex.EncodeToString(buf[:4])
+		}
+	}
+	binary.LittleEndian.PutUint64(buf[:], target)
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,212 @@
+package randomx
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"math/rand"
+	"testing"
+)
+
+func hashFromWords(w [4]uint64) (h Hash) {
+	for i := range w {
+		binary.LittleEndian.PutUint64(h[i*8:], w[i])
+	}
+	return h
+}
+
+// Test_Hash_MeetsDifficulty Vectors follow Monero check_hash: the hash, read as a little endian 256-bit integer,
+// multiplied by the difficulty must not overflow 256 bits.
+func Test_Hash_MeetsDifficulty(t *testing.T) {
+	t.Parallel()
+
+	const m = math.MaxUint64
+
+	var tests = []struct {
+		hash       [4]uint64
+		difficulty Difficulty
+		meets      bool
+	}{
+		{[4]uint64{m, m, m, m}, NewDifficulty(1), true},
+		{[4]uint64{m, m, m, m}, NewDifficulty(2), false},
+		{[4]uint64{m, m, m, m >> 1}, NewDifficulty(2), true},
+		{[4]uint64{m, m, m, m >> 1}, NewDifficulty(3), false},
+		{[4]uint64{0x5555555555555555, 0x5555555555555555, 0x5555555555555555, 0x5555555555555555}, NewDifficulty(3), true},
+		{[4]uint64{0x5555555555555555, 0x5555555555555555, 0x5555555555555555, 0x5555555555555555}, NewDifficulty(4), false},
+		{[4]uint64{0, 0, 0, 0}, NewDifficulty(m), true},
+		{[4]uint64{0, 0, 0, 0}, Difficulty{Lo: m, Hi: m}, true},
+		{[4]uint64{0, 0, 0, 1}, NewDifficulty(m), true},
+		{[4]uint64{0, 0, 0, 2}, NewDifficulty(m), false},
+		{[4]uint64{m, m, 0, 0}, Difficulty{Lo: 0, Hi: 1}, true},
+		{[4]uint64{0, 0, 1, 0}, Difficulty{Lo: m, Hi: m}, true},
+		{[4]uint64{0, 1, 1, 0}, Difficulty{Lo: m, Hi: m}, false},
+		{[4]uint64{1, 0, 1, 0}, Difficulty{Lo: m, Hi: m}, true},
+		{[4]uint64{m, m, 0, 0}, Difficulty{Lo: m, Hi: m}, true},
+		{[4]uint64{0, 0, 0, 1}, Difficulty{Lo: 0, Hi: 1}, false},
+		{[4]uint64{0, 0, 0, 0}, Difficulty{}, false},
+	}
+
+	for i, tt := range tests {
+		if meets := hashFromWords(tt.hash).MeetsDifficulty(tt.difficulty); meets != tt.meets {
+			t.Errorf("#%d: hash=%x difficulty=%s: expected=%v, actual=%v", i, tt.hash, tt.difficulty, tt.meets, meets)
+		}
+	}
+}
+
+func Test_Hash_MeetsDifficulty_Random(t *testing.T) {
+	t.Parallel()
+
+	limit := new(big.Int).Lsh(big.NewInt(1), 256)
+	rng := rand.New(rand.NewSource(0))
+
+	for i := 0; i < 10000; i++ {
+		var h Hash
+		rng.Read(h[:])
+		// bias towards interesting magnitudes
+		for j := rng.Intn(RANDOMX_HASH_SIZE); j > 0; j-- {
+			h[RANDOMX_HASH_SIZE-j] = 0
+		}
+		d := Difficulty{Lo: rng.Uint64() >> rng.Intn(64), Hi: rng.Uint64() >> (rng.Intn(65) % 64)}
+		if rng.Intn(2) == 0 {
+			d.Hi = 0
+		}
+
+		reversed := make([]byte, len(h))
+		for j := range h {
+			reversed[len(h)-1-j] = h[j]
+		}
+		product := new(big.Int).Mul(new(big.Int).SetBytes(reversed), d.Big())
+		expected := !d.IsZero() && product.Cmp(limit) < 0
+
+		if meets := h.MeetsDifficulty(d); meets != expected {
+			t.Fatalf("hash=%s difficulty=%s: expected=%v, actual=%v", h, d, expected, meets)
+		}
+	}
+}
+
+func Test_Hash_Marshal(t *testing.T) {
+	t.Parallel()
+
+	h, err := hex.DecodeString(Tests[0].expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(Hash(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"`+Tests[0].expected+`"` {
+		t.Fatalf("unexpected encoding %s", data)
+	}
+
+	var decoded Hash
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded != Hash(h) {
+		t.Fatalf("expected=%s, actual=%s", Hash(h), decoded)
+	}
+
+	if err := decoded.UnmarshalText([]byte("00")); err == nil {
+		t.Error("expected error on short hash")
+	}
+}
+
+func Test_Difficulty_Marshal(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		difficulty Difficulty
+		json       string
+	}{
+		{NewDifficulty(0), `0`},
+		{NewDifficulty(340000000000), `340000000000`},
+		{NewDifficulty(math.MaxUint64), `18446744073709551615`},
+		{Difficulty{Lo: 0, Hi: 1}, `"18446744073709551616"`},
+		{Difficulty{Lo: math.MaxUint64, Hi: math.MaxUint64}, `"340282366920938463463374607431768211455"`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.difficulty)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.json {
+			t.Errorf("expected=%s, actual=%s", tt.json, data)
+		}
+
+		var decoded Difficulty
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded != tt.difficulty {
+			t.Errorf("expected=%s, actual=%s", tt.difficulty, decoded)
+		}
+	}
+
+	// Monero wide_difficulty
+	d, err := ParseDifficulty("0x10000000000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d != (Difficulty{Lo: 1, Hi: 1}) {
+		t.Errorf("unexpected difficulty %s", d)
+	}
+
+	for _, s := range []string{"", "-1", "0x", "abc", "340282366920938463463374607431768211456"} {
+		if _, err := ParseDifficulty(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func Test_Target(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		target     string
+		difficulty uint64
+		// formatted FormatTarget of the parsed target
+		formatted string
+	}{
+		{"ffffffff", 1, "ffffffff"},
+		{"37894100", 1000, "37894100"},
+		{"0ad7a300", 400, "0ad7a300"},
+		// compact targets are lossy, matching the way miners decode them
+		{"cf8b0000", 120001, "cf8b0000"},
+		{"10ece564cf8b0000", 120000, "10ece564cf8b0000"},
+	}
+
+	for _, tt := range tests {
+		target, err := ParseTarget(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := DifficultyFromTarget(target); d != tt.difficulty {
+			t.Errorf("%s: expected difficulty=%d, actual=%d", tt.target, tt.difficulty, d)
+		}
+		if target != TargetFromDifficulty(tt.difficulty) {
+			t.Errorf("%s: expected target=%x, actual=%x", tt.target, TargetFromDifficulty(tt.difficulty), target)
+		}
+		if s := FormatTarget(target); s != tt.formatted {
+			t.Errorf("%s: expected=%s, actual=%s", tt.target, tt.formatted, s)
+		}
+	}
+
+	for _, s := range []string{"", "00000000", "0000000000000000", "zzzzzzzz", "ffff"} {
+		if _, err := ParseTarget(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+
+	target := TargetFromDifficulty(1000)
+	if !hashFromWords([4]uint64{math.MaxUint64, math.MaxUint64, math.MaxUint64, target - 1}).MeetsTarget(target) {
+		t.Error("expected hash below target to meet it")
+	}
+	if hashFromWords([4]uint64{0, 0, 0, target}).MeetsTarget(target) {
+		t.Error("expected hash at target not to meet it")
+	}
+}
@@ -0,0 +1,154 @@
+package randomx
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// HashResult Result of Hasher.HashAsync
+type HashResult struct {
+	Hash  [RANDOMX_HASH_SIZE]byte
+	Error error
+}
+
+// Hasher Calculates RandomX hashes using a pool of VMs. Safe for concurrent use.
+// VMs are created on demand, up to the configured concurrency, and reused afterward.
+type Hasher struct {
+	flags   Flags
+	cache   *Cache
+	dataset *Dataset
+
+	// sem holds one token per VM that may be in use at the same time
+	sem chan struct{}
+
+	lock   sync.Mutex
+	vms    []*VM
+	free   []*VM
+	closed bool
+}
+
+// NewHasher Creates a Hasher that takes ownership of cache and dataset, and closes them on Close.
+// If flags contain RANDOMX_FLAG_FULL_MEM dataset is required, otherwise cache is required.
+// At most concurrency hashes are calculated at the same time, runtime.NumCPU() is used if concurrency is not positive.
+func NewHasher(flags Flags, cache *Cache, dataset *Dataset, concurrency int) (*Hasher, error) {
+	if cache == nil && !flags.Has(RANDOMX_FLAG_FULL_MEM) {
+		return nil, errors.New("nil cache in light mode")
+	}
+	if dataset == nil && flags.Has(RANDOMX_FLAG_FULL_MEM) {
+		return nil, errors.New("nil dataset in full mode")
+	}
+
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	return &Hasher{
+		flags:   flags,
+		cache:   cache,
+		dataset: dataset,
+		sem:     make(chan struct{}, concurrency),
+	}, nil
+}
+
+// acquire Returns a free VM, creating a new one if none is available. A sem token must be held.
+func (h *Hasher) acquire() (*VM, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.closed {
+		return nil, ErrClosed
+	}
+
+	if len(h.free) > 0 {
+		vm := h.free[len(h.free)-1]
+		h.free = h.free[:len(h.free)-1]
+		return vm, nil
+	}
+
+	vm, err := NewVM(h.flags, h.cache, h.dataset)
+	if err != nil {
+		return nil, err
+	}
+	h.vms = append(h.vms, vm)
+	return vm, nil
+}
+
+func (h *Hasher) release(vm *VM) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.free = append(h.free, vm)
+}
+
+// Hash Calculates the RandomX hash of input. Blocks while all VMs are busy.
+func (h *Hasher) Hash(input []byte) (output [RANDOMX_HASH_SIZE]byte, err error) {
+	h.sem <- struct{}{}
+	defer func() {
+		<-h.sem
+	}()
+
+	vm, err := h.acquire()
+	if err != nil {
+		return output, err
+	}
+	defer h.release(vm)
+
+	err = vm.CalculateHash(input, &output)
+	return output, err
+}
+
+// HashAsync Calculates the RandomX hash of input in the background.
+// input is copied and can be reused once HashAsync returns.
+// The returned channel receives exactly one result.
+func (h *Hasher) HashAsync(input []byte) <-chan HashResult {
+	input = append([]byte(nil), input...)
+
+	result := make(chan HashResult, 1)
+	go func() {
+		output, err := h.Hash(input)
+		result <- HashResult{Hash: output, Error: err}
+	}()
+	return result
+}
+
+// Close Waits for in-flight hashes, then releases all VMs, the Cache and the Dataset.
+func (h *Hasher) Close() error {
+	h.lock.Lock()
+	if h.closed {
+		h.lock.Unlock()
+		return nil
+	}
+	h.closed = true
+	h.lock.Unlock()
+
+	// wait for all in-flight hashes to finish
+	for i := 0; i < cap(h.sem); i++ {
+		h.sem <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(h.sem); i++ {
+			<-h.sem
+		}
+	}()
+
+	var errs []error
+	for _, vm := range h.vms {
+		if err := vm.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	h.vms, h.free = nil, nil
+
+	if h.dataset != nil {
+		if err := h.dataset.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if h.cache != nil {
+		if err := h.cache.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
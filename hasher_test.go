@@ -0,0 +1,79 @@
+package randomx
+
+import (
+	"encoding/hex"
+	"sync"
+	"testing"
+)
+
+func Test_Hasher(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// all Tests[1:4] share the same key
+	if err := cache.Init(Tests[1].key); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := NewHasher(GetFlags(), cache, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := Tests[1:4]
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		for _, test := range tests {
+			wg.Add(1)
+			go func(test testdata) {
+				defer wg.Done()
+				output, err := h.Hash(test.input)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if outputHex := hex.EncodeToString(output[:]); outputHex != test.expected {
+					t.Errorf("expected=%s, actual=%s", test.expected, outputHex)
+				}
+			}(test)
+		}
+	}
+
+	results := make([]<-chan HashResult, len(tests))
+	for i, test := range tests {
+		results[i] = h.HashAsync(test.input)
+	}
+	for i, test := range tests {
+		result := <-results[i]
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+		if outputHex := hex.EncodeToString(result.Hash[:]); outputHex != test.expected {
+			t.Errorf("expected=%s, actual=%s", test.expected, outputHex)
+		}
+	}
+
+	wg.Wait()
+
+	h.lock.Lock()
+	vms := len(h.vms)
+	h.lock.Unlock()
+	if vms > 2 {
+		t.Errorf("expected at most 2 VMs, got %d", vms)
+	}
+
+	if err = h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = h.Hash(tests[0].input); err == nil {
+		t.Fatal("expected error after Close")
+	}
+	if result := <-h.HashAsync(tests[0].input); result.Error == nil {
+		t.Fatal("expected error after Close")
+	}
+}
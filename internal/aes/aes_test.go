@@ -0,0 +1,146 @@
+package aes
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func testHardAES(tb testing.TB) AES {
+	impl := NewHardAES()
+	if impl == nil {
+		tb.Skip("hardware AES not supported")
+	}
+	return impl
+}
+
+func testState(rng *rand.Rand) (state [64]byte) {
+	_, _ = rng.Read(state[:])
+	return state
+}
+
+func testKeys(rng *rand.Rand) FillAes4Rx4Keys {
+	var k [8][4]uint32
+	for i := range k {
+		for j := range k[i] {
+			k[i][j] = rng.Uint32()
+		}
+	}
+	return NewFillAes4Rx4Keys(&k)
+}
+
+func Test_HashAndFillAes1Rx4(t *testing.T) {
+	t.Parallel()
+	hard := testHardAES(t)
+	soft := NewSoftAES()
+
+	rng := rand.New(rand.NewSource(0))
+
+	for _, size := range []int{0, 64, 4096, 2 * 1024 * 1024} {
+		input := make([]byte, size)
+		_, _ = rng.Read(input)
+		fillState := testState(rng)
+
+		expectedPad, expectedFillState := bytes.Clone(input), fillState
+		var expectedHash [64]byte
+		if err := soft.HashAndFillAes1Rx4(expectedPad, &expectedHash, &expectedFillState); err != nil {
+			t.Fatal(err)
+		}
+
+		pad := bytes.Clone(input)
+		var hash [64]byte
+		if err := hard.HashAndFillAes1Rx4(pad, &hash, &fillState); err != nil {
+			t.Fatal(err)
+		}
+
+		if hash != expectedHash {
+			t.Errorf("size=%d: hash mismatch", size)
+		}
+		if fillState != expectedFillState {
+			t.Errorf("size=%d: fill state mismatch", size)
+		}
+		if !bytes.Equal(pad, expectedPad) {
+			t.Errorf("size=%d: scratchpad mismatch", size)
+		}
+	}
+}
+
+func Test_FillAes4Rx4(t *testing.T) {
+	t.Parallel()
+	hard := testHardAES(t)
+	soft := NewSoftAES()
+
+	rng := rand.New(rand.NewSource(0))
+	keys := testKeys(rng)
+	state := testState(rng)
+
+	for _, size := range []int{0, 64, 16384} {
+		expected := make([]byte, size)
+		if err := soft.FillAes4Rx4(state, &keys, expected); err != nil {
+			t.Fatal(err)
+		}
+
+		output := make([]byte, size)
+		if err := hard.FillAes4Rx4(state, &keys, output); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(output, expected) {
+			t.Errorf("size=%d: output mismatch", size)
+		}
+	}
+}
+
+func Benchmark_HashAndFillAes1Rx4(b *testing.B) {
+	scratchpad := make([]byte, 2*1024*1024)
+	var hash, fillState [64]byte
+
+	b.Run("hard", func(b *testing.B) {
+		hard := testHardAES(b)
+		b.SetBytes(int64(len(scratchpad)))
+		for i := 0; i < b.N; i++ {
+			_ = hard.HashAndFillAes1Rx4(scratchpad, &hash, &fillState)
+		}
+	})
+
+	b.Run("hard-separate", func(b *testing.B) {
+		hard := testHardAES(b)
+		b.SetBytes(int64(len(scratchpad)))
+		for i := 0; i < b.N; i++ {
+			_ = hard.HashAes1Rx4(scratchpad, &hash)
+			_ = hard.FillAes1Rx4(&fillState, scratchpad)
+		}
+	})
+
+	b.Run("soft", func(b *testing.B) {
+		soft := NewSoftAES()
+		b.SetBytes(int64(len(scratchpad)))
+		for i := 0; i < b.N; i++ {
+			_ = soft.HashAndFillAes1Rx4(scratchpad, &hash, &fillState)
+		}
+	})
+}
+
+func Benchmark_FillAes4Rx4(b *testing.B) {
+	rng := rand.New(rand.NewSource(0))
+	keys := testKeys(rng)
+	state := testState(rng)
+	// program buffer size for ConfigMonero
+	output := make([]byte, 128+256*8)
+
+	b.Run("hard", func(b *testing.B) {
+		hard := testHardAES(b)
+		b.SetBytes(int64(len(output)))
+		for i := 0; i < b.N; i++ {
+			_ = hard.FillAes4Rx4(state, &keys, output)
+		}
+	})
+
+	b.Run("soft", func(b *testing.B) {
+		soft := NewSoftAES()
+		b.SetBytes(int64(len(output)))
+		for i := 0; i < b.N; i++ {
+			_ = soft.FillAes4Rx4(state, &keys, output)
+		}
+	})
+}
@@ -23,47 +23,46 @@ func NewHardAES() AES {
 	return nil
 }
 
-func (aes hardAES) HashAes1Rx4(input []byte, output *[64]byte) {
+func (aes hardAES) HashAes1Rx4(input []byte, output *[64]byte) error {
 	if len(input)%len(output) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 
 	asm.HashAes1Rx4(&keys.AesHash1R_State, &keys.AesHash1R_XKeys, output, unsafe.SliceData(input), uint64(len(input)))
+	return nil
 }
 
-func (aes hardAES) FillAes1Rx4(state *[64]byte, output []byte) {
+func (aes hardAES) FillAes1Rx4(state *[64]byte, output []byte) error {
 	if len(output)%len(state) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 
 	// Reference to state without copying
 	states := (*[4][4]uint32)(unsafe.Pointer(state))
 	asm.FillAes1Rx4(states, &keys.AesGenerator1R_Keys, unsafe.SliceData(output), uint64(len(output)))
 	runtime.KeepAlive(state)
+	return nil
 }
 
-func (aes hardAES) FillAes4Rx4(state [64]byte, output []byte) {
+func (aes hardAES) FillAes4Rx4(state [64]byte, keys *FillAes4Rx4Keys, output []byte) error {
 	if len(output)%len(state) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 
 	// state is copied on caller
-
-	// Copy state
 	states := (*[4][4]uint32)(unsafe.Pointer(&state))
+	asm.FillAes4Rx4(states, (*[4][4][4]uint32)(keys), unsafe.SliceData(output), uint64(len(output)))
+	return nil
+}
 
-	for outptr := 0; outptr < len(output); outptr += len(state) {
-		asm.AESRoundTrip_DecEnc(states, &fillAes4Rx4Keys0)
-		asm.AESRoundTrip_DecEnc(states, &fillAes4Rx4Keys1)
-		asm.AESRoundTrip_DecEnc(states, &fillAes4Rx4Keys2)
-		asm.AESRoundTrip_DecEnc(states, &fillAes4Rx4Keys3)
-
-		copy(output[outptr:], state[:])
+func (aes hardAES) HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte) error {
+	if len(scratchpad)%len(output) != 0 {
+		return ErrInvalidLength
 	}
-}
 
-func (aes hardAES) HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte) {
-	//TODO
-	aes.HashAes1Rx4(scratchpad, output)
-	aes.FillAes1Rx4(fillState, scratchpad)
+	// Reference to state without copying
+	states := (*[4][4]uint32)(unsafe.Pointer(fillState))
+	asm.HashAndFillAes1Rx4(&keys.AesHash1R_State, &keys.AesHash1R_XKeys, output, states, &keys.AesGenerator1R_Keys, unsafe.SliceData(scratchpad), uint64(len(scratchpad)))
+	runtime.KeepAlive(fillState)
+	return nil
 }
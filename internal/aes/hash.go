@@ -29,31 +29,19 @@ USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
 
 package aes
 
-import (
-	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/keys"
-)
-
-var fillAes4Rx4Keys0 = [4][4]uint32{
-	keys.AesGenerator4R_Keys[0],
-	keys.AesGenerator4R_Keys[0],
-	keys.AesGenerator4R_Keys[4],
-	keys.AesGenerator4R_Keys[4],
-}
-var fillAes4Rx4Keys1 = [4][4]uint32{
-	keys.AesGenerator4R_Keys[1],
-	keys.AesGenerator4R_Keys[1],
-	keys.AesGenerator4R_Keys[5],
-	keys.AesGenerator4R_Keys[5],
-}
-var fillAes4Rx4Keys2 = [4][4]uint32{
-	keys.AesGenerator4R_Keys[2],
-	keys.AesGenerator4R_Keys[2],
-	keys.AesGenerator4R_Keys[6],
-	keys.AesGenerator4R_Keys[6],
-}
-var fillAes4Rx4Keys3 = [4][4]uint32{
-	keys.AesGenerator4R_Keys[3],
-	keys.AesGenerator4R_Keys[3],
-	keys.AesGenerator4R_Keys[7],
-	keys.AesGenerator4R_Keys[7],
+// FillAes4Rx4Keys Keys used by FillAes4Rx4, one set of 4 column keys for each of the 4 rounds
+type FillAes4Rx4Keys [4][4][4]uint32
+
+// NewFillAes4Rx4Keys Lays out AesGenerator4R keys for FillAes4Rx4.
+// Keys 0-3 are used for columns 0 and 1, keys 4-7 for columns 2 and 3.
+func NewFillAes4Rx4Keys(k *[8][4]uint32) (out FillAes4Rx4Keys) {
+	for i := range out {
+		out[i] = [4][4]uint32{
+			k[i],
+			k[i],
+			k[i+4],
+			k[i+4],
+		}
+	}
+	return out
 }
@@ -1,5 +1,10 @@
 package aes
 
+import "errors"
+
+// ErrInvalidLength Input or output length is not a multiple of 64
+var ErrInvalidLength = errors.New("length must be a multiple of 64")
+
 type AES interface {
 
 	// HashAes1Rx4
@@ -8,13 +13,13 @@ type AES interface {
 	// The input is treated as a set of round keys for the encryption
 	// of the initial state.
 	//
-	// 'input' size must be a multiple of 64.
+	// 'input' size must be a multiple of 64, otherwise ErrInvalidLength is returned.
 	//
 	// For a 2 MiB input, this has the same security as 32768-round
 	// AES encryption.
 	//
 	// Hashing throughput: >20 GiB/s per CPU core with hardware AES
-	HashAes1Rx4(input []byte, output *[64]byte)
+	HashAes1Rx4(input []byte, output *[64]byte) error
 
 	// FillAes1Rx4
 	//
@@ -22,17 +27,17 @@ type AES interface {
 	// The state is encrypted using a single AES round per 16 bytes of output
 	// in 4 lanes.
 	//
-	// 'output' size must be a multiple of 64.
+	// 'output' size must be a multiple of 64, otherwise ErrInvalidLength is returned.
 	//
 	// The modified state is written back to 'state' to allow multiple
 	// calls to this function.
-	FillAes1Rx4(state *[64]byte, output []byte)
+	FillAes1Rx4(state *[64]byte, output []byte) error
 
 	// HashAndFillAes1Rx4 Hashes and fills scratchpad and output in one sweep
-	HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte)
+	HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte) error
 
 	// FillAes4Rx4 used to generate final program
 	//
 	// 'state' is copied when calling
-	FillAes4Rx4(state [64]byte, output []byte)
+	FillAes4Rx4(state [64]byte, keys *FillAes4Rx4Keys, output []byte) error
 }
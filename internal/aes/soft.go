@@ -13,9 +13,9 @@ func NewSoftAES() AES {
 	return softAES{}
 }
 
-func (aes softAES) HashAes1Rx4(input []byte, output *[64]byte) {
+func (aes softAES) HashAes1Rx4(input []byte, output *[64]byte) error {
 	if len(input)%len(output) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 	// states are copied
 	states := (*[4][4]uint32)(unsafe.Pointer(output))
@@ -32,11 +32,12 @@ func (aes softAES) HashAes1Rx4(input []byte, output *[64]byte) {
 	soft_aesroundtrip_encdec1(states, &keys.AesHash1R_XKeys[1])
 
 	runtime.KeepAlive(output)
+	return nil
 }
 
-func (aes softAES) FillAes1Rx4(state *[64]byte, output []byte) {
+func (aes softAES) FillAes1Rx4(state *[64]byte, output []byte) error {
 	if len(output)%len(state) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 	// Reference to state without copying
 	states := (*[4][4]uint32)(unsafe.Pointer(state))
@@ -46,11 +47,12 @@ func (aes softAES) FillAes1Rx4(state *[64]byte, output []byte) {
 
 		copy(output[outptr:], state[:])
 	}
+	return nil
 }
 
-func (aes softAES) FillAes4Rx4(state [64]byte, output []byte) {
+func (aes softAES) FillAes4Rx4(state [64]byte, keys *FillAes4Rx4Keys, output []byte) error {
 	if len(output)%len(state) != 0 {
-		panic("unsupported")
+		return ErrInvalidLength
 	}
 
 	// state is copied on caller
@@ -59,17 +61,20 @@ func (aes softAES) FillAes4Rx4(state [64]byte, output []byte) {
 	states := (*[4][4]uint32)(unsafe.Pointer(&state))
 
 	for outptr := 0; outptr < len(output); outptr += len(state) {
-		soft_aesroundtrip_decenc(states, &fillAes4Rx4Keys0)
-		soft_aesroundtrip_decenc(states, &fillAes4Rx4Keys1)
-		soft_aesroundtrip_decenc(states, &fillAes4Rx4Keys2)
-		soft_aesroundtrip_decenc(states, &fillAes4Rx4Keys3)
+		soft_aesroundtrip_decenc(states, &keys[0])
+		soft_aesroundtrip_decenc(states, &keys[1])
+		soft_aesroundtrip_decenc(states, &keys[2])
+		soft_aesroundtrip_decenc(states, &keys[3])
 
 		copy(output[outptr:], state[:])
 	}
+	return nil
 }
 
-func (aes softAES) HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte) {
+func (aes softAES) HashAndFillAes1Rx4(scratchpad []byte, output *[64]byte, fillState *[64]byte) error {
 	//TODO
-	aes.HashAes1Rx4(scratchpad, output)
-	aes.FillAes1Rx4(fillState, scratchpad)
+	if err := aes.HashAes1Rx4(scratchpad, output); err != nil {
+		return err
+	}
+	return aes.FillAes1Rx4(fillState, scratchpad)
 }
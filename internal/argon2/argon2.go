@@ -1,35 +1,72 @@
+// Package argon2 implements the Argon2d memory filling used by the RandomX Cache.
+// Derived from golang.org/x/crypto/argon2, with external memory allocation and selectable block implementations.
 package argon2
 
 import (
 	"encoding/binary"
 	"golang.org/x/crypto/blake2b"
-)
-
-import (
-	_ "golang.org/x/crypto/argon2"
-	_ "unsafe"
+	"sync"
 )
 
 const BlockSize uint32 = 1024
 
 type Block [BlockSize / 8]uint64
 
-const syncPoints = 4
-
-//go:linkname initHash golang.org/x/crypto/argon2.initHash
-func initHash(password, salt, key, data []byte, time, memory, threads, keyLen uint32, mode int) [blake2b.Size + 8]byte
+const blockLength = int(BlockSize / 8)
 
-//go:linkname processBlocks golang.org/x/crypto/argon2.processBlocks
-func processBlocks(B []Block, time, memory, threads uint32, mode int)
+const (
+	syncPoints = 4
+	version    = 0x13
+	argon2d    = 0
+)
 
-//go:linkname blake2bHash golang.org/x/crypto/argon2.blake2bHash
-func blake2bHash(out []byte, in []byte)
+// Impl Computes the Argon2 compression function G of in1 and in2 into out, XORing into the previous contents of out when xor is set
+type Impl func(out, in1, in2 *Block, xor bool)
+
+// ImplGeneric Portable implementation, available on all platforms
+var ImplGeneric Impl = processBlockGeneric
+
+// ImplSSSE3 SSSE3 implementation, nil if unsupported on the current platform
+var ImplSSSE3 Impl
+
+// ImplAVX2 AVX2 implementation, nil if unsupported on the current platform
+var ImplAVX2 Impl
+
+func initHash(password, salt []byte, time, memory, threads, keyLen uint32, mode int) [blake2b.Size + 8]byte {
+	var (
+		h0     [blake2b.Size + 8]byte
+		params [24]byte
+		tmp    [4]byte
+	)
+
+	b2, _ := blake2b.New512(nil)
+	binary.LittleEndian.PutUint32(params[0:4], threads)
+	binary.LittleEndian.PutUint32(params[4:8], keyLen)
+	binary.LittleEndian.PutUint32(params[8:12], memory)
+	binary.LittleEndian.PutUint32(params[12:16], time)
+	binary.LittleEndian.PutUint32(params[16:20], version)
+	binary.LittleEndian.PutUint32(params[20:24], uint32(mode))
+	_, _ = b2.Write(params[:])
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(password)))
+	_, _ = b2.Write(tmp[:])
+	_, _ = b2.Write(password)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(salt)))
+	_, _ = b2.Write(tmp[:])
+	_, _ = b2.Write(salt)
+	// no secret key nor associated data
+	binary.LittleEndian.PutUint32(tmp[:], 0)
+	_, _ = b2.Write(tmp[:])
+	_, _ = b2.Write(tmp[:])
+	b2.Sum(h0[:0])
+	return h0
+}
 
-// initBlocks From golang.org/x/crypto/argon2.initBlocks with external memory allocation
+// initBlocks From golang.org/x/crypto/argon2.initBlocks with external memory allocation.
+// The remaining blocks are overwritten by the first pass, except the ones past the rounded memory.
 func initBlocks(B []Block, h0 *[blake2b.Size + 8]byte, memory, threads uint32) {
 	var block0 [1024]byte
 
-	clear(B)
+	clear(B[memory:])
 
 	for lane := uint32(0); lane < threads; lane++ {
 		j := lane * (memory / threads)
@@ -49,8 +86,80 @@ func initBlocks(B []Block, h0 *[blake2b.Size + 8]byte, memory, threads uint32) {
 	}
 }
 
-// BuildBlocks From golang.org/x/crypto/argon2.deriveKey without last deriveKey call and external memory allocation
-func BuildBlocks(B []Block, password, salt []byte, time, memory uint32, threads uint8) {
+// processBlocks From golang.org/x/crypto/argon2.processBlocks, reduced to Argon2d
+func processBlocks(B []Block, time, memory, threads uint32, processBlock Impl) {
+	lanes := memory / threads
+	segments := lanes / syncPoints
+
+	processSegment := func(n, slice, lane uint32, wg *sync.WaitGroup) {
+		index := uint32(0)
+		if n == 0 && slice == 0 {
+			index = 2 // we have already generated the first two blocks
+		}
+
+		offset := lane*lanes + slice*segments + index
+		for index < segments {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += lanes // last block in lane
+			}
+			random := B[prev][0]
+			newOffset := indexAlpha(random, lanes, segments, threads, n, slice, lane, index)
+			processBlock(&B[offset], &B[prev], &B[newOffset], n > 0)
+			index, offset = index+1, offset+1
+		}
+		if wg != nil {
+			wg.Done()
+		}
+	}
+
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			if threads == 1 {
+				processSegment(n, slice, 0, nil)
+				continue
+			}
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go processSegment(n, slice, lane, &wg)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+func indexAlpha(rand uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	m, s := 3*segments, ((slice+1)%syncPoints)*segments
+	if lane == refLane {
+		m += index
+	}
+	if n == 0 {
+		m, s = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			m += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		m--
+	}
+	return phi(rand, uint64(m), uint64(s), refLane, lanes)
+}
+
+func phi(rand, m, s uint64, lane, lanes uint32) uint32 {
+	p := rand & 0xFFFFFFFF
+	p = (p * p) >> 32
+	p = (p * m) >> 32
+	return lane*lanes + uint32((s+m-(p+1))%uint64(lanes))
+}
+
+// BuildBlocks From golang.org/x/crypto/argon2.deriveKey without last deriveKey call and external memory allocation.
+// impl selects the block implementation, ImplGeneric is used when nil.
+func BuildBlocks(B []Block, password, salt []byte, time, memory uint32, threads uint8, impl Impl) {
 	if time < 1 {
 		panic("argon2: number of rounds too small")
 	}
@@ -62,9 +171,12 @@ func BuildBlocks(B []Block, password, salt []byte, time, memory uint32, threads
 		panic("argon2: invalid block size")
 	}
 
-	const mode = 0 /* argon2d */
+	if impl == nil {
+		impl = ImplGeneric
+	}
+
 	const keyLen = 0
-	h0 := initHash(password, salt, nil, nil, time, memory, uint32(threads), keyLen, mode)
+	h0 := initHash(password, salt, time, memory, uint32(threads), keyLen, argon2d)
 
 	memory = memory / (syncPoints * uint32(threads)) * (syncPoints * uint32(threads))
 	if memory < 2*syncPoints*uint32(threads) {
@@ -72,5 +184,5 @@ func BuildBlocks(B []Block, password, salt []byte, time, memory uint32, threads
 	}
 
 	initBlocks(B, &h0, memory, uint32(threads))
-	processBlocks(B, time, memory, uint32(threads), mode)
+	processBlocks(B, time, memory, uint32(threads), impl)
 }
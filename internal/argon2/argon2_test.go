@@ -0,0 +1,82 @@
+package argon2
+
+import (
+	"math/rand"
+	"testing"
+)
+
+type testImpl struct {
+	name string
+	impl Impl
+}
+
+// testImpls Implementations supported on this platform, generic first
+func testImpls() (impls []testImpl) {
+	impls = append(impls, testImpl{"generic", ImplGeneric})
+	if ImplSSSE3 != nil {
+		impls = append(impls, testImpl{"ssse3", ImplSSSE3})
+	}
+	if ImplAVX2 != nil {
+		impls = append(impls, testImpl{"avx2", ImplAVX2})
+	}
+	return impls
+}
+
+func Test_Impl(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(0))
+	var in1, in2, prev Block
+	for i := range in1 {
+		in1[i] = rng.Uint64()
+		in2[i] = rng.Uint64()
+		prev[i] = rng.Uint64()
+	}
+
+	for _, xor := range []bool{false, true} {
+		expected := prev
+		processBlockGeneric(&expected, &in1, &in2, xor)
+
+		for _, impl := range testImpls()[1:] {
+			out := prev
+			impl.impl(&out, &in1, &in2, xor)
+			if out != expected {
+				t.Errorf("%s xor=%v: mismatch with generic implementation", impl.name, xor)
+			}
+		}
+	}
+}
+
+func Test_BuildBlocks(t *testing.T) {
+	t.Parallel()
+
+	const memory = 256
+	expected := make([]Block, memory)
+	BuildBlocks(expected, []byte("test key 000"), []byte("RandomX\x03"), 3, memory, 2, ImplGeneric)
+
+	for _, impl := range testImpls()[1:] {
+		blocks := make([]Block, memory)
+		BuildBlocks(blocks, []byte("test key 000"), []byte("RandomX\x03"), 3, memory, 2, impl.impl)
+		for i := range blocks {
+			if blocks[i] != expected[i] {
+				t.Fatalf("%s: block %d mismatch with generic implementation", impl.name, i)
+			}
+		}
+	}
+}
+
+func Benchmark_BuildBlocks(b *testing.B) {
+	const memory = 4096
+	blocks := make([]Block, memory)
+
+	for _, impl := range testImpls() {
+		impl := impl
+		b.Run(impl.name, func(b *testing.B) {
+			b.SetBytes(memory * int64(BlockSize))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BuildBlocks(blocks, []byte("test key 000"), []byte("RandomX\x03"), 3, memory, 1, impl.impl)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+//go:build amd64 && !purego
+
+package argon2
+
+import "golang.org/x/sys/cpu"
+
+func init() {
+	if cpu.X86.HasSSSE3 {
+		ImplSSSE3 = processBlockSSSE3
+	}
+	if cpu.X86.HasAVX2 {
+		ImplAVX2 = processBlockAVX2
+	}
+}
+
+//go:noescape
+func mixBlocksSSE2(out, a, b, c *Block)
+
+//go:noescape
+func xorBlocksSSE2(out, a, b, c *Block)
+
+//go:noescape
+func blamkaSSSE3(b *Block)
+
+// processBlockSSSE3 From golang.org/x/crypto/argon2.processBlockSSE
+func processBlockSSSE3(out, in1, in2 *Block, xor bool) {
+	var t Block
+	mixBlocksSSE2(&t, in1, in2, &t)
+	blamkaSSSE3(&t)
+	if xor {
+		xorBlocksSSE2(out, in1, in2, &t)
+	} else {
+		mixBlocksSSE2(out, in1, in2, &t)
+	}
+}
+
+// blamkaAVX2 Computes the row rounds of in1 ^ in2 into scratch t, then the column rounds of t directly into out
+//
+//go:noescape
+func blamkaAVX2(out, in1, in2, t *Block, xor bool)
+
+func processBlockAVX2(out, in1, in2 *Block, xor bool) {
+	var t Block
+	blamkaAVX2(out, in1, in2, &t, xor)
+}
@@ -0,0 +1,189 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// rotate right by 24 and 16 within each 64-bit lane, repeated for both 128-bit halves
+DATA ·c40avx2<>+0x00(SB)/8, $0x0201000706050403
+DATA ·c40avx2<>+0x08(SB)/8, $0x0a09080f0e0d0c0b
+DATA ·c40avx2<>+0x10(SB)/8, $0x0201000706050403
+DATA ·c40avx2<>+0x18(SB)/8, $0x0a09080f0e0d0c0b
+GLOBL ·c40avx2<>(SB), (NOPTR+RODATA), $32
+
+DATA ·c48avx2<>+0x00(SB)/8, $0x0100070605040302
+DATA ·c48avx2<>+0x08(SB)/8, $0x09080f0e0d0c0b0a
+DATA ·c48avx2<>+0x10(SB)/8, $0x0100070605040302
+DATA ·c48avx2<>+0x18(SB)/8, $0x09080f0e0d0c0b0a
+GLOBL ·c48avx2<>(SB), (NOPTR+RODATA), $32
+
+// Two BlaMka permutations are computed in parallel, one per register group.
+// Each group holds 16 words as a = v0..v3, b = v4..v7, c = v8..v11, d = v12..v15,
+// so one G application covers all four columns or, after diagonalization, all four diagonals.
+// Temporaries: Y8, Y9. Constants: Y14 = c40, Y15 = c48.
+
+// a += b + 2 * lo32(a) * lo32(b)
+#define FBLAMKA(a0, b0, a1, b1) \
+	VPMULUDQ b0, a0, Y8; \
+	VPMULUDQ b1, a1, Y9; \
+	VPADDQ   b0, a0, a0; \
+	VPADDQ   b1, a1, a1; \
+	VPADDQ   Y8, a0, a0; \
+	VPADDQ   Y9, a1, a1; \
+	VPADDQ   Y8, a0, a0; \
+	VPADDQ   Y9, a1, a1
+
+#define HALF_ROUND(a0, b0, c0, d0, a1, b1, c1, d1) \
+	FBLAMKA(a0, b0, a1, b1);  \
+	VPXOR   a0, d0, d0;       \
+	VPXOR   a1, d1, d1;       \
+	VPSHUFD $0xB1, d0, d0;    \
+	VPSHUFD $0xB1, d1, d1;    \
+	FBLAMKA(c0, d0, c1, d1);  \
+	VPXOR   c0, b0, b0;       \
+	VPXOR   c1, b1, b1;       \
+	VPSHUFB Y14, b0, b0;      \
+	VPSHUFB Y14, b1, b1;      \
+	FBLAMKA(a0, b0, a1, b1);  \
+	VPXOR   a0, d0, d0;       \
+	VPXOR   a1, d1, d1;       \
+	VPSHUFB Y15, d0, d0;      \
+	VPSHUFB Y15, d1, d1;      \
+	FBLAMKA(c0, d0, c1, d1);  \
+	VPXOR   c0, b0, b0;       \
+	VPXOR   c1, b1, b1;       \
+	VPADDQ  b0, b0, Y8;       \
+	VPADDQ  b1, b1, Y9;       \
+	VPSRLQ  $63, b0, b0;      \
+	VPSRLQ  $63, b1, b1;      \
+	VPXOR   Y8, b0, b0;       \
+	VPXOR   Y9, b1, b1
+
+// b = v5 v6 v7 v4, c = v10 v11 v8 v9, d = v15 v12 v13 v14
+#define DIAGONALIZE(b, c, d) \
+	VPERMQ $0x39, b, b; \
+	VPERMQ $0x4E, c, c; \
+	VPERMQ $0x93, d, d
+
+#define UNDIAGONALIZE(b, c, d) \
+	VPERMQ $0x93, b, b; \
+	VPERMQ $0x4E, c, c; \
+	VPERMQ $0x39, d, d
+
+#define ROUND \
+	HALF_ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7); \
+	DIAGONALIZE(Y1, Y2, Y3);                    \
+	DIAGONALIZE(Y5, Y6, Y7);                    \
+	HALF_ROUND(Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7); \
+	UNDIAGONALIZE(Y1, Y2, Y3);                  \
+	UNDIAGONALIZE(Y5, Y6, Y7)
+
+// ROWS Loads in1 ^ in2 for rows at off and off+128, applies the permutation and stores into t
+#define ROWS(off) \
+	VMOVDQU off+0(BX), Y0;     \
+	VMOVDQU off+32(BX), Y1;    \
+	VMOVDQU off+64(BX), Y2;    \
+	VMOVDQU off+96(BX), Y3;    \
+	VMOVDQU off+128(BX), Y4;   \
+	VMOVDQU off+160(BX), Y5;   \
+	VMOVDQU off+192(BX), Y6;   \
+	VMOVDQU off+224(BX), Y7;   \
+	VPXOR   off+0(CX), Y0, Y0;   \
+	VPXOR   off+32(CX), Y1, Y1;  \
+	VPXOR   off+64(CX), Y2, Y2;  \
+	VPXOR   off+96(CX), Y3, Y3;  \
+	VPXOR   off+128(CX), Y4, Y4; \
+	VPXOR   off+160(CX), Y5, Y5; \
+	VPXOR   off+192(CX), Y6, Y6; \
+	VPXOR   off+224(CX), Y7, Y7; \
+	ROUND;                     \
+	VMOVDQU Y0, off+0(DX);     \
+	VMOVDQU Y1, off+32(DX);    \
+	VMOVDQU Y2, off+64(DX);    \
+	VMOVDQU Y3, off+96(DX);    \
+	VMOVDQU Y4, off+128(DX);   \
+	VMOVDQU Y5, off+160(DX);   \
+	VMOVDQU Y6, off+192(DX);   \
+	VMOVDQU Y7, off+224(DX)
+
+// a column quarter is the word pair at off and the one a row below
+#define LOAD_COLUMN(off, y, x) \
+	VMOVDQU     off(DX), x; \
+	VINSERTI128 $1, off+128(DX), y, y
+
+#define LOAD_COLUMNS(off) \
+	LOAD_COLUMN(off+0, Y0, X0);    \
+	LOAD_COLUMN(off+256, Y1, X1);  \
+	LOAD_COLUMN(off+512, Y2, X2);  \
+	LOAD_COLUMN(off+768, Y3, X3);  \
+	LOAD_COLUMN(off+16, Y4, X4);   \
+	LOAD_COLUMN(off+272, Y5, X5);  \
+	LOAD_COLUMN(off+528, Y6, X6);  \
+	LOAD_COLUMN(off+784, Y7, X7)
+
+// STORE_COLUMN out = in1 ^ in2 ^ t
+#define STORE_COLUMN(off, y, x) \
+	VMOVDQU     off(BX), X10;               \
+	VINSERTI128 $1, off+128(BX), Y10, Y10;  \
+	VMOVDQU     off(CX), X11;               \
+	VINSERTI128 $1, off+128(CX), Y11, Y11;  \
+	VPXOR       Y10, y, y;                  \
+	VPXOR       Y11, y, y;                  \
+	VMOVDQU     x, off(AX);                 \
+	VEXTRACTI128 $1, y, off+128(AX)
+
+// STORE_COLUMN_XOR out ^= in1 ^ in2 ^ t
+#define STORE_COLUMN_XOR(off, y, x) \
+	VMOVDQU     off(AX), X12;               \
+	VINSERTI128 $1, off+128(AX), Y12, Y12;  \
+	VPXOR       Y12, y, y;                  \
+	STORE_COLUMN(off, y, x)
+
+#define STORE_COLUMNS(off, store) \
+	store(off+0, Y0, X0);    \
+	store(off+256, Y1, X1);  \
+	store(off+512, Y2, X2);  \
+	store(off+768, Y3, X3);  \
+	store(off+16, Y4, X4);   \
+	store(off+272, Y5, X5);  \
+	store(off+528, Y6, X6);  \
+	store(off+784, Y7, X7)
+
+#define COLUMNS(off, store) \
+	LOAD_COLUMNS(off); \
+	ROUND;             \
+	STORE_COLUMNS(off, store)
+
+// func blamkaAVX2(out, in1, in2, t *Block, xor bool)
+TEXT ·blamkaAVX2(SB), NOSPLIT|NOFRAME, $0-33
+	MOVQ   out+0(FP), AX
+	MOVQ   in1+8(FP), BX
+	MOVQ   in2+16(FP), CX
+	MOVQ   t+24(FP), DX
+	MOVBLZX xor+32(FP), SI
+
+	VMOVDQU ·c40avx2<>(SB), Y14
+	VMOVDQU ·c48avx2<>(SB), Y15
+
+	ROWS(0)
+	ROWS(256)
+	ROWS(512)
+	ROWS(768)
+
+	TESTL SI, SI
+	JNZ   xor
+
+	COLUMNS(0, STORE_COLUMN)
+	COLUMNS(32, STORE_COLUMN)
+	COLUMNS(64, STORE_COLUMN)
+	COLUMNS(96, STORE_COLUMN)
+
+	VZEROUPPER
+	RET
+
+xor:
+	COLUMNS(0, STORE_COLUMN_XOR)
+	COLUMNS(32, STORE_COLUMN_XOR)
+	COLUMNS(64, STORE_COLUMN_XOR)
+	COLUMNS(96, STORE_COLUMN_XOR)
+
+	VZEROUPPER
+	RET
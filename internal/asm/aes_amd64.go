@@ -8,6 +8,16 @@ func FillAes1Rx4(states *[4][4]uint32, keys *[4][4]uint32, output *byte, outputL
 //go:noescape
 func HashAes1Rx4(initialState *[4][4]uint32, xKeys *[2][4]uint32, output *[64]byte, input *byte, inputLen uint64)
 
+// HashAndFillAes1Rx4 Hashes the contents of scratchpad like HashAes1Rx4 while overwriting them like FillAes1Rx4, in a single pass
+//
+//go:noescape
+func HashAndFillAes1Rx4(hashState *[4][4]uint32, xKeys *[2][4]uint32, output *[64]byte, fillStates *[4][4]uint32, fillKeys *[4][4]uint32, scratchpad *byte, scratchpadLen uint64)
+
+// FillAes4Rx4 Fills output with 4 rounds of AES per 64 bytes, using keys[round][column]
+//
+//go:noescape
+func FillAes4Rx4(states *[4][4]uint32, keys *[4][4][4]uint32, output *byte, outputLen uint64)
+
 //go:noescape
 func AESRoundTrip_DecEnc(states *[4][4]uint32, keys *[4][4]uint32)
 
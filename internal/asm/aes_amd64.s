@@ -170,3 +170,154 @@ TEXT ·AESRoundTrip_EncDec1(SB),NOSPLIT|NOFRAME,$0-16
 	VMOVDQU X4, 48(AX)
 	RET
 
+
+TEXT ·HashAndFillAes1Rx4(SB),NOSPLIT|NOFRAME,$0-56
+	MOVQ hashState+0(FP), AX
+	MOVQ fillStates+24(FP), BX
+	MOVQ fillKeys+32(FP), SI
+	MOVQ scratchpad+40(FP), CX
+	MOVQ scratchpadLen+48(FP), DX
+
+    // hash state: X0-X3
+	VMOVDQU 0(AX), X0
+	VMOVDQU 16(AX), X1
+	VMOVDQU 32(AX), X2
+	VMOVDQU 48(AX), X3
+
+    // fill state: X4-X7
+	VMOVDQU 0(BX), X4
+	VMOVDQU 16(BX), X5
+	VMOVDQU 32(BX), X6
+	VMOVDQU 48(BX), X7
+
+    // fill keys: X12-X15
+	VMOVDQU 0(SI), X12
+	VMOVDQU 16(SI), X13
+	VMOVDQU 32(SI), X14
+	VMOVDQU 48(SI), X15
+
+	TESTQ DX, DX
+	JZ finalize
+
+loop:
+    // scratchpad contents as hash keys: X8-X11
+	VMOVDQU 0(CX), X8
+	VMOVDQU 16(CX), X9
+	VMOVDQU 32(CX), X10
+	VMOVDQU 48(CX), X11
+
+	AESENC X8, X0
+	AESDEC X9, X1
+	AESENC X10, X2
+	AESDEC X11, X3
+
+	AESDEC X12, X4
+	AESENC X13, X5
+	AESDEC X14, X6
+	AESENC X15, X7
+
+    // overwrite the hashed contents with the fill state
+	VMOVDQU X4, 0(CX)
+	VMOVDQU X5, 16(CX)
+	VMOVDQU X6, 32(CX)
+	VMOVDQU X7, 48(CX)
+	ADDQ $64, CX
+
+    // scratchpadLen -= 64, continue if not 0
+	SUBQ $64, DX
+	JNE loop
+
+    // offload fill state
+	VMOVDQU X4, 0(BX)
+	VMOVDQU X5, 16(BX)
+	VMOVDQU X6, 32(BX)
+	VMOVDQU X7, 48(BX)
+
+finalize:
+	MOVQ xKeys+8(FP), AX
+	MOVQ output+16(FP), BX
+
+    // do encdec1 with both keys!
+	VMOVDQU 0(AX), X8
+	VMOVDQU 16(AX), X9
+
+	AESENC X8, X0
+	AESDEC X8, X1
+	AESENC X8, X2
+	AESDEC X8, X3
+
+	AESENC X9, X0
+	AESDEC X9, X1
+	AESENC X9, X2
+	AESDEC X9, X3
+
+    // offload into output
+	VMOVDQU X0, 0(BX)
+	VMOVDQU X1, 16(BX)
+	VMOVDQU X2, 32(BX)
+	VMOVDQU X3, 48(BX)
+	RET
+
+TEXT ·FillAes4Rx4(SB),NOSPLIT|NOFRAME,$0-32
+	MOVQ states+0(FP), AX
+	MOVQ keys+8(FP), BX
+	MOVQ output+16(FP), CX
+	MOVQ outputLen+24(FP), DX
+
+    // state: X0-X3
+	VMOVDQU 0(AX), X0
+	VMOVDQU 16(AX), X1
+	VMOVDQU 32(AX), X2
+	VMOVDQU 48(AX), X3
+
+    // keys of the first three rounds: X4-X15, the last round is read from memory
+	VMOVDQU 0(BX), X4
+	VMOVDQU 16(BX), X5
+	VMOVDQU 32(BX), X6
+	VMOVDQU 48(BX), X7
+	VMOVDQU 64(BX), X8
+	VMOVDQU 80(BX), X9
+	VMOVDQU 96(BX), X10
+	VMOVDQU 112(BX), X11
+	VMOVDQU 128(BX), X12
+	VMOVDQU 144(BX), X13
+	VMOVDQU 160(BX), X14
+	VMOVDQU 176(BX), X15
+
+	TESTQ DX, DX
+	JZ done
+
+loop:
+	AESDEC X4, X0
+	AESENC X5, X1
+	AESDEC X6, X2
+	AESENC X7, X3
+
+	AESDEC X8, X0
+	AESENC X9, X1
+	AESDEC X10, X2
+	AESENC X11, X3
+
+	AESDEC X12, X0
+	AESENC X13, X1
+	AESDEC X14, X2
+	AESENC X15, X3
+
+	VAESDEC 192(BX), X0, X0
+	VAESENC 208(BX), X1, X1
+	VAESDEC 224(BX), X2, X2
+	VAESENC 240(BX), X3, X3
+
+    // store state onto output
+	VMOVDQU X0, 0(CX)
+	VMOVDQU X1, 16(CX)
+	VMOVDQU X2, 32(CX)
+	VMOVDQU X3, 48(CX)
+	ADDQ $64, CX
+
+    // outputLen -= 64, continue if not 0
+	SUBQ $64, DX
+	JNE loop
+
+done:
+	RET
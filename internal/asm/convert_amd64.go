@@ -0,0 +1,8 @@
+//go:build amd64 && !purego
+
+package asm
+
+// ConvertInt32Line Converts the 16 signed 32-bit integers of src into dst, two at a time with CVTDQ2PD
+//
+//go:noescape
+func ConvertInt32Line(dst *[8][2]float64, src *[16]int32)
@@ -0,0 +1,26 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+TEXT ·ConvertInt32Line(SB),NOSPLIT|NOFRAME,$0-16
+	MOVQ dst+0(FP), AX
+	MOVQ src+8(FP), BX
+
+	CVTPL2PD 0(BX), X0
+	CVTPL2PD 8(BX), X1
+	CVTPL2PD 16(BX), X2
+	CVTPL2PD 24(BX), X3
+	CVTPL2PD 32(BX), X4
+	CVTPL2PD 40(BX), X5
+	CVTPL2PD 48(BX), X6
+	CVTPL2PD 56(BX), X7
+
+	MOVUPD X0, 0(AX)
+	MOVUPD X1, 16(AX)
+	MOVUPD X2, 32(AX)
+	MOVUPD X3, 48(AX)
+	MOVUPD X4, 64(AX)
+	MOVUPD X5, 80(AX)
+	MOVUPD X6, 96(AX)
+	MOVUPD X7, 112(AX)
+	RET
@@ -0,0 +1,10 @@
+//go:build !amd64 || purego
+
+package asm
+
+// ConvertInt32Line Converts the 16 signed 32-bit integers of src into dst
+func ConvertInt32Line(dst *[8][2]float64, src *[16]int32) {
+	for i := range dst {
+		dst[i] = [2]float64{float64(src[i*2]), float64(src[i*2+1])}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+TEXT ·PrefetchNTA(SB),NOSPLIT|NOFRAME,$0-8
+	MOVQ p+0(FP), AX
+	PREFETCHNTA 0(AX)
+	RET
@@ -0,0 +1,8 @@
+//go:build arm64 && !purego
+
+#include "textflag.h"
+
+TEXT ·PrefetchNTA(SB),NOSPLIT|NOFRAME,$0-8
+	MOVD p+0(FP), R0
+	PRFM (R0), PLDL1STRM
+	RET
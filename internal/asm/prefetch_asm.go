@@ -0,0 +1,10 @@
+//go:build (amd64 || arm64) && !purego
+
+package asm
+
+import "unsafe"
+
+// PrefetchNTA Hints the CPU to fetch the cache line at p, with minimal cache pollution
+//
+//go:noescape
+func PrefetchNTA(p unsafe.Pointer)
@@ -0,0 +1,10 @@
+//go:build (!amd64 && !arm64) || purego
+
+package asm
+
+import "unsafe"
+
+// PrefetchNTA No-op where no prefetch instruction is available
+func PrefetchNTA(p unsafe.Pointer) {
+
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package memory
+
+// NewFileAllocator Not supported in platform
+func NewFileAllocator(fd uintptr) Allocator {
+	return nil
+}
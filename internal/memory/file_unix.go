@@ -0,0 +1,33 @@
+//go:build unix
+
+package memory
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// FileAllocator Maps a file read-only and shared from its start, so multiple processes share the same page cache
+type FileAllocator struct {
+	fd int
+}
+
+func NewFileAllocator(fd uintptr) Allocator {
+	return FileAllocator{fd: int(fd)}
+}
+
+func (a FileAllocator) AllocMemory(size uint64) ([]byte, error) {
+	memory, err := unix.Mmap(a.fd, 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return memory, nil
+}
+
+func (a FileAllocator) FreeMemory(memory []byte) error {
+	if memory == nil {
+		return nil
+	}
+
+	return unix.Munmap(memory)
+}
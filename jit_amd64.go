@@ -58,7 +58,13 @@ func alignSize[T ~uintptr | ~uint32 | ~uint64 | ~int64 | ~int32 | ~int](pos, ali
 	return ((pos-1)/align + 1) * align
 }
 
-var RandomXCodeSize = alignSize[uint64](ReserveCodeSize+MaxRandomXInstrCodeSize*RANDOMX_PROGRAM_SIZE, CodeAlign)
+var RandomXCodeSize = randomXCodeSize(RANDOMX_PROGRAM_SIZE)
+
+// randomXCodeSize JIT code size for a program with programSize instructions
+func randomXCodeSize(programSize uint32) uint64 {
+	return alignSize[uint64](ReserveCodeSize+MaxRandomXInstrCodeSize*uint64(programSize), CodeAlign)
+}
+
 var SuperscalarSize = alignSize[uint64](ReserveCodeSize+(SuperscalarProgramHeader+MaxSuperscalarInstrSize*SuperscalarMaxSize)*RANDOMX_CACHE_ACCESSES, CodeAlign)
 
 var CodeSize = uint32(RandomXCodeSize + SuperscalarSize)
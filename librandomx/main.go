@@ -0,0 +1,231 @@
+// Command librandomx exports the C API of randomx.h, see randomx.h in this directory.
+// Build it as a shared library with -buildmode=c-shared, or as a static library with -buildmode=c-archive.
+//
+// Errors that the reference implementation reports via assertions, such as hashing with an uninitialized Cache,
+// abort the process with a message on stderr.
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+struct randomx_cache {
+	uintptr_t handle;
+};
+struct randomx_dataset {
+	uintptr_t handle;
+};
+struct randomx_vm {
+	uintptr_t handle;
+};
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/cgo"
+	"unsafe"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+func main() {}
+
+// fatal Aborts the process on API misuse
+func fatal(function string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", function, err)
+	C.abort()
+}
+
+// object Value referenced by a handle, along with the memory that C may hold pointers to
+type object struct {
+	value  any
+	memory unsafe.Pointer
+	pinner runtime.Pinner
+}
+
+// newHandle Allocates a C struct holding a handle to v
+// memory, if not nil, stays pinned until the handle is freed, so it can be handed out to C
+func newHandle[T any](v any, memory unsafe.Pointer) *T {
+	obj := &object{value: v, memory: memory}
+	if memory != nil {
+		obj.pinner.Pin(memory)
+	}
+
+	p := (*T)(C.malloc(C.size_t(unsafe.Sizeof(C.uintptr_t(0)))))
+	*(*C.uintptr_t)(unsafe.Pointer(p)) = C.uintptr_t(cgo.NewHandle(obj))
+	return p
+}
+
+func handleObject[T any](p *T) *object {
+	return cgo.Handle(*(*C.uintptr_t)(unsafe.Pointer(p))).Value().(*object)
+}
+
+// value Returns the value referenced by a C struct allocated via newHandle
+func value[V any, T any](p *T) V {
+	return handleObject(p).value.(V)
+}
+
+// freeHandle Releases a C struct allocated via newHandle
+func freeHandle[T any](p *T) {
+	handleObject(p).pinner.Unpin()
+	cgo.Handle(*(*C.uintptr_t)(unsafe.Pointer(p))).Delete()
+	C.free(unsafe.Pointer(p))
+}
+
+func bytes(p unsafe.Pointer, size C.size_t) []byte {
+	if size == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(p), int(size))
+}
+
+//export randomx_get_flags
+func randomx_get_flags() C.int {
+	return C.int(randomx.GetFlags())
+}
+
+//export randomx_alloc_cache
+func randomx_alloc_cache(flags C.int) *C.struct_randomx_cache {
+	cache, err := randomx.NewCache(randomx.Flags(flags))
+	if err != nil {
+		return nil
+	}
+	return newHandle[C.struct_randomx_cache](cache, unsafe.Pointer(unsafe.SliceData(cache.Memory())))
+}
+
+//export randomx_init_cache
+func randomx_init_cache(cache *C.struct_randomx_cache, key unsafe.Pointer, keySize C.size_t) {
+	if err := value[*randomx.Cache](cache).Init(bytes(key, keySize)); err != nil {
+		fatal("randomx_init_cache", err)
+	}
+}
+
+//export randomx_get_cache_memory
+func randomx_get_cache_memory(cache *C.struct_randomx_cache) unsafe.Pointer {
+	return handleObject(cache).memory
+}
+
+//export randomx_release_cache
+func randomx_release_cache(cache *C.struct_randomx_cache) {
+	if cache == nil {
+		return
+	}
+	_ = value[*randomx.Cache](cache).Close()
+	freeHandle(cache)
+}
+
+//export randomx_alloc_dataset
+func randomx_alloc_dataset(flags C.int) *C.struct_randomx_dataset {
+	dataset, err := randomx.NewDataset(randomx.Flags(flags))
+	if err != nil {
+		return nil
+	}
+	return newHandle[C.struct_randomx_dataset](dataset, unsafe.Pointer(unsafe.SliceData(dataset.Memory())))
+}
+
+//export randomx_dataset_item_count
+func randomx_dataset_item_count() C.ulong {
+	return C.ulong(randomx.DatasetItemCount)
+}
+
+//export randomx_init_dataset
+func randomx_init_dataset(dataset *C.struct_randomx_dataset, cache *C.struct_randomx_cache, startItem, itemCount C.ulong) {
+	if err := value[*randomx.Dataset](dataset).InitDataset(value[*randomx.Cache](cache), uint64(startItem), uint64(itemCount)); err != nil {
+		fatal("randomx_init_dataset", err)
+	}
+}
+
+//export randomx_get_dataset_memory
+func randomx_get_dataset_memory(dataset *C.struct_randomx_dataset) unsafe.Pointer {
+	return handleObject(dataset).memory
+}
+
+//export randomx_release_dataset
+func randomx_release_dataset(dataset *C.struct_randomx_dataset) {
+	if dataset == nil {
+		return
+	}
+	_ = value[*randomx.Dataset](dataset).Close()
+	freeHandle(dataset)
+}
+
+//export randomx_create_vm
+func randomx_create_vm(flags C.int, cache *C.struct_randomx_cache, dataset *C.struct_randomx_dataset) *C.struct_randomx_vm {
+	f := randomx.Flags(flags)
+
+	// as in the reference, the Cache is ignored in full mode and the Dataset in light mode
+	var c *randomx.Cache
+	var d *randomx.Dataset
+	if f.Has(randomx.RANDOMX_FLAG_FULL_MEM) {
+		if dataset != nil {
+			d = value[*randomx.Dataset](dataset)
+		}
+	} else if cache != nil {
+		c = value[*randomx.Cache](cache)
+	}
+
+	vm, err := randomx.NewVM(f, c, d)
+	if err != nil {
+		return nil
+	}
+	return newHandle[C.struct_randomx_vm](vm, nil)
+}
+
+//export randomx_vm_set_cache
+func randomx_vm_set_cache(machine *C.struct_randomx_vm, cache *C.struct_randomx_cache) {
+	if err := value[*randomx.VM](machine).SetCache(value[*randomx.Cache](cache)); err != nil {
+		fatal("randomx_vm_set_cache", err)
+	}
+}
+
+//export randomx_vm_set_dataset
+func randomx_vm_set_dataset(machine *C.struct_randomx_vm, dataset *C.struct_randomx_dataset) {
+	if err := value[*randomx.VM](machine).SetDataset(value[*randomx.Dataset](dataset)); err != nil {
+		fatal("randomx_vm_set_dataset", err)
+	}
+}
+
+//export randomx_destroy_vm
+func randomx_destroy_vm(machine *C.struct_randomx_vm) {
+	if machine == nil {
+		return
+	}
+	_ = value[*randomx.VM](machine).Close()
+	freeHandle(machine)
+}
+
+//export randomx_calculate_hash
+func randomx_calculate_hash(machine *C.struct_randomx_vm, input unsafe.Pointer, inputSize C.size_t, output unsafe.Pointer) {
+	if err := value[*randomx.VM](machine).CalculateHash(bytes(input, inputSize), (*[randomx.RANDOMX_HASH_SIZE]byte)(output)); err != nil {
+		fatal("randomx_calculate_hash", err)
+	}
+}
+
+//export randomx_calculate_hash_first
+func randomx_calculate_hash_first(machine *C.struct_randomx_vm, input unsafe.Pointer, inputSize C.size_t) {
+	if err := value[*randomx.VM](machine).CalculateHashFirst(bytes(input, inputSize)); err != nil {
+		fatal("randomx_calculate_hash_first", err)
+	}
+}
+
+//export randomx_calculate_hash_next
+func randomx_calculate_hash_next(machine *C.struct_randomx_vm, nextInput unsafe.Pointer, nextInputSize C.size_t, output unsafe.Pointer) {
+	if err := value[*randomx.VM](machine).CalculateHashNext(bytes(nextInput, nextInputSize), (*[randomx.RANDOMX_HASH_SIZE]byte)(output)); err != nil {
+		fatal("randomx_calculate_hash_next", err)
+	}
+}
+
+//export randomx_calculate_hash_last
+func randomx_calculate_hash_last(machine *C.struct_randomx_vm, output unsafe.Pointer) {
+	if err := value[*randomx.VM](machine).CalculateHashLast((*[randomx.RANDOMX_HASH_SIZE]byte)(output)); err != nil {
+		fatal("randomx_calculate_hash_last", err)
+	}
+}
+
+//export randomx_calculate_commitment
+func randomx_calculate_commitment(input unsafe.Pointer, inputSize C.size_t, hashIn unsafe.Pointer, comOut unsafe.Pointer) {
+	randomx.CalculateCommitment(bytes(input, inputSize), (*[randomx.RANDOMX_HASH_SIZE]byte)(hashIn), (*[randomx.RANDOMX_HASH_SIZE]byte)(comOut))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Test_CAPI Builds the shared library and runs the C test program against it
+func Test_CAPI(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("test program is built for unix-like systems")
+	}
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler found")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	dir := t.TempDir()
+
+	build := exec.Command(goTool, "build", "-buildmode=c-shared", "-o", filepath.Join(dir, "librandomx.so"), ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building library: %s\n%s", err, out)
+	}
+
+	compile := exec.Command(cc, "-o", filepath.Join(dir, "tests"), filepath.Join("tests", "tests.c"), "-I.", "-L"+dir, "-lrandomx", "-lpthread")
+	if out, err := compile.CombinedOutput(); err != nil {
+		t.Fatalf("compiling test program: %s\n%s", err, out)
+	}
+
+	test := exec.Command(filepath.Join(dir, "tests"))
+	test.Env = append(os.Environ(), "LD_LIBRARY_PATH="+dir, "DYLD_LIBRARY_PATH="+dir)
+	out, err := test.CombinedOutput()
+	t.Logf("%s", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,157 @@
+/*
+ * C API of go-randomx, compatible with randomx.h of the reference implementation.
+ * Build the library with:
+ *
+ *   go build -buildmode=c-shared -o librandomx.so ./librandomx
+ *
+ * Flag values and function signatures match the reference, so programs written against its randomx.h
+ * can be linked against this library instead.
+ */
+
+#ifndef RANDOMX_H
+#define RANDOMX_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define RANDOMX_HASH_SIZE 32
+#define RANDOMX_DATASET_ITEM_SIZE 64
+
+#ifndef RANDOMX_EXPORT
+#define RANDOMX_EXPORT
+#endif
+
+typedef enum {
+  RANDOMX_FLAG_DEFAULT = 0,
+  RANDOMX_FLAG_LARGE_PAGES = 1,
+  RANDOMX_FLAG_HARD_AES = 2,
+  RANDOMX_FLAG_FULL_MEM = 4,
+  RANDOMX_FLAG_JIT = 8,
+  RANDOMX_FLAG_SECURE = 16,
+  RANDOMX_FLAG_ARGON2_SSSE3 = 32,
+  RANDOMX_FLAG_ARGON2_AVX2 = 64,
+  RANDOMX_FLAG_ARGON2 = 96
+} randomx_flags;
+
+typedef struct randomx_dataset randomx_dataset;
+typedef struct randomx_cache randomx_cache;
+typedef struct randomx_vm randomx_vm;
+
+#if defined(__cplusplus)
+extern "C" {
+#endif
+
+/**
+ * @return The recommended flags to be used on the current machine.
+ *         Does not include RANDOMX_FLAG_LARGE_PAGES, RANDOMX_FLAG_FULL_MEM and RANDOMX_FLAG_SECURE.
+ */
+RANDOMX_EXPORT randomx_flags randomx_get_flags(void);
+
+/**
+ * Creates a randomx_cache structure and allocates memory for RandomX Cache.
+ *
+ * @return Pointer to an allocated randomx_cache structure, or NULL if allocation fails.
+ */
+RANDOMX_EXPORT randomx_cache *randomx_alloc_cache(randomx_flags flags);
+
+/**
+ * Initializes the cache memory and SuperscalarHash using the provided key value.
+ * Does nothing if called again with the same key value.
+ */
+RANDOMX_EXPORT void randomx_init_cache(randomx_cache *cache, const void *key, size_t keySize);
+
+/**
+ * Returns a pointer to the internal memory buffer of the cache structure. The size
+ * of the internal memory buffer is 256 MiB.
+ *
+ * @param cache is a pointer to a previously allocated randomx_cache structure. Must not be NULL.
+ *
+ * @return Pointer to the internal memory buffer of the cache structure, valid until the cache is released.
+ */
+RANDOMX_EXPORT void *randomx_get_cache_memory(randomx_cache *cache);
+
+/**
+ * Releases all memory occupied by the randomx_cache structure.
+ */
+RANDOMX_EXPORT void randomx_release_cache(randomx_cache* cache);
+
+/**
+ * Creates a randomx_dataset structure and allocates memory for RandomX Dataset.
+ *
+ * @return Pointer to an allocated randomx_dataset structure, or NULL if allocation fails.
+ */
+RANDOMX_EXPORT randomx_dataset *randomx_alloc_dataset(randomx_flags flags);
+
+/**
+ * @return The number of items contained in the dataset.
+ */
+RANDOMX_EXPORT unsigned long randomx_dataset_item_count(void);
+
+/**
+ * Initializes dataset items. Can be called concurrently from several threads for disjoint ranges.
+ */
+RANDOMX_EXPORT void randomx_init_dataset(randomx_dataset *dataset, randomx_cache *cache, unsigned long startItem, unsigned long itemCount);
+
+/**
+ * Returns a pointer to the internal memory buffer of the dataset structure. The size
+ * of the internal memory buffer is randomx_dataset_item_count() * RANDOMX_DATASET_ITEM_SIZE.
+ *
+ * @param dataset is a pointer to a previously allocated randomx_dataset structure. Must not be NULL.
+ *
+ * @return Pointer to the internal memory buffer of the dataset structure, valid until the dataset is released.
+ */
+RANDOMX_EXPORT void *randomx_get_dataset_memory(randomx_dataset *dataset);
+
+/**
+ * Releases all memory occupied by the randomx_dataset structure.
+ */
+RANDOMX_EXPORT void randomx_release_dataset(randomx_dataset *dataset);
+
+/**
+ * Creates and initializes a RandomX virtual machine.
+ *
+ * @return Pointer to an initialized randomx_vm structure, or NULL on failure.
+ */
+RANDOMX_EXPORT randomx_vm *randomx_create_vm(randomx_flags flags, randomx_cache *cache, randomx_dataset *dataset);
+
+/**
+ * Reinitializes a virtual machine with a new Cache. Must be called after the Cache is initialized with a new key.
+ */
+RANDOMX_EXPORT void randomx_vm_set_cache(randomx_vm *machine, randomx_cache* cache);
+
+/**
+ * Reinitializes a virtual machine with a new Dataset.
+ */
+RANDOMX_EXPORT void randomx_vm_set_dataset(randomx_vm *machine, randomx_dataset *dataset);
+
+/**
+ * Releases all memory occupied by the randomx_vm structure.
+ */
+RANDOMX_EXPORT void randomx_destroy_vm(randomx_vm *machine);
+
+/**
+ * Calculates a RandomX hash value.
+ */
+RANDOMX_EXPORT void randomx_calculate_hash(randomx_vm *machine, const void *input, size_t inputSize, void *output);
+
+/**
+ * Paired functions used to calculate multiple RandomX hashes more efficiently.
+ * randomx_calculate_hash_first is called for the first input value.
+ * randomx_calculate_hash_next will output the hash value of the previous input
+ * and start the calculation for the next input value.
+ * randomx_calculate_hash_last will output the hash value of the previous input.
+ */
+RANDOMX_EXPORT void randomx_calculate_hash_first(randomx_vm* machine, const void* input, size_t inputSize);
+RANDOMX_EXPORT void randomx_calculate_hash_next(randomx_vm* machine, const void* nextInput, size_t nextInputSize, void* output);
+RANDOMX_EXPORT void randomx_calculate_hash_last(randomx_vm* machine, void* output);
+
+/**
+ * Calculate a RandomX commitment from a RandomX hash and its input.
+ */
+RANDOMX_EXPORT void randomx_calculate_commitment(const void* input, size_t inputSize, const void* hash_in, void* com_out);
+
+#if defined(__cplusplus)
+}
+#endif
+
+#endif
@@ -0,0 +1,215 @@
+/*
+ * Runs the reference test vectors against the C API.
+ *
+ *   go build -buildmode=c-shared -o librandomx.so ./librandomx
+ *   cc -o tests librandomx/tests/tests.c -Ilibrandomx -L. -lrandomx -lpthread
+ *   LD_LIBRARY_PATH=. ./tests [--full]
+ *
+ * With --full, the Dataset is initialized from several threads and the vectors are also checked in full mode.
+ */
+
+#include <pthread.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "randomx.h"
+
+struct test_vector {
+	const char *name;
+	const char *key;
+	const char *input;
+	size_t input_size;
+	const char *expected;
+};
+
+static const char test_e_input[] =
+	"\x0b\x0b\x98\xbe\xa7\xe8\x05\xe0\x01\x0a\x21\x26\xd2\x87\xa2\xa0\xcc\x83\x3d\x31\x2c\xb7\x86\x38\x5a\x7c\x2f\x9d"
+	"\xe6\x9d\x25\x53\x7f\x58\x4a\x9b\xc9\x97\x7b\x00\x00\x00\x00\x66\x6f\xd8\x75\x3b\xf6\x1a\x86\x31\xf1\x29\x84\xe3"
+	"\xfd\x44\xf4\x01\x4e\xca\x62\x92\x76\x81\x7b\x56\xf3\x2e\x9b\x68\xbd\x82\xf4\x16";
+
+#define TEXT(s) s, sizeof(s) - 1
+
+static const struct test_vector vectors[] = {
+	{"example", "RandomX example key", TEXT("RandomX example input\0"), "8a48e5f9db45ab79d9080574c4d81954fe6ac63842214aff73c244b26330b7c9"},
+	{"test_a", "test key 000", TEXT("This is a test"), "639183aae1bf4c9a35884cb46b09cad9175f04efd7684e7262a0ac1c2f0b4e3f"},
+	{"test_b", "test key 000", TEXT("Lorem ipsum dolor sit amet"), "300a0adb47603dedb42228ccb2b211104f4da45af709cd7547cd049e9489c969"},
+	{"test_c", "test key 000", TEXT("sed do eiusmod tempor incididunt ut labore et dolore magna aliqua"), "c36d4ed4191e617309867ed66a443be4075014e2b061bcdaf9ce7b721d2b77a8"},
+	{"test_d", "test key 001", TEXT("sed do eiusmod tempor incididunt ut labore et dolore magna aliqua"), "e9ff4503201c0c2cca26d285c93ae883f9b1d30c9eb240b820756f2d5a7905fc"},
+	{"test_e", "test key 001", test_e_input, sizeof(test_e_input) - 1, "c56414121acda1713c2f2a819d8ae38aed7c80c35c2a769298d34f03833cd5f1"},
+};
+
+#define VECTOR_COUNT (sizeof(vectors) / sizeof(vectors[0]))
+
+static int failures = 0;
+
+static void to_hex(const unsigned char *data, size_t size, char *out) {
+	for (size_t i = 0; i < size; i++) {
+		sprintf(out + i * 2, "%02x", data[i]);
+	}
+}
+
+static void check(const char *name, const unsigned char *hash, const char *expected) {
+	char hex[RANDOMX_HASH_SIZE * 2 + 1];
+	to_hex(hash, RANDOMX_HASH_SIZE, hex);
+	if (strcmp(hex, expected) != 0) {
+		printf("[FAIL] %s: expected %s, got %s\n", name, expected, hex);
+		failures++;
+	} else {
+		printf("[ OK ] %s\n", name);
+	}
+}
+
+/* Checks that memory is returned, and holds initialized data */
+static void check_memory(const char *name, const unsigned char *memory) {
+	if (memory == NULL) {
+		printf("[FAIL] %s: NULL memory\n", name);
+		failures++;
+		return;
+	}
+	for (size_t i = 0; i < RANDOMX_DATASET_ITEM_SIZE; i++) {
+		if (memory[i] != 0) {
+			printf("[ OK ] %s\n", name);
+			return;
+		}
+	}
+	printf("[FAIL] %s: memory not initialized\n", name);
+	failures++;
+}
+
+/* key_size includes the terminating zero of the example key, as in the reference tests */
+static size_t key_size(const struct test_vector *v) {
+	return strcmp(v->name, "example") == 0 ? strlen(v->key) + 1 : strlen(v->key);
+}
+
+/* run_vectors Checks all vectors with a VM, re-keying cache when needed. dataset is used in full mode. */
+static void run_vectors(const char *mode, randomx_flags flags, randomx_cache *cache, randomx_dataset *dataset, const char *only_key) {
+	randomx_vm *vm = NULL;
+	char name[64];
+	unsigned char hash[RANDOMX_HASH_SIZE];
+
+	for (size_t i = 0; i < VECTOR_COUNT; i++) {
+		const struct test_vector *v = &vectors[i];
+		if (only_key != NULL && strcmp(v->key, only_key) != 0) {
+			continue;
+		}
+		if (dataset == NULL) {
+			randomx_init_cache(cache, v->key, key_size(v));
+		}
+		if (vm == NULL) {
+			vm = randomx_create_vm(flags, cache, dataset);
+			if (vm == NULL) {
+				printf("[FAIL] %s: randomx_create_vm\n", mode);
+				failures++;
+				return;
+			}
+		} else if (dataset == NULL) {
+			randomx_vm_set_cache(vm, cache);
+		}
+
+		randomx_calculate_hash(vm, v->input, v->input_size, hash);
+		snprintf(name, sizeof(name), "%s %s", mode, v->name);
+		check(name, hash, v->expected);
+	}
+
+	randomx_destroy_vm(vm);
+}
+
+/* run_batch Checks test_a to test_c via randomx_calculate_hash_first/next/last, and the commitment of test_a */
+static void run_batch(randomx_flags flags, randomx_cache *cache) {
+	unsigned char hash[RANDOMX_HASH_SIZE];
+
+	randomx_init_cache(cache, "test key 000", strlen("test key 000"));
+	randomx_vm *vm = randomx_create_vm(flags, cache, NULL);
+	if (vm == NULL) {
+		printf("[FAIL] batch: randomx_create_vm\n");
+		failures++;
+		return;
+	}
+
+	randomx_calculate_hash_first(vm, vectors[1].input, vectors[1].input_size);
+	randomx_calculate_hash_next(vm, vectors[2].input, vectors[2].input_size, hash);
+	check("batch test_a", hash, vectors[1].expected);
+	randomx_calculate_hash_next(vm, vectors[3].input, vectors[3].input_size, hash);
+	check("batch test_b", hash, vectors[2].expected);
+	randomx_calculate_hash_last(vm, hash);
+	check("batch test_c", hash, vectors[3].expected);
+
+	randomx_calculate_hash(vm, vectors[1].input, vectors[1].input_size, hash);
+	randomx_calculate_commitment(vectors[1].input, vectors[1].input_size, hash, hash);
+	check("commitment test_a", hash, "d53ccf348b75291b7be76f0a7ac8208bbced734b912f6fca60539ab6f86be919");
+
+	randomx_destroy_vm(vm);
+}
+
+struct init_job {
+	randomx_dataset *dataset;
+	randomx_cache *cache;
+	unsigned long start;
+	unsigned long count;
+};
+
+static void *init_thread(void *arg) {
+	struct init_job *job = arg;
+	randomx_init_dataset(job->dataset, job->cache, job->start, job->count);
+	return NULL;
+}
+
+#define INIT_THREADS 4
+
+static void run_full(randomx_flags flags, randomx_cache *cache) {
+	randomx_dataset *dataset = randomx_alloc_dataset(flags);
+	if (dataset == NULL) {
+		printf("[FAIL] full: randomx_alloc_dataset\n");
+		failures++;
+		return;
+	}
+
+	randomx_init_cache(cache, "test key 000", strlen("test key 000"));
+
+	unsigned long items = randomx_dataset_item_count();
+	pthread_t threads[INIT_THREADS];
+	struct init_job jobs[INIT_THREADS];
+	for (int i = 0; i < INIT_THREADS; i++) {
+		jobs[i].dataset = dataset;
+		jobs[i].cache = cache;
+		jobs[i].start = items * i / INIT_THREADS;
+		jobs[i].count = items * (i + 1) / INIT_THREADS - jobs[i].start;
+		pthread_create(&threads[i], NULL, init_thread, &jobs[i]);
+	}
+	for (int i = 0; i < INIT_THREADS; i++) {
+		pthread_join(threads[i], NULL);
+	}
+
+	check_memory("full: randomx_get_dataset_memory", randomx_get_dataset_memory(dataset));
+	run_vectors("full", flags | RANDOMX_FLAG_FULL_MEM, NULL, dataset, "test key 000");
+	randomx_release_dataset(dataset);
+}
+
+int main(int argc, char **argv) {
+	int full = argc > 1 && strcmp(argv[1], "--full") == 0;
+
+	randomx_flags flags = randomx_get_flags();
+	randomx_cache *cache = randomx_alloc_cache(flags);
+	if (cache == NULL) {
+		printf("[FAIL] randomx_alloc_cache\n");
+		return 1;
+	}
+
+	run_vectors("light", flags, cache, NULL, NULL);
+	check_memory("randomx_get_cache_memory", randomx_get_cache_memory(cache));
+	run_vectors("light interpreter", flags & ~RANDOMX_FLAG_JIT, cache, NULL, "test key 001");
+	run_batch(flags, cache);
+	if (full) {
+		run_full(flags, cache);
+	}
+
+	randomx_release_cache(cache);
+
+	if (failures > 0) {
+		printf("%d failures\n", failures);
+		return 1;
+	}
+	printf("all tests passed\n");
+	return 0;
+}
@@ -0,0 +1,467 @@
+// Package miner searches the nonce space of RandomX mining jobs using pipelined VMs.
+package miner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// NonceSize Size of the nonce written into the hashing blob
+const NonceSize = 4
+
+// Job Mining job
+type Job struct {
+	ID string
+	// Blob Hashing blob, the nonce is written at NonceOffset as a 32-bit little endian integer
+	Blob        []byte
+	NonceOffset int
+	// NonceMask Low nonce bits the miner may change, others are kept from Blob. Must be one less than a power of two,
+	// for example 0x00ffffff when the pool reserves the top byte. Zero means all bits.
+	NonceMask uint32
+	// Target 64-bit stratum target, see randomx.ParseTarget
+	Target uint64
+	// SeedHash RandomX key
+	SeedHash []byte
+}
+
+// Share Nonce found by a worker whose hash meets the job target
+type Share struct {
+	JobID  string
+	Nonce  uint32
+	Hash   randomx.Hash
+	Worker int
+}
+
+// jobState Job as seen by workers
+type jobState struct {
+	Job
+	mask uint32
+	// base nonce bits kept from Blob
+	base uint32
+}
+
+type worker struct {
+	id   int
+	vm   *randomx.VM
+	blob []byte
+
+	hashes  atomic.Uint64
+	shares  atomic.Uint64
+	dropped atomic.Uint64
+	rate    *rateCounter
+}
+
+// Miner Hashes jobs using one VM per worker goroutine, emitting shares on a channel.
+// The nonce space of each job is split evenly across workers, and each worker hashes nonces back to back
+// via VM.CalculateHashFirst / VM.CalculateHashNext.
+// Miner is safe for concurrent use.
+type Miner struct {
+	cache   *randomx.Cache
+	dataset *randomx.Dataset
+	threads int
+
+	workers []*worker
+	shares  chan Share
+	rate    *rateCounter
+
+	// lock serializes SetJob and Close
+	lock   sync.Mutex
+	seed   []byte
+	closed bool
+
+	job atomic.Pointer[jobState]
+	// vmLock held for reading by workers while hashing, and for writing while VMs are switched over to a new seed
+	vmLock sync.RWMutex
+
+	// notify closed and replaced whenever job changes
+	notifyLock sync.Mutex
+	notify     chan struct{}
+
+	errLock sync.Mutex
+	err     error
+
+	// ctx cancelled on Close, stops workers and aborts Dataset initialization
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New Creates a Miner using randomx.ConfigMonero, see NewWithConfig
+func New(flags randomx.Flags, workers int) (*Miner, error) {
+	return NewWithConfig(flags, randomx.ConfigMonero, workers)
+}
+
+// NewWithConfig Creates a Miner with the given number of workers, runtime.NumCPU() if not positive.
+// If flags contain randomx.RANDOMX_FLAG_FULL_MEM a Dataset is allocated and initialized using all workers on seed changes.
+// Workers are idle until a job is set via SetJob.
+func NewWithConfig(flags randomx.Flags, config randomx.Config, workers int) (m *Miner, err error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	m = &Miner{
+		threads: workers,
+		shares:  make(chan Share, 64),
+		rate:    newRateCounter(),
+		notify:  make(chan struct{}),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	defer func() {
+		if err != nil {
+			m.release()
+		}
+	}()
+
+	if m.cache, err = randomx.NewCacheWithConfig(flags, config); err != nil {
+		return nil, err
+	}
+	if flags.Has(randomx.RANDOMX_FLAG_FULL_MEM) {
+		if m.dataset, err = randomx.NewDatasetWithConfig(flags, config); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		w := &worker{
+			id:   i,
+			rate: newRateCounter(),
+		}
+		if flags.Has(randomx.RANDOMX_FLAG_FULL_MEM) {
+			w.vm, err = randomx.NewVM(flags, nil, m.dataset)
+		} else {
+			w.vm, err = randomx.NewVM(flags, m.cache, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.workers = append(m.workers, w)
+	}
+
+	m.wg.Add(len(m.workers) + 1)
+	for _, w := range m.workers {
+		go m.run(w)
+	}
+	go m.sample()
+
+	return m, nil
+}
+
+// Shares Returns the channel shares are sent on. It is closed by Close.
+// Workers block while the channel is full, until the job changes. Shares still pending then are dropped.
+func (m *Miner) Shares() <-chan Share {
+	return m.shares
+}
+
+// SetJob Switches all workers over to job. Hashes in flight for the previous job are finished and may still produce shares for it.
+// When the seed hash changes, workers are paused while the Cache (and Dataset) are re-initialized, but VMs are kept.
+// job is copied and can be modified once SetJob returns.
+func (m *Miner) SetJob(job Job) error {
+	if job.NonceOffset < 0 || job.NonceOffset+NonceSize > len(job.Blob) {
+		return errors.New("nonce offset out of range")
+	}
+	if job.Target == 0 {
+		return errors.New("zero target")
+	}
+	if len(job.SeedHash) == 0 {
+		return errors.New("empty seed hash")
+	}
+	if job.NonceMask&(job.NonceMask+1) != 0 {
+		return errors.New("nonce mask must cover contiguous low bits")
+	}
+
+	j := &jobState{
+		Job:  job,
+		mask: job.NonceMask,
+	}
+	j.Blob = bytes.Clone(job.Blob)
+	j.SeedHash = bytes.Clone(job.SeedHash)
+	if j.mask == 0 {
+		j.mask = math.MaxUint32
+	}
+	j.base = binary.LittleEndian.Uint32(j.Blob[j.NonceOffset:]) &^ j.mask
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return randomx.ErrClosed
+	}
+
+	if bytes.Equal(j.SeedHash, m.seed) {
+		m.publish(j)
+		return nil
+	}
+
+	// stop all workers before touching the Cache and Dataset
+	m.publish(nil)
+	m.vmLock.Lock()
+	defer m.vmLock.Unlock()
+
+	m.seed = nil
+	if err := m.cache.Init(j.SeedHash); err != nil {
+		return err
+	}
+	if m.dataset != nil {
+		if err := m.dataset.InitDatasetContext(m.ctx, m.cache, 0, uint64(len(m.dataset.Memory())), m.threads, nil); err != nil {
+			return err
+		}
+	} else {
+		for _, w := range m.workers {
+			if err := w.vm.SetCache(m.cache); err != nil {
+				return err
+			}
+		}
+	}
+	m.seed = j.SeedHash
+
+	m.publish(j)
+	return nil
+}
+
+// Pause Stops all workers until the next SetJob.
+func (m *Miner) Pause() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.publish(nil)
+}
+
+// publish Sets the current job and wakes up idle workers
+func (m *Miner) publish(j *jobState) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	m.job.Store(j)
+	close(m.notify)
+	m.notify = make(chan struct{})
+}
+
+// current Returns the current job, and a channel that is closed once it changes
+func (m *Miner) current() (*jobState, <-chan struct{}) {
+	m.notifyLock.Lock()
+	defer m.notifyLock.Unlock()
+	return m.job.Load(), m.notify
+}
+
+func (m *Miner) setErr(err error) {
+	m.errLock.Lock()
+	defer m.errLock.Unlock()
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// Err Returns the first error encountered by a worker, if any. Workers that hit an error idle until the next job.
+func (m *Miner) Err() error {
+	m.errLock.Lock()
+	defer m.errLock.Unlock()
+	return m.err
+}
+
+// run Worker main loop
+func (m *Miner) run(w *worker) {
+	defer m.wg.Done()
+
+	var last *jobState
+	for {
+		j, changed := m.current()
+		if j == nil || j == last {
+			// idle until the job changes
+			select {
+			case <-changed:
+				continue
+			case <-m.ctx.Done():
+				return
+			}
+		}
+		last = j
+
+		m.vmLock.RLock()
+		// job could have been replaced while the seed changed
+		if m.job.Load() == j {
+			if err := m.mine(w, j, changed); err != nil && m.ctx.Err() == nil {
+				m.setErr(err)
+			}
+		}
+		m.vmLock.RUnlock()
+
+		if m.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// mine Hashes the nonce range of worker w until it is exhausted or the job changes. vmLock must be held for reading.
+// changed is closed once j is replaced.
+func (m *Miner) mine(w *worker, j *jobState, changed <-chan struct{}) error {
+	// split the nonce space evenly, the last worker takes the remainder
+	count := uint64(j.mask) + 1
+	step := count / uint64(len(m.workers))
+	start := step * uint64(w.id)
+	end := start + step
+	if w.id == len(m.workers)-1 {
+		end = count
+	}
+	if start >= end {
+		return nil
+	}
+
+	w.blob = append(w.blob[:0], j.Blob...)
+	nonceAt := func(n uint64) uint32 {
+		return j.base | uint32(n)
+	}
+
+	var hash randomx.Hash
+	nonce := nonceAt(start)
+	binary.LittleEndian.PutUint32(w.blob[j.NonceOffset:], nonce)
+	if err := w.vm.CalculateHashFirst(w.blob); err != nil {
+		return err
+	}
+
+	for n := start + 1; n < end && m.job.Load() == j; n++ {
+		next := nonceAt(n)
+		binary.LittleEndian.PutUint32(w.blob[j.NonceOffset:], next)
+		if err := w.vm.CalculateHashNext(w.blob, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+			return err
+		}
+		if !m.check(w, j, changed, nonce, &hash) {
+			return nil
+		}
+		nonce = next
+	}
+
+	if err := w.vm.CalculateHashLast((*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		return err
+	}
+	m.check(w, j, changed, nonce, &hash)
+	return nil
+}
+
+// check Counts a hash and emits a share if it meets the job target. Returns false if the Miner is closing or the job changed.
+// A share that cannot be sent before the job changes is dropped, as SetJob waits for vmLock while workers hold it.
+func (m *Miner) check(w *worker, j *jobState, changed <-chan struct{}, nonce uint32, hash *randomx.Hash) bool {
+	w.hashes.Add(1)
+	if !hash.MeetsTarget(j.Target) {
+		return true
+	}
+
+	w.shares.Add(1)
+	select {
+	case m.shares <- Share{JobID: j.ID, Nonce: nonce, Hash: *hash, Worker: w.id}:
+		return true
+	case <-changed:
+		w.dropped.Add(1)
+		return false
+	case <-m.ctx.Done():
+		return false
+	}
+}
+
+// sample Records hash counters for sliding window hashrates
+func (m *Miner) sample() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(SampleInterval)
+	defer ticker.Stop()
+
+	m.record(time.Now())
+	for {
+		select {
+		case now := <-ticker.C:
+			m.record(now)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Miner) record(now time.Time) {
+	var total uint64
+	for _, w := range m.workers {
+		hashes := w.hashes.Load()
+		w.rate.add(now, hashes)
+		total += hashes
+	}
+	m.rate.add(now, total)
+}
+
+// Stats Returns hash and share counters of all workers
+func (m *Miner) Stats() Stats {
+	s := Stats{
+		Workers: make([]WorkerStats, len(m.workers)),
+	}
+	for i, w := range m.workers {
+		s.Workers[i] = WorkerStats{
+			Hashes:  w.hashes.Load(),
+			Shares:  w.shares.Load(),
+			Dropped: w.dropped.Load(),
+		}
+		s.Hashes += s.Workers[i].Hashes
+		s.Shares += s.Workers[i].Shares
+		s.Dropped += s.Workers[i].Dropped
+	}
+	return s
+}
+
+// Hashrate Returns the hashes per second of all workers over the last window, up to MaxWindow.
+// Returns 0 until at least one SampleInterval has passed.
+func (m *Miner) Hashrate(window time.Duration) float64 {
+	var total uint64
+	for _, w := range m.workers {
+		total += w.hashes.Load()
+	}
+	return m.rate.rate(time.Now(), total, window)
+}
+
+// WorkerHashrate Returns the hashes per second of a single worker over the last window, up to MaxWindow.
+func (m *Miner) WorkerHashrate(worker int, window time.Duration) float64 {
+	w := m.workers[worker]
+	return w.rate.rate(time.Now(), w.hashes.Load(), window)
+}
+
+// Close Stops all workers, releases VMs and memory, and closes the Shares channel.
+func (m *Miner) Close() error {
+	// abort Dataset initialization in progress before waiting for SetJob
+	m.cancel()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	m.publish(nil)
+	m.wg.Wait()
+	close(m.shares)
+
+	return m.release()
+}
+
+func (m *Miner) release() error {
+	var errs []error
+	for _, w := range m.workers {
+		if err := w.vm.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if m.dataset != nil {
+		if err := m.dataset.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if m.cache != nil {
+		if err := m.cache.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,287 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// testConfig Small configuration so that tests run quickly
+var testConfig = func() randomx.Config {
+	c := randomx.ConfigMonero
+	c.ArgonMemory = 256
+	c.ArgonSalt = "RandomX\x03test"
+	c.DatasetBaseSize = 1 << 20
+	c.DatasetExtraSize = 64 * 7
+	c.ProgramSize = 64
+	c.ProgramIterations = 128
+	c.ProgramCount = 4
+	c.ScratchpadL3 = 1 << 16
+	c.ScratchpadL2 = 1 << 14
+	c.ScratchpadL1 = 1 << 12
+	return c
+}()
+
+// verify Recalculates the hash of a share
+func verify(t *testing.T, job Job, share Share) {
+	t.Helper()
+
+	cache, err := randomx.NewCacheWithConfig(randomx.GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err := cache.Init(job.SeedHash); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := randomx.NewVM(randomx.GetFlags(), cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	blob := bytes.Clone(job.Blob)
+	binary.LittleEndian.PutUint32(blob[job.NonceOffset:], share.Nonce)
+
+	var hash randomx.Hash
+	if err := vm.CalculateHash(blob, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		t.Fatal(err)
+	}
+	if hash != share.Hash {
+		t.Fatalf("job %s nonce %08x: expected=%s, actual=%s", job.ID, share.Nonce, hash, share.Hash)
+	}
+	if !hash.MeetsTarget(job.Target) {
+		t.Fatalf("job %s nonce %08x: hash %s does not meet target", job.ID, share.Nonce, hash)
+	}
+}
+
+// nextShare Waits for a share of the given job, skipping shares of previous jobs
+func nextShare(t *testing.T, m *Miner, jobID string) Share {
+	t.Helper()
+
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case share := <-m.Shares():
+			if share.JobID == jobID {
+				return share
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for share of job %s", jobID)
+		}
+	}
+}
+
+func Test_Miner(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []string{"light", "full"} {
+		n := n
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			flags := randomx.GetFlags()
+			if n == "full" {
+				flags |= randomx.RANDOMX_FLAG_FULL_MEM
+			}
+
+			m, err := NewWithConfig(flags, testConfig, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			job := Job{
+				ID:          "1",
+				Blob:        bytes.Repeat([]byte{0xaa}, 76),
+				NonceOffset: 39,
+				Target:      randomx.TargetFromDifficulty(8),
+				SeedHash:    []byte("test key 000"),
+			}
+			if err := m.SetJob(job); err != nil {
+				t.Fatal(err)
+			}
+
+			seen := make(map[uint32]bool)
+			for i := 0; i < 4; i++ {
+				share := nextShare(t, m, job.ID)
+				if seen[share.Nonce] {
+					t.Fatalf("duplicate nonce %08x", share.Nonce)
+				}
+				seen[share.Nonce] = true
+				verify(t, job, share)
+			}
+
+			// job swap keeping the seed
+			job.ID = "2"
+			job.Blob = bytes.Repeat([]byte{0xbb}, 76)
+			job.NonceMask = 0x00ffffff
+			if err := m.SetJob(job); err != nil {
+				t.Fatal(err)
+			}
+			share := nextShare(t, m, job.ID)
+			if share.Nonce>>24 != 0xbb {
+				t.Errorf("reserved nonce byte changed: %08x", share.Nonce)
+			}
+			verify(t, job, share)
+
+			// seed change
+			job.ID = "3"
+			job.SeedHash = []byte("test key 001")
+			job.NonceMask = 0
+			if err := m.SetJob(job); err != nil {
+				t.Fatal(err)
+			}
+			verify(t, job, nextShare(t, m, job.ID))
+
+			if err := m.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			stats := m.Stats()
+			if len(stats.Workers) != 2 {
+				t.Fatalf("expected 2 workers, got %d", len(stats.Workers))
+			}
+			if stats.Hashes == 0 || stats.Shares < 6 {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+			for i, w := range stats.Workers {
+				if w.Hashes == 0 {
+					t.Errorf("worker %d did not hash", i)
+				}
+			}
+
+			if err := m.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// Shares is closed, only shares sent before Close remain
+			for range m.Shares() {
+			}
+			if err := m.SetJob(job); err == nil {
+				t.Error("expected error after Close")
+			}
+		})
+	}
+}
+
+func Test_Miner_FullShares(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewWithConfig(randomx.GetFlags(), testConfig, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	// every hash is a share
+	job := Job{
+		ID:          "1",
+		Blob:        make([]byte, 76),
+		NonceOffset: 39,
+		Target:      randomx.TargetFromDifficulty(1),
+		SeedHash:    []byte("test key 000"),
+	}
+	if err := m.SetJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// nobody drains Shares, wait until workers block on it
+	deadline := time.Now().Add(time.Minute)
+	for len(m.Shares()) < cap(m.Shares()) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for Shares to fill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// seed change needs workers to release their VMs
+	job.ID = "2"
+	job.SeedHash = []byte("test key 001")
+	done := make(chan error, 1)
+	go func() {
+		done <- m.SetJob(job)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("SetJob blocked on a full Shares channel")
+	}
+
+	if stats := m.Stats(); stats.Dropped == 0 {
+		t.Errorf("expected dropped shares, got %+v", stats)
+	}
+	verify(t, job, nextShare(t, m, job.ID))
+}
+
+func Test_Miner_Invalid(t *testing.T) {
+	t.Parallel()
+
+	m, err := NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	valid := Job{
+		ID:          "1",
+		Blob:        make([]byte, 76),
+		NonceOffset: 39,
+		Target:      randomx.TargetFromDifficulty(8),
+		SeedHash:    []byte("test key 000"),
+	}
+
+	for name, modify := range map[string]func(j *Job){
+		"offset":   func(j *Job) { j.NonceOffset = 73 },
+		"negative": func(j *Job) { j.NonceOffset = -1 },
+		"target":   func(j *Job) { j.Target = 0 },
+		"seed":     func(j *Job) { j.SeedHash = nil },
+		"mask":     func(j *Job) { j.NonceMask = 0xff00ffff },
+	} {
+		job := valid
+		modify(&job)
+		if err := m.SetJob(job); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func Test_RateCounter(t *testing.T) {
+	t.Parallel()
+
+	r := newRateCounter()
+	start := time.Unix(1700000000, 0)
+
+	if rate := r.rate(start, 0, time.Minute); rate != 0 {
+		t.Errorf("expected no rate without samples, got %f", rate)
+	}
+
+	// 100 H/s for one minute, then 200 H/s for 10 seconds
+	var hashes uint64
+	for i := 0; i <= 60; i++ {
+		r.add(start.Add(time.Duration(i)*time.Second), hashes)
+		hashes += 100
+	}
+	hashes -= 100
+	for i := 61; i <= 70; i++ {
+		hashes += 200
+		r.add(start.Add(time.Duration(i)*time.Second), hashes)
+	}
+	now := start.Add(70 * time.Second)
+
+	if rate := r.rate(now, hashes, 10*time.Second); rate != 200 {
+		t.Errorf("10s: expected=200, actual=%f", rate)
+	}
+	if rate := r.rate(now, hashes, 70*time.Second); rate < 114.28 || rate > 114.29 {
+		t.Errorf("70s: expected=114.29, actual=%f", rate)
+	}
+	// longer windows are limited by the oldest sample
+	if rate := r.rate(now, hashes, time.Hour); rate < 114.28 || rate > 114.29 {
+		t.Errorf("1h: expected=114.29, actual=%f", rate)
+	}
+}
@@ -0,0 +1,90 @@
+package miner
+
+import (
+	"sync"
+	"time"
+)
+
+// SampleInterval Interval at which hash counters are sampled for sliding window hashrates
+const SampleInterval = time.Second
+
+// MaxWindow Longest sliding window kept for hashrate calculation
+const MaxWindow = 15 * time.Minute
+
+// WorkerStats Statistics of a single worker
+type WorkerStats struct {
+	// Hashes Total number of hashes calculated
+	Hashes uint64
+	// Shares Total number of shares found
+	Shares uint64
+	// Dropped Shares found but not sent, as Shares was full until the job changed
+	Dropped uint64
+}
+
+// Stats Miner statistics, see Miner.Stats
+type Stats struct {
+	// Hashes Total number of hashes calculated by all workers
+	Hashes uint64
+	// Shares Total number of shares found by all workers
+	Shares uint64
+	// Dropped Shares of all workers found but not sent, as Shares was full until the job changed
+	Dropped uint64
+
+	Workers []WorkerStats
+}
+
+type sample struct {
+	time   time.Time
+	hashes uint64
+}
+
+// rateCounter Ring buffer of hash counter samples used to calculate hashrate over a sliding window
+type rateCounter struct {
+	lock    sync.Mutex
+	samples []sample
+	head    int
+	count   int
+}
+
+func newRateCounter() *rateCounter {
+	return &rateCounter{
+		samples: make([]sample, int(MaxWindow/SampleInterval)+1),
+	}
+}
+
+// add Records the hash counter at time t
+func (r *rateCounter) add(t time.Time, hashes uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.samples[r.head] = sample{time: t, hashes: hashes}
+	r.head = (r.head + 1) % len(r.samples)
+	if r.count < len(r.samples) {
+		r.count++
+	}
+}
+
+// rate Returns hashes per second between the oldest sample within window and the current counter.
+// Returns 0 if no sample is old enough to cover at least one SampleInterval.
+func (r *rateCounter) rate(now time.Time, hashes uint64, window time.Duration) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var oldest *sample
+	for i := 1; i <= r.count; i++ {
+		s := &r.samples[(r.head-i+len(r.samples))%len(r.samples)]
+		if now.Sub(s.time) > window {
+			break
+		}
+		oldest = s
+	}
+
+	if oldest == nil {
+		return 0
+	}
+	elapsed := now.Sub(oldest.time)
+	if elapsed < SampleInterval/2 {
+		return 0
+	}
+	return float64(hashes-oldest.hashes) / elapsed.Seconds()
+}
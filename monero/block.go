@@ -0,0 +1,361 @@
+// Package monero parses Monero blocks and verifies their RandomX proof of work.
+package monero
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"golang.org/x/crypto/sha3"
+)
+
+// HashSize Size of Monero hashes
+const HashSize = 32
+
+// RandomXMajorVersion First block major version using RandomX proof of work
+const RandomXMajorVersion = 12
+
+// Hash Monero hash, Keccak-256 unless noted otherwise
+type Hash [HashSize]byte
+
+// ErrNotRandomX Block major version predates RandomX proof of work
+var ErrNotRandomX = errors.New("block does not use RandomX proof of work")
+
+// Keccak256 Monero cn_fast_hash
+func Keccak256(data ...[]byte) (h Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	hasher.Sum(h[:0])
+	return h
+}
+
+// Header Block header, serialized in front of the miner transaction
+type Header struct {
+	MajorVersion uint64
+	MinorVersion uint64
+	Timestamp    uint64
+	PreviousID   Hash
+	Nonce        uint32
+}
+
+// MarshalBinary Returns the header serialization
+func (h *Header) MarshalBinary() ([]byte, error) {
+	return h.appendBinary(nil), nil
+}
+
+func (h *Header) appendBinary(buf []byte) []byte {
+	buf = binary.AppendUvarint(buf, h.MajorVersion)
+	buf = binary.AppendUvarint(buf, h.MinorVersion)
+	buf = binary.AppendUvarint(buf, h.Timestamp)
+	buf = append(buf, h.PreviousID[:]...)
+	return binary.LittleEndian.AppendUint32(buf, h.Nonce)
+}
+
+// NonceOffset Offset of the nonce in the header serialization, and thus in the hashing blob
+func (h *Header) NonceOffset() int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], h.MajorVersion) +
+		binary.PutUvarint(buf[:], h.MinorVersion) +
+		binary.PutUvarint(buf[:], h.Timestamp) +
+		HashSize
+}
+
+// Block Monero block. Only the fields of the miner transaction needed for hashing are parsed.
+type Block struct {
+	Header
+
+	// MinerTx Serialized miner (coinbase) transaction
+	MinerTx []byte
+	// TxHashes Hashes of the other transactions in the block
+	TxHashes []Hash
+
+	height uint64
+}
+
+// reader byte reader tracking errors of varint decoding
+type reader struct {
+	*bytes.Reader
+}
+
+func (r reader) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (r reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+// Transaction input and output tags
+const (
+	txInGen           = 0xff
+	txOutToKey        = 0x02
+	txOutToTaggedKey  = 0x03
+	rctTypeNull       = 0
+	minerTxMaxOutputs = 1 << 16
+)
+
+// ParseBlock Parses a block in Monero binary serialization, as returned by the get_block RPC "blob" field.
+func ParseBlock(data []byte) (*Block, error) {
+	r := reader{bytes.NewReader(data)}
+	b := &Block{}
+
+	var err error
+	if b.MajorVersion, err = r.uvarint(); err != nil {
+		return nil, err
+	}
+	if b.MinorVersion, err = r.uvarint(); err != nil {
+		return nil, err
+	}
+	if b.Timestamp, err = r.uvarint(); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(r, b.PreviousID[:]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var nonce [4]byte
+	if _, err = io.ReadFull(r, nonce[:]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b.Nonce = binary.LittleEndian.Uint32(nonce[:])
+
+	minerTxStart := len(data) - r.Len()
+	if b.height, err = parseMinerTx(r); err != nil {
+		return nil, err
+	}
+	b.MinerTx = bytes.Clone(data[minerTxStart : len(data)-r.Len()])
+
+	count, err := r.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(r.Len())/HashSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b.TxHashes = make([]Hash, count)
+	for i := range b.TxHashes {
+		if _, err = io.ReadFull(r, b.TxHashes[i][:]); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.New("trailing data after block")
+	}
+	return b, nil
+}
+
+// parseMinerTx Skips over a miner transaction, returning the height of its generation input
+func parseMinerTx(r reader) (height uint64, err error) {
+	version, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if version != 1 && version != 2 {
+		return 0, errors.New("unsupported miner transaction version")
+	}
+	// unlock time
+	if _, err = r.uvarint(); err != nil {
+		return 0, err
+	}
+
+	inputs, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if inputs != 1 {
+		return 0, errors.New("miner transaction must have exactly one input")
+	}
+	if tag, err := r.ReadByte(); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	} else if tag != txInGen {
+		return 0, errors.New("miner transaction input is not a generation input")
+	}
+	if height, err = r.uvarint(); err != nil {
+		return 0, err
+	}
+
+	outputs, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if outputs > minerTxMaxOutputs {
+		return 0, errors.New("too many miner transaction outputs")
+	}
+	for i := uint64(0); i < outputs; i++ {
+		// amount
+		if _, err = r.uvarint(); err != nil {
+			return 0, err
+		}
+		tag, err := r.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		switch tag {
+		case txOutToKey:
+			_, err = r.bytes(HashSize)
+		case txOutToTaggedKey:
+			// key and view tag
+			_, err = r.bytes(HashSize + 1)
+		default:
+			return 0, errors.New("unsupported miner transaction output type")
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	extraSize, err := r.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if _, err = r.bytes(extraSize); err != nil {
+		return 0, err
+	}
+
+	if version == 2 {
+		if rctType, err := r.ReadByte(); err != nil {
+			return 0, io.ErrUnexpectedEOF
+		} else if rctType != rctTypeNull {
+			return 0, errors.New("miner transaction must not have ring signatures")
+		}
+	}
+
+	return height, nil
+}
+
+// Height Returns the block height, from the miner transaction generation input
+func (b *Block) Height() uint64 {
+	return b.height
+}
+
+// SeedHeight Returns the height of the block whose ID is the RandomX key for this block
+func (b *Block) SeedHeight() uint64 {
+	return randomx.SeedHeight(b.height)
+}
+
+// MinerTxHash Returns the hash of the miner transaction, or the zero Hash if MinerTx is empty as in the zero Block
+func (b *Block) MinerTxHash() Hash {
+	if len(b.MinerTx) == 0 {
+		return Hash{}
+	}
+	if b.MinerTx[0] == 1 {
+		return Keccak256(b.MinerTx)
+	}
+	// v2: hash of prefix hash, RingCT base hash and (empty) prunable hash
+	// RingCT base is a single RCTTypeNull byte, at the end of the transaction
+	prefix := b.MinerTx[:len(b.MinerTx)-1]
+	prefixHash := Keccak256(prefix)
+	baseHash := Keccak256(b.MinerTx[len(b.MinerTx)-1:])
+	var prunableHash Hash
+	return Keccak256(prefixHash[:], baseHash[:], prunableHash[:])
+}
+
+// TreeHash Monero transaction merkle tree root, see tree_hash. Returns the zero Hash for an empty tree,
+// blocks always have at least the miner transaction.
+func TreeHash(hashes []Hash) Hash {
+	switch len(hashes) {
+	case 0:
+		return Hash{}
+	case 1:
+		return hashes[0]
+	case 2:
+		return Keccak256(hashes[0][:], hashes[1][:])
+	}
+
+	// largest power of two below count
+	count := 1
+	for count*2 < len(hashes) {
+		count *= 2
+	}
+
+	ints := make([]Hash, count)
+	direct := 2*count - len(hashes)
+	copy(ints, hashes[:direct])
+	for i, j := direct, direct; j < count; i, j = i+2, j+1 {
+		ints[j] = Keccak256(hashes[i][:], hashes[i+1][:])
+	}
+	for count > 2 {
+		count /= 2
+		for i, j := 0, 0; j < count; i, j = i+2, j+1 {
+			ints[j] = Keccak256(ints[i][:], ints[i+1][:])
+		}
+	}
+	return Keccak256(ints[0][:], ints[1][:])
+}
+
+// HashingBlob Returns the blob that is hashed for proof of work: header, transaction tree root and transaction count.
+// The nonce is at NonceOffset.
+func (b *Block) HashingBlob() []byte {
+	hashes := make([]Hash, 0, len(b.TxHashes)+1)
+	hashes = append(hashes, b.MinerTxHash())
+	hashes = append(hashes, b.TxHashes...)
+	root := TreeHash(hashes)
+
+	blob := b.Header.appendBinary(nil)
+	blob = append(blob, root[:]...)
+	return binary.AppendUvarint(blob, uint64(len(hashes)))
+}
+
+// ID Returns the block ID, the hash of the length prefixed hashing blob
+func (b *Block) ID() Hash {
+	blob := b.HashingBlob()
+	return Keccak256(binary.AppendUvarint(nil, uint64(len(blob))), blob)
+}
+
+// PoWHash Calculates the RandomX proof of work hash using vm, which must be keyed with the ID of the block at SeedHeight.
+func (b *Block) PoWHash(vm *randomx.VM) (hash randomx.Hash, err error) {
+	if b.MajorVersion < RandomXMajorVersion {
+		return hash, ErrNotRandomX
+	}
+	err = vm.CalculateHash(b.HashingBlob(), (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash))
+	return hash, err
+}
+
+// VerifyBlockPoWWithVM Checks that the proof of work hash of block meets difficulty using vm, see Block.PoWHash
+func VerifyBlockPoWWithVM(vm *randomx.VM, block *Block, difficulty randomx.Difficulty) (bool, error) {
+	hash, err := block.PoWHash(vm)
+	if err != nil {
+		return false, err
+	}
+	return hash.MeetsDifficulty(difficulty), nil
+}
+
+// VerifyBlockPoW Checks that the proof of work hash of block meets difficulty.
+// seedKey is the ID of the block at block.SeedHeight(). A light mode Cache is initialized for each call,
+// use VerifyBlockPoWWithVM to verify many blocks.
+func VerifyBlockPoW(block *Block, seedKey []byte, difficulty randomx.Difficulty) (bool, error) {
+	if block.MajorVersion < RandomXMajorVersion {
+		return false, ErrNotRandomX
+	}
+
+	flags := randomx.GetFlags()
+	cache, err := randomx.NewCache(flags)
+	if err != nil {
+		return false, err
+	}
+	defer cache.Close()
+	if err = cache.Init(seedKey); err != nil {
+		return false, err
+	}
+
+	vm, err := randomx.NewVM(flags, cache, nil)
+	if err != nil {
+		return false, err
+	}
+	defer vm.Close()
+
+	return VerifyBlockPoWWithVM(vm, block, difficulty)
+}
@@ -0,0 +1,264 @@
+package monero
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+type testBlock struct {
+	file        string
+	id          string
+	minerTxHash string
+	powHash     string
+	height      uint64
+	seedHeight  uint64
+	major       uint64
+	nonce       uint32
+	nonceOffset int
+	txCount     int
+}
+
+var testBlocks = []testBlock{
+	{
+		file:        "mainnet_0.hex",
+		id:          "418015bb9ae982a1975da7d79277c2705727a56894ba0fb246adaabb1f4632e3",
+		minerTxHash: "c88ce9783b4f11190d7b9c17a69c1c52200f9faaee8e98dd07e6811175177139",
+		height:      0,
+		seedHeight:  0,
+		major:       1,
+		nonce:       10000,
+		nonceOffset: 35,
+		txCount:     0,
+	},
+	{
+		file:        "synthetic_100.hex",
+		id:          "ea23b7ef6286aeae9025ceeaba4e2d02d42e47ff82496f24c598fbe8b7728261",
+		powHash:     "c0571e17b2cad05f5eb9e17693c6a3e4645affa830aa899e8285034e8e92ea00",
+		height:      100,
+		seedHeight:  0,
+		major:       16,
+		nonce:       133,
+		nonceOffset: 39,
+		txCount:     4,
+	},
+}
+
+func loadTestBlock(t *testing.T, file string) []byte {
+	data, err := os.ReadFile(path.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func Test_ParseBlock(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range testBlocks {
+		t.Run(test.file, func(t *testing.T) {
+			b, err := ParseBlock(loadTestBlock(t, test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if b.MajorVersion != test.major || b.Nonce != test.nonce || len(b.TxHashes) != test.txCount {
+				t.Errorf("unexpected header %+v", b.Header)
+			}
+			if b.Height() != test.height || b.SeedHeight() != test.seedHeight {
+				t.Errorf("unexpected height %d seed height %d", b.Height(), b.SeedHeight())
+			}
+			if id := b.ID(); hex.EncodeToString(id[:]) != test.id {
+				t.Errorf("unexpected id %x", id)
+			}
+			if test.minerTxHash != "" {
+				if h := b.MinerTxHash(); hex.EncodeToString(h[:]) != test.minerTxHash {
+					t.Errorf("unexpected miner tx hash %x", h)
+				}
+			}
+
+			blob := b.HashingBlob()
+			if b.NonceOffset() != test.nonceOffset || !bytes.Equal(blob[test.nonceOffset:test.nonceOffset+4], []byte{byte(test.nonce), byte(test.nonce >> 8), byte(test.nonce >> 16), byte(test.nonce >> 24)}) {
+				t.Errorf("unexpected nonce offset %d", b.NonceOffset())
+			}
+		})
+	}
+}
+
+// Test_Header_Reference Checks the header serialization against the hashing blob of the RandomX reference test_e
+// vector, a Monero mainnet header from June 2019 followed by its transaction tree root and count
+func Test_Header_Reference(t *testing.T) {
+	t.Parallel()
+
+	blob, err := hex.DecodeString("0b0b98bea7e805e0010a2126d287a2a0cc833d312cb786385a7c2f9de69d25537f584a9bc9977b00000000666fd8753bf61a8631f12984e3fd44f4014eca629276817b56f32e9b68bd82f416")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := Header{
+		MajorVersion: 11,
+		MinorVersion: 11,
+		Timestamp:    1560928024,
+		PreviousID:   Hash(blob[7:39]),
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.NonceOffset() != 39 || !bytes.Equal(data, blob[:43]) {
+		t.Fatalf("unexpected header %x, nonce offset %d", data, h.NonceOffset())
+	}
+}
+
+func Test_ParseBlock_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range testBlocks {
+		blob := loadTestBlock(t, test.file)
+		for i := 0; i < len(blob); i++ {
+			if _, err := ParseBlock(blob[:i]); !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("%s truncated to %d: expected io.ErrUnexpectedEOF, got %v", test.file, i, err)
+			}
+		}
+		if _, err := ParseBlock(append(blob, 0)); err == nil {
+			t.Fatalf("%s: expected error on trailing data", test.file)
+		}
+	}
+}
+
+// treeHashReference Straightforward port of Monero tree_hash
+func treeHashReference(hashes []Hash) Hash {
+	if len(hashes) == 1 {
+		return hashes[0]
+	}
+	cnt := 1
+	for cnt*2 < len(hashes) {
+		cnt *= 2
+	}
+	ints := make([]Hash, cnt)
+	copy(ints, hashes[:2*cnt-len(hashes)])
+	for i, j := 2*cnt-len(hashes), 2*cnt-len(hashes); j < cnt; i, j = i+2, j+1 {
+		ints[j] = Keccak256(hashes[i][:], hashes[i+1][:])
+	}
+	for len(ints) > 1 {
+		next := make([]Hash, len(ints)/2)
+		for i := range next {
+			next[i] = Keccak256(ints[2*i][:], ints[2*i+1][:])
+		}
+		ints = next
+	}
+	return ints[0]
+}
+
+func Test_TreeHash(t *testing.T) {
+	t.Parallel()
+
+	if TreeHash(nil) != (Hash{}) {
+		t.Fatal("expected zero Hash for an empty tree")
+	}
+
+	var hashes []Hash
+	for n := 1; n <= 33; n++ {
+		hashes = append(hashes, Keccak256([]byte{byte(n)}))
+		if TreeHash(hashes) != treeHashReference(hashes) {
+			t.Fatalf("mismatch for %d hashes", n)
+		}
+	}
+}
+
+func Test_Block_Zero(t *testing.T) {
+	t.Parallel()
+
+	var b Block
+	if b.MinerTxHash() != (Hash{}) {
+		t.Error("expected zero miner transaction hash")
+	}
+	// header, root and count of the zero Block
+	if blob := b.HashingBlob(); len(blob) != 3+32+4+HashSize+1 {
+		t.Errorf("unexpected hashing blob length %d", len(blob))
+	}
+	if _, err := b.PoWHash(nil); !errors.Is(err, ErrNotRandomX) {
+		t.Errorf("expected ErrNotRandomX, got %v", err)
+	}
+}
+
+func Test_VerifyBlockPoW(t *testing.T) {
+	t.Parallel()
+
+	genesis, err := ParseBlock(loadTestBlock(t, "mainnet_0.hex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedKey := genesis.ID()
+
+	if _, err := VerifyBlockPoW(genesis, seedKey[:], randomx.NewDifficulty(1)); !errors.Is(err, ErrNotRandomX) {
+		t.Fatalf("expected ErrNotRandomX, got %v", err)
+	}
+
+	test := testBlocks[1]
+	b, err := ParseBlock(loadTestBlock(t, test.file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := randomx.GetFlags()
+	cache, err := randomx.NewCache(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err = cache.Init(seedKey[:]); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := randomx.NewVM(flags, cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	hash, err := b.PoWHash(vm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash.String() != test.powHash {
+		t.Fatalf("unexpected PoW hash %s", hash)
+	}
+
+	for _, c := range []struct {
+		difficulty uint64
+		valid      bool
+	}{{1, true}, {100, true}, {1000, false}} {
+		valid, err := VerifyBlockPoWWithVM(vm, b, randomx.NewDifficulty(c.difficulty))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid != c.valid {
+			t.Errorf("difficulty %d: expected %v", c.difficulty, c.valid)
+		}
+	}
+
+	valid, err := VerifyBlockPoW(b, seedKey[:], randomx.NewDifficulty(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !valid {
+		t.Error("expected valid PoW")
+	}
+
+	// a different nonce no longer meets the difficulty
+	b.Nonce++
+	if valid, err := VerifyBlockPoWWithVM(vm, b, randomx.NewDifficulty(100)); err != nil || valid {
+		t.Errorf("expected invalid PoW after changing the nonce, got %v %v", valid, err)
+	}
+}
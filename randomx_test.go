@@ -81,6 +81,17 @@ func testFlags(name string, flags Flags) (f Flags, skip bool) {
 			return flags, true
 		}
 
+	case "secure":
+		flags |= RANDOMX_FLAG_JIT | RANDOMX_FLAG_SECURE
+		if !flags.HasJIT() {
+			return flags, true
+		}
+
+	case "concurrent":
+		// ignored by the JIT
+		flags |= RANDOMX_FLAG_LIGHT_CONCURRENT
+		flags &^= RANDOMX_FLAG_JIT
+
 	case "softaes":
 		flags &^= RANDOMX_FLAG_HARD_AES
 	case "hardaes":
@@ -104,7 +115,7 @@ func testFlags(name string, flags Flags) (f Flags, skip bool) {
 
 func Test_RandomXLight(t *testing.T) {
 	t.Parallel()
-	for _, n := range []string{"interpreter", "compiler", "softaes", "hardaes", "largepages"} {
+	for _, n := range []string{"interpreter", "compiler", "secure", "concurrent", "softaes", "hardaes", "largepages"} {
 		t.Run(n, func(t *testing.T) {
 			t.Parallel()
 			tFlags, skip := testFlags(t.Name(), 0)
@@ -128,7 +139,9 @@ func Test_RandomXLight(t *testing.T) {
 
 			for _, test := range Tests {
 				t.Run(test.name, func(t *testing.T) {
-					c.Init(test.key)
+					if err := c.Init(test.key); err != nil {
+						t.Fatal(err)
+					}
 
 					vm, err := NewVM(tFlags, c, nil)
 					if err != nil {
@@ -143,7 +156,9 @@ func Test_RandomXLight(t *testing.T) {
 
 					var outputHash [RANDOMX_HASH_SIZE]byte
 
-					vm.CalculateHash(test.input, &outputHash)
+					if err := vm.CalculateHash(test.input, &outputHash); err != nil {
+						t.Fatal(err)
+					}
 
 					outputHex := hex.EncodeToString(outputHash[:])
 
@@ -184,7 +199,9 @@ func Test_RandomXBatch(t *testing.T) {
 			}()
 			tests := Tests[1:4]
 
-			c.Init(tests[0].key)
+			if err := c.Init(tests[0].key); err != nil {
+				t.Fatal(err)
+			}
 			vm, err := NewVM(tFlags, c, nil)
 			if err != nil {
 				t.Fatal(err)
@@ -198,10 +215,18 @@ func Test_RandomXBatch(t *testing.T) {
 
 			var outputHash [3][RANDOMX_HASH_SIZE]byte
 
-			vm.CalculateHashFirst(tests[0].input)
-			vm.CalculateHashNext(tests[1].input, &outputHash[0])
-			vm.CalculateHashNext(tests[2].input, &outputHash[1])
-			vm.CalculateHashLast(&outputHash[2])
+			if err := vm.CalculateHashFirst(tests[0].input); err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.CalculateHashNext(tests[1].input, &outputHash[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.CalculateHashNext(tests[2].input, &outputHash[1]); err != nil {
+				t.Fatal(err)
+			}
+			if err := vm.CalculateHashLast(&outputHash[2]); err != nil {
+				t.Fatal(err)
+			}
 
 			for i, test := range tests {
 				outputHex := hex.EncodeToString(outputHash[i][:])
@@ -260,8 +285,12 @@ func Test_RandomXFull(t *testing.T) {
 
 			for _, test := range Tests {
 				t.Run(test.name, func(t *testing.T) {
-					c.Init(test.key)
-					dataset.InitDatasetParallel(c, runtime.NumCPU())
+					if err := c.Init(test.key); err != nil {
+						t.Fatal(err)
+					}
+					if err := dataset.InitDatasetParallel(c, runtime.NumCPU()); err != nil {
+						t.Fatal(err)
+					}
 
 					vm, err := NewVM(tFlags, nil, dataset)
 					if err != nil {
@@ -276,7 +305,9 @@ func Test_RandomXFull(t *testing.T) {
 
 					var outputHash [RANDOMX_HASH_SIZE]byte
 
-					vm.CalculateHash(test.input, &outputHash)
+					if err := vm.CalculateHash(test.input, &outputHash); err != nil {
+						t.Fatal(err)
+					}
 
 					outputHex := hex.EncodeToString(outputHash[:])
 
@@ -304,6 +335,63 @@ var BenchmarkDataset *Dataset
 
 var BenchmarkFlags = GetFlags()
 
+// Test_ByteCode_Execute A compiled program must run on whichever register file it is given
+func Test_ByteCode_Execute(t *testing.T) {
+	t.Parallel()
+
+	tFlags, _ := testFlags("interpreter", 0)
+
+	cache, err := NewCache(tFlags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if err = cache.Init(Tests[0].key); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := NewVM(tFlags, cache, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var output_hash [32]byte
+	if err = vm.CalculateHash(Tests[0].input, &output_hash); err != nil {
+		t.Fatal(err)
+	}
+
+	entropy := (*[16]uint64)(unsafe.Pointer(unsafe.SliceData(vm.buffer)))
+	eMask := [2]uint64{ExponentMask(entropy[14]), ExponentMask(entropy[15])}
+	vmReg := *vm.registerFile
+
+	if lockThreadDueToRoundingMode {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+
+	var results [2]RegisterFile
+	for i := range results {
+		// sync the hardware rounding mode with the register file
+		ResetRoundingMode(&results[i])
+		SetRoundingMode(&results[i], vmReg.FPRC)
+		results[i] = vmReg
+		pad := slices.Clone(vm.pad)
+		vm.program.execute(&results[i], pad, eMask)
+		ResetRoundingMode(&results[i])
+	}
+
+	if *vm.registerFile.Memory() != *vmReg.Memory() {
+		t.Fatal("VM register file was modified")
+	}
+	if *results[0].Memory() != *results[1].Memory() {
+		t.Fatal("results differ")
+	}
+	if *results[0].Memory() == *vmReg.Memory() {
+		t.Fatal("program did not modify the register file")
+	}
+}
+
 func TestMain(m *testing.M) {
 	if slices.Contains(os.Args, "-test.bench") {
 		flags := GetFlags()
@@ -318,7 +406,9 @@ func TestMain(m *testing.M) {
 			}
 		}
 		defer BenchmarkCache.Close()
-		BenchmarkCache.Init(BenchmarkTest.key)
+		if err = BenchmarkCache.Init(BenchmarkTest.key); err != nil {
+			panic(err)
+		}
 
 		BenchmarkDataset, err = NewDataset(flags | RANDOMX_FLAG_FULL_MEM | RANDOMX_FLAG_LARGE_PAGES)
 		if err != nil {
@@ -328,7 +418,9 @@ func TestMain(m *testing.M) {
 			}
 		}
 		defer BenchmarkDataset.Close()
-		BenchmarkDataset.InitDatasetParallel(BenchmarkCache, runtime.NumCPU())
+		if err = BenchmarkDataset.InitDatasetParallel(BenchmarkCache, runtime.NumCPU()); err != nil {
+			panic(err)
+		}
 	}
 	os.Exit(m.Run())
 }
@@ -350,6 +442,24 @@ func Benchmark_RandomXLight(b *testing.B) {
 	}
 }
 
+func Benchmark_RandomXLight_Concurrent(b *testing.B) {
+	b.ReportAllocs()
+
+	// ignored by the JIT
+	vm, err := NewVM((BenchmarkFlags|RANDOMX_FLAG_LIGHT_CONCURRENT)&^RANDOMX_FLAG_JIT, BenchmarkCache, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer vm.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var output_hash [32]byte
+		vm.CalculateHash(BenchmarkTest.input, &output_hash)
+		runtime.KeepAlive(output_hash)
+	}
+}
+
 func Benchmark_RandomXFull(b *testing.B) {
 	b.ReportAllocs()
 
@@ -367,6 +477,46 @@ func Benchmark_RandomXFull(b *testing.B) {
 	}
 }
 
+// Benchmark_RandomXFull_Interpreter Full mode without the JIT, as used with -tags disable_jit or on platforms without it
+func Benchmark_RandomXFull_Interpreter(b *testing.B) {
+	b.ReportAllocs()
+
+	vm, err := NewVM((BenchmarkFlags|RANDOMX_FLAG_FULL_MEM)&^RANDOMX_FLAG_JIT, nil, BenchmarkDataset)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer vm.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var output_hash [32]byte
+		vm.CalculateHash(BenchmarkTest.input, &output_hash)
+		runtime.KeepAlive(output_hash)
+	}
+}
+
+// Benchmark_RandomXFull_Next Pipelined hashing, where the scratchpad is hashed and refilled in one sweep
+func Benchmark_RandomXFull_Next(b *testing.B) {
+	b.ReportAllocs()
+
+	vm, err := NewVM(BenchmarkFlags|RANDOMX_FLAG_FULL_MEM, nil, BenchmarkDataset)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer vm.Close()
+
+	if err = vm.CalculateHashFirst(BenchmarkTest.input); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var output_hash [32]byte
+		vm.CalculateHashNext(BenchmarkTest.input, &output_hash)
+		runtime.KeepAlive(output_hash)
+	}
+}
+
 func Benchmark_RandomXLight_Parallel(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
@@ -406,3 +556,46 @@ func Benchmark_RandomXFull_Parallel(b *testing.B) {
 		}
 	})
 }
+
+// Benchmark_ByteCode_Execute Runs the last program of a hash on its register state, without the JIT
+func Benchmark_ByteCode_Execute(b *testing.B) {
+	flags := BenchmarkFlags &^ RANDOMX_FLAG_JIT
+
+	cache, err := NewCache(flags)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cache.Close()
+	if err = cache.Init(BenchmarkTest.key); err != nil {
+		b.Fatal(err)
+	}
+
+	vm, err := NewVM(flags, cache, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer vm.Close()
+
+	var output_hash [32]byte
+	if err = vm.CalculateHash(BenchmarkTest.input, &output_hash); err != nil {
+		b.Fatal(err)
+	}
+
+	entropy := (*[16]uint64)(unsafe.Pointer(unsafe.SliceData(vm.buffer)))
+	eMask := [2]uint64{ExponentMask(entropy[14]), ExponentMask(entropy[15])}
+	reg := *vm.registerFile
+
+	if lockThreadDueToRoundingMode {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+	defer ResetRoundingMode(vm.registerFile)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ResetRoundingMode(vm.registerFile)
+		SetRoundingMode(vm.registerFile, reg.FPRC)
+		*vm.registerFile = reg
+		vm.program.execute(vm.registerFile, vm.pad, eMask)
+	}
+}
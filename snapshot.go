@@ -0,0 +1,505 @@
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
+	"golang.org/x/crypto/blake2b"
+	"hash/crc32"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// Snapshot file format, all values little-endian
+//
+//	magic       [8]byte  "RandomX\x00"
+//	version     uint32   SnapshotVersion
+//	kind        uint32   1 = Cache, 2 = Dataset
+//	keyHash     [32]byte blake2b-256 of the key
+//	configHash  [32]byte blake2b-256 of the Config parameter set
+//	payloadSize uint64   size in bytes of the payload following the header
+//	checksum    uint32   CRC-32C of the payload
+//	reserved    [4]byte
+//	padding     zero bytes up to snapshotHeaderSize
+//
+// Cache payload is the Argon2 memory, followed by each SuperScalarProgram as an uint32 instruction count
+// and 16 bytes per instruction (opcode, dst, src, mod, imm32, imm64).
+// Dataset payload is the Dataset memory.
+
+// SnapshotVersion Current version of the Cache and Dataset snapshot format
+const SnapshotVersion = 1
+
+const snapshotMagic = "RandomX\x00"
+
+// snapshotHeaderSize Header is padded to a page, so the payload of a memory mapped snapshot is page aligned
+const snapshotHeaderSize = 4096
+
+// snapshotChecksumOffset Offset of the checksum within the header
+const snapshotChecksumOffset = 88
+
+const superscalarInstructionSize = 16
+
+type snapshotKind uint32
+
+const (
+	snapshotKindCache   = snapshotKind(1)
+	snapshotKindDataset = snapshotKind(2)
+)
+
+var snapshotChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+type snapshotHeader struct {
+	kind        snapshotKind
+	keyHash     [32]byte
+	configHash  [32]byte
+	payloadSize uint64
+	checksum    uint32
+}
+
+func newSnapshotHeader(kind snapshotKind, key []byte, config *params, payloadSize uint64) snapshotHeader {
+	return snapshotHeader{
+		kind:        kind,
+		keyHash:     blake2b.Sum256(key),
+		configHash:  config.hash(),
+		payloadSize: payloadSize,
+	}
+}
+
+func (h snapshotHeader) bytes() []byte {
+	buf := make([]byte, snapshotHeaderSize)
+	copy(buf, snapshotMagic)
+	binary.LittleEndian.PutUint32(buf[8:], SnapshotVersion)
+	binary.LittleEndian.PutUint32(buf[12:], uint32(h.kind))
+	copy(buf[16:], h.keyHash[:])
+	copy(buf[48:], h.configHash[:])
+	binary.LittleEndian.PutUint64(buf[80:], h.payloadSize)
+	binary.LittleEndian.PutUint32(buf[snapshotChecksumOffset:], h.checksum)
+	return buf
+}
+
+// readSnapshotHeader Reads a header and verifies it matches the expected kind, key and config
+func readSnapshotHeader(r io.Reader, kind snapshotKind, key []byte, config *params) (h snapshotHeader, err error) {
+	buf := make([]byte, snapshotHeaderSize)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return h, err
+	}
+	if string(buf[:8]) != snapshotMagic {
+		return h, errors.New("invalid snapshot header")
+	}
+	if binary.LittleEndian.Uint32(buf[8:]) != SnapshotVersion {
+		return h, errors.New("unsupported snapshot version")
+	}
+	h.kind = snapshotKind(binary.LittleEndian.Uint32(buf[12:]))
+	copy(h.keyHash[:], buf[16:])
+	copy(h.configHash[:], buf[48:])
+	h.payloadSize = binary.LittleEndian.Uint64(buf[80:])
+	h.checksum = binary.LittleEndian.Uint32(buf[snapshotChecksumOffset:])
+
+	if h.kind != kind {
+		return h, errors.New("snapshot kind mismatch")
+	}
+	if h.configHash != config.hash() {
+		return h, errors.New("snapshot config mismatch")
+	}
+	if h.keyHash != blake2b.Sum256(key) {
+		return h, errors.New("snapshot key mismatch")
+	}
+	return h, nil
+}
+
+// hash Returns a hash identifying the parameter set
+func (p *params) hash() [32]byte {
+	c := &p.Config
+	var buf []byte
+	for _, v := range []uint32{c.ArgonMemory, c.ArgonIterations, c.ArgonLanes, uint32(len(c.ArgonSalt))} {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	buf = append(buf, c.ArgonSalt...)
+	buf = binary.LittleEndian.AppendUint32(buf, c.CacheAccesses)
+	buf = binary.LittleEndian.AppendUint32(buf, c.SuperscalarLatency)
+	buf = binary.LittleEndian.AppendUint64(buf, c.DatasetBaseSize)
+	buf = binary.LittleEndian.AppendUint64(buf, c.DatasetExtraSize)
+	for _, v := range []uint32{c.ProgramSize, c.ProgramIterations, c.ProgramCount, c.ScratchpadL3, c.ScratchpadL2, c.ScratchpadL1, c.JumpBits, c.JumpOffset} {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	for _, v := range c.Frequencies.slice() {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	for _, k := range c.AesGenerator4RKeys {
+		for _, v := range k {
+			buf = binary.LittleEndian.AppendUint32(buf, v)
+		}
+	}
+	return blake2b.Sum256(buf)
+}
+
+func (c *Cache) memoryBytes() []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(c.blocks))), len(c.blocks)*int(unsafe.Sizeof(MemoryBlock{})))
+}
+
+func (c *Cache) programBytes() []byte {
+	var buf []byte
+	for _, prog := range c.programs {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(prog)))
+		for _, ins := range prog {
+			buf = append(buf, ins.Opcode, ins.Dst, ins.Src, ins.Mod)
+			buf = binary.LittleEndian.AppendUint32(buf, ins.Imm32)
+			buf = binary.LittleEndian.AppendUint64(buf, ins.Imm64)
+		}
+	}
+	return buf
+}
+
+// Save Writes the initialized Cache to w, including the Argon2 memory and SuperscalarHash programs.
+func (c *Cache) Save(w io.Writer) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	key := c.Key()
+	if key == nil {
+		return ErrNotInitialized
+	}
+
+	mem := c.memoryBytes()
+	programs := c.programBytes()
+
+	header := newSnapshotHeader(snapshotKindCache, key, c.config, uint64(len(mem)+len(programs)))
+	header.checksum = crc32.Update(crc32.Checksum(mem, snapshotChecksumTable), snapshotChecksumTable, programs)
+
+	for _, buf := range [][]byte{header.bytes(), mem, programs} {
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load Initializes the Cache from a snapshot written by Save, instead of calling Init with key.
+// The snapshot must have been created with the same key and Config.
+// On error the Cache is left uninitialized.
+// VMs using this Cache must be updated via VM.SetCache afterward.
+func (c *Cache) Load(r io.Reader, key []byte) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+
+	header, err := readSnapshotHeader(r, snapshotKindCache, key, c.config)
+	if err != nil {
+		return err
+	}
+
+	mem := c.memoryBytes()
+	maxProgramsSize := uint64(c.config.CacheAccesses) * (4 + uint64(c.config.superscalarMaxSize+1)*superscalarInstructionSize)
+	if header.payloadSize < uint64(len(mem)) || header.payloadSize-uint64(len(mem)) > maxProgramsSize {
+		return errors.New("invalid snapshot size")
+	}
+
+	// contents are about to be overwritten
+	c.key = nil
+	c.closeJIT()
+	c.generation.Add(1)
+
+	if _, err = io.ReadFull(r, mem); err != nil {
+		return err
+	}
+	programs := make([]byte, header.payloadSize-uint64(len(mem)))
+	if _, err = io.ReadFull(r, programs); err != nil {
+		return err
+	}
+
+	if crc32.Update(crc32.Checksum(mem, snapshotChecksumTable), snapshotChecksumTable, programs) != header.checksum {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	for i := range c.programs {
+		if len(programs) < 4 {
+			return errors.New("invalid snapshot programs")
+		}
+		n := binary.LittleEndian.Uint32(programs)
+		programs = programs[4:]
+		if n < 1 || n > uint32(c.config.superscalarMaxSize+1) || len(programs) < int(n)*superscalarInstructionSize {
+			return errors.New("invalid snapshot programs")
+		}
+
+		prog := make(SuperScalarProgram, n)
+		for j := range prog {
+			ins := &prog[j]
+			ins.Opcode, ins.Dst, ins.Src, ins.Mod = programs[0], programs[1], programs[2], programs[3]
+			ins.Imm32 = binary.LittleEndian.Uint32(programs[4:])
+			ins.Imm64 = binary.LittleEndian.Uint64(programs[8:])
+			programs = programs[superscalarInstructionSize:]
+
+			// the first entry only holds the address register, all others must be real instructions
+			if ins.Dst >= RegistersCount || (j > 0 && (ins.Opcode > S_IMUL_RCP || (ins.Src >= RegistersCount && ins.Src != 0xff))) {
+				return errors.New("invalid snapshot programs")
+			}
+		}
+		c.programs[i] = prog
+	}
+	if len(programs) != 0 {
+		return errors.New("invalid snapshot programs")
+	}
+
+	c.compilePrograms()
+
+	c.key = append([]byte{}, key...)
+	c.generation.Add(1)
+
+	return nil
+}
+
+func (d *Dataset) memoryBytes() []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(d.memory))), len(d.memory)*int(CacheLineSize))
+}
+
+// Save Writes a complete Dataset to w.
+func (d *Dataset) Save(w io.Writer) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	if !d.Complete() {
+		return errors.New("dataset incomplete")
+	}
+
+	mem := d.memoryBytes()
+
+	header := newSnapshotHeader(snapshotKindDataset, d.key, d.config, uint64(len(mem)))
+	header.checksum = crc32.Checksum(mem, snapshotChecksumTable)
+
+	if _, err := w.Write(header.bytes()); err != nil {
+		return err
+	}
+	if _, err := w.Write(mem); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Load Initializes the Dataset from a snapshot written by Save or DatasetWriter, instead of calling InitDataset.
+// The snapshot must have been created with the same key and Config.
+// On error the Dataset is left incomplete.
+func (d *Dataset) Load(r io.Reader, key []byte) error {
+	if d.closed.Load() {
+		return ErrClosed
+	}
+	if d.mapping != nil {
+		return ErrReadOnly
+	}
+
+	header, err := readSnapshotHeader(r, snapshotKindDataset, key, d.config)
+	if err != nil {
+		return err
+	}
+
+	mem := d.memoryBytes()
+	if header.payloadSize != uint64(len(mem)) {
+		return errors.New("invalid snapshot size")
+	}
+
+	d.complete.Store(false)
+	d.key = nil
+
+	if _, err = io.ReadFull(r, mem); err != nil {
+		return err
+	}
+	if crc32.Checksum(mem, snapshotChecksumTable) != header.checksum {
+		return errors.New("snapshot checksum mismatch")
+	}
+
+	d.key = bytes.Clone(key)
+	d.complete.Store(true)
+	return nil
+}
+
+// NewDatasetFromFile Creates a read-only Dataset backed by a snapshot file written by Dataset.Save or DatasetWriter.
+// The file is mapped shared, so multiple processes using the same file share one copy in the page cache.
+// The snapshot must have been created with key and ConfigMonero. Its checksum is verified.
+// Only RANDOMX_FLAG_FULL_MEM VMs are supported, and RANDOMX_FLAG_LARGE_PAGES is ignored.
+func NewDatasetFromFile(flags Flags, path string, key []byte) (*Dataset, error) {
+	return newDatasetFromFile(flags, defaultParams, path, key)
+}
+
+// NewDatasetFromFileWithConfig Same as NewDatasetFromFile, using the RandomX parameters in config instead of ConfigMonero
+func NewDatasetFromFileWithConfig(flags Flags, config Config, path string, key []byte) (*Dataset, error) {
+	p, err := config.params()
+	if err != nil {
+		return nil, err
+	}
+	return newDatasetFromFile(flags, p, path, key)
+}
+
+func newDatasetFromFile(flags Flags, config *params, path string, key []byte) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// mapping stays valid after the file is closed
+	defer f.Close()
+
+	header, err := readSnapshotHeader(f, snapshotKindDataset, key, config)
+	if err != nil {
+		return nil, err
+	}
+	payloadSize := config.datasetItemCount * CacheLineSize
+	if header.payloadSize != payloadSize {
+		return nil, errors.New("invalid snapshot size")
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(stat.Size()) < snapshotHeaderSize+payloadSize {
+		return nil, errors.New("truncated snapshot")
+	}
+
+	fileAllocator := memory.NewFileAllocator(f.Fd())
+	if fileAllocator == nil {
+		return nil, errors.ErrUnsupported
+	}
+
+	mapping, err := fileAllocator.AllocMemory(snapshotHeaderSize + payloadSize)
+	if err != nil {
+		return nil, err
+	}
+	mem := mapping[snapshotHeaderSize:]
+
+	if crc32.Checksum(mem, snapshotChecksumTable) != header.checksum {
+		_ = fileAllocator.FreeMemory(mapping)
+		return nil, errors.New("snapshot checksum mismatch")
+	}
+
+	d := &Dataset{
+		memory:        unsafe.Slice((*RegisterLine)(unsafe.Pointer(unsafe.SliceData(mem))), config.datasetItemCount),
+		flags:         flags,
+		config:        config,
+		key:           bytes.Clone(key),
+		mapping:       mapping,
+		fileAllocator: fileAllocator,
+	}
+	d.complete.Store(true)
+	return d, nil
+}
+
+// datasetWriterChunkItems Number of Dataset items generated in memory at once by DatasetWriter
+const datasetWriterChunkItems = 1 << 16
+
+// DatasetWriter Generates a Dataset snapshot directly to w, range by range, without holding the whole Dataset in memory.
+// The result can be read via Dataset.Load.
+type DatasetWriter struct {
+	w       io.WriteSeeker
+	cache   *Cache
+	threads int
+	// cacheGeneration Cache generation of the key in the header
+	cacheGeneration uint64
+
+	headerOffset int64
+	header       snapshotHeader
+
+	nextItem uint64
+	buf      []RegisterLine
+}
+
+// NewDatasetWriter Writes a snapshot header to w and returns a DatasetWriter for items generated from cache using threads goroutines.
+// The checksum is written into the header on Close, which requires w to be seekable.
+// Writing fails with ErrCacheChanged if cache is initialized with a new key meanwhile.
+func NewDatasetWriter(w io.WriteSeeker, cache *Cache, threads int) (*DatasetWriter, error) {
+	if cache.closed.Load() {
+		return nil, ErrClosed
+	}
+	generation := cache.Generation()
+	key := cache.Key()
+	if key == nil {
+		return nil, ErrNotInitialized
+	}
+
+	offset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	header := newSnapshotHeader(snapshotKindDataset, key, cache.config, cache.config.datasetItemCount*CacheLineSize)
+	if _, err = w.Write(header.bytes()); err != nil {
+		return nil, err
+	}
+
+	return &DatasetWriter{
+		w:               w,
+		cache:           cache,
+		threads:         max(1, threads),
+		cacheGeneration: generation,
+		headerOffset:    offset,
+		header:          header,
+		buf:             make([]RegisterLine, min(datasetWriterChunkItems, cache.config.datasetItemCount)),
+	}, nil
+}
+
+// InitDataset Generates itemCount Dataset items starting at startItem and writes them.
+// Ranges must be written in order, starting at zero and without gaps.
+func (dw *DatasetWriter) InitDataset(startItem, itemCount uint64) error {
+	if dw.cache == nil || dw.cache.closed.Load() {
+		return ErrClosed
+	}
+	if startItem != dw.nextItem {
+		return errors.New("ranges must be written in order")
+	}
+	if itemCount > dw.cache.config.datasetItemCount-startItem {
+		return ErrOutOfRange
+	}
+
+	for itemCount > 0 {
+		n := min(itemCount, uint64(len(dw.buf)))
+		buf := dw.buf[:n]
+
+		if err := dw.cache.datasetInitContext(context.Background(), buf, startItem, dw.threads, nil); err != nil {
+			return err
+		}
+		// checked once generated, as items are read from the Cache while it is re-keyed
+		if dw.cache.Generation() != dw.cacheGeneration {
+			return ErrCacheChanged
+		}
+
+		data := unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(buf))), len(buf)*int(CacheLineSize))
+		dw.header.checksum = crc32.Update(dw.header.checksum, snapshotChecksumTable, data)
+		if _, err := dw.w.Write(data); err != nil {
+			return err
+		}
+
+		startItem += n
+		itemCount -= n
+		dw.nextItem = startItem
+	}
+	return nil
+}
+
+// Close Writes the checksum into the header, leaving w positioned at the end of the snapshot.
+// All Dataset items must have been written.
+func (dw *DatasetWriter) Close() error {
+	if dw.cache == nil {
+		return nil
+	}
+	defer func() {
+		dw.cache = nil
+		dw.buf = nil
+	}()
+
+	if dw.nextItem != dw.cache.config.datasetItemCount {
+		return errors.New("dataset incomplete")
+	}
+
+	end, err := dw.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = dw.w.Seek(dw.headerOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err = dw.w.Write(dw.header.bytes()); err != nil {
+		return err
+	}
+	_, err = dw.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -0,0 +1,276 @@
+package randomx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"slices"
+	"testing"
+)
+
+func Test_Cache_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	var buf bytes.Buffer
+	if err = cache.Save(&buf); err == nil {
+		t.Fatal("expected error saving uninitialized cache")
+	}
+
+	key := Tests[1].key
+	if err := cache.Init(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cache.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	loaded, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	if err = loaded.Load(bytes.NewReader(snapshot), Tests[4].key); err == nil {
+		t.Fatal("expected key mismatch error")
+	}
+
+	if err = loaded.Load(bytes.NewReader(snapshot), key); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(loaded.Key(), key) {
+		t.Fatalf("expected key=%x, actual=%x", key, loaded.Key())
+	}
+	if !slices.Equal(loaded.Memory(), cache.Memory()) {
+		t.Fatal("cache memory mismatch")
+	}
+
+	var expected, actual RegisterLine
+	for _, i := range []uint64{0, 12345, 16000} {
+		cache.initDataset(&expected, i)
+		loaded.initDataset(&actual, i)
+		if expected != actual {
+			t.Fatalf("dataset item %d mismatch", i)
+		}
+	}
+
+	corrupted := slices.Clone(snapshot)
+	corrupted[len(corrupted)/2] ^= 1
+	if err = loaded.Load(bytes.NewReader(corrupted), key); err == nil {
+		t.Fatal("expected checksum error")
+	}
+	if loaded.Key() != nil {
+		t.Fatal("expected cache to be uninitialized after failed load")
+	}
+
+	// a nop past the address register entry is never generated, and cannot be compiled
+	corrupted = slices.Clone(snapshot)
+	corrupted[snapshotHeaderSize+len(cache.memoryBytes())+4+superscalarInstructionSize] = S_NOP
+	binary.LittleEndian.PutUint32(corrupted[snapshotChecksumOffset:], crc32.Checksum(corrupted[snapshotHeaderSize:], snapshotChecksumTable))
+	if err = loaded.Load(bytes.NewReader(corrupted), key); err == nil {
+		t.Fatal("expected invalid programs error")
+	}
+
+	other, err := NewCache(GetFlags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err = other.Load(bytes.NewReader(snapshot), key); err == nil {
+		t.Fatal("expected config mismatch error")
+	}
+}
+
+func Test_Dataset_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	cache, err := NewCacheWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	key := Tests[1].key
+	if err := cache.Init(key); err != nil {
+		t.Fatal(err)
+	}
+
+	dataset, err := NewDatasetWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dataset.Close()
+
+	var buf bytes.Buffer
+	if err = dataset.Save(&buf); err == nil {
+		t.Fatal("expected error saving incomplete dataset")
+	}
+
+	if err := dataset.InitDatasetParallel(cache, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = dataset.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewDatasetWithConfig(GetFlags(), testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+
+	if err = loaded.Load(bytes.NewReader(buf.Bytes()), key); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Complete() || !bytes.Equal(loaded.Key(), key) {
+		t.Fatal("loaded dataset not complete")
+	}
+	if !slices.Equal(loaded.Memory(), dataset.Memory()) {
+		t.Fatal("dataset memory mismatch")
+	}
+
+	t.Run("writer", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "dataset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		w, err := NewDatasetWriter(f, cache, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		itemCount := uint64(len(dataset.Memory()))
+		if err = w.InitDataset(1, 1); err == nil {
+			t.Fatal("expected error writing out of order")
+		}
+		for _, n := range []uint64{1, 1000, 70000} {
+			start := w.nextItem
+			if err = w.InitDataset(start, min(n, itemCount-start)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = w.InitDataset(w.nextItem, itemCount-w.nextItem); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = f.Seek(0, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		clear(loaded.Memory())
+		if err = loaded.Load(f, key); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(loaded.Memory(), dataset.Memory()) {
+			t.Fatal("dataset memory mismatch")
+		}
+
+		t.Run("mapped", func(t *testing.T) {
+			if _, err := NewDatasetFromFileWithConfig(GetFlags(), testConfig, f.Name(), Tests[4].key); err == nil {
+				t.Fatal("expected key mismatch error")
+			}
+			if _, err := NewDatasetFromFile(GetFlags(), f.Name(), key); err == nil {
+				t.Fatal("expected config mismatch error")
+			}
+
+			mapped, err := NewDatasetFromFileWithConfig(GetFlags(), testConfig, f.Name(), key)
+			if err != nil {
+				if errors.Is(err, errors.ErrUnsupported) {
+					t.Skip(err)
+				}
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := mapped.Close(); err != nil {
+					t.Error(err)
+				}
+			}()
+
+			if !slices.Equal(mapped.Memory(), dataset.Memory()) {
+				t.Fatal("dataset memory mismatch")
+			}
+			if err = mapped.InitDatasetContext(context.Background(), cache, 0, 1, 1, nil); err == nil {
+				t.Fatal("expected read-only error")
+			}
+
+			lightVM, err := NewVM(GetFlags(), cache, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer lightVM.Close()
+
+			for _, n := range []string{"interpreter", "compiler"} {
+				tFlags, skip := testFlags(n, RANDOMX_FLAG_FULL_MEM)
+				if skip {
+					continue
+				}
+				vm, err := NewVM(tFlags, nil, mapped)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, test := range Tests[1:4] {
+					var expected, actual [RANDOMX_HASH_SIZE]byte
+					if err := lightVM.CalculateHash(test.input, &expected); err != nil {
+						t.Fatal(err)
+					}
+					if err := vm.CalculateHash(test.input, &actual); err != nil {
+						t.Fatal(err)
+					}
+					if expected != actual {
+						t.Errorf("%s: expected=%x, actual=%x", n, expected, actual)
+					}
+				}
+				vm.Close()
+			}
+		})
+	})
+
+	t.Run("rekey", func(t *testing.T) {
+		other, err := NewCacheWithConfig(GetFlags(), testConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer other.Close()
+		if err := other.Init(key); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.CreateTemp(t.TempDir(), "dataset")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		w, err := NewDatasetWriter(f, other, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if err = w.InitDataset(0, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// the header carries the original key
+		if err := other.Init(Tests[4].key); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.InitDataset(1, 1); !errors.Is(err, ErrCacheChanged) {
+			t.Fatalf("expected ErrCacheChanged, got %v", err)
+		}
+	})
+}
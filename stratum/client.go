@@ -0,0 +1,443 @@
+package stratum
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/miner"
+)
+
+// DefaultTimeout Time without receiving anything after which a connection is considered dead
+const DefaultTimeout = 5 * time.Minute
+
+// DefaultMinBackoff and DefaultMaxBackoff Delays between reconnection attempts
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = time.Minute
+)
+
+// DefaultAgent User agent sent on login
+const DefaultAgent = "go-randomx/v3"
+
+// recentJobs Number of jobs per connection for which shares are still submitted
+const recentJobs = 8
+
+// Options Client settings. Address is required.
+type Options struct {
+	// Address Pool address as host:port
+	Address string
+	Login   string
+	Pass    string
+	// Agent User agent, DefaultAgent if empty
+	Agent string
+	// Algo Algorithms announced on login, rx/0 if empty
+	Algo []string
+
+	// NiceHash Reserve the most significant nonce byte for the pool even if it does not announce ExtensionNiceHash
+	NiceHash bool
+
+	// Dial Connects to the pool, a net.Dialer is used if nil. Can be used to connect via TLS or a proxy.
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// KeepAlive Interval between keepalived requests, disabled if zero
+	KeepAlive time.Duration
+	// Timeout See DefaultTimeout
+	Timeout time.Duration
+	// MinBackoff and MaxBackoff Delay between reconnection attempts, doubling after each failed attempt.
+	// See DefaultMinBackoff and DefaultMaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// Stats Client counters
+type Stats struct {
+	// Accepted Shares accepted by the pool
+	Accepted uint64
+	// Rejected Shares rejected by the pool
+	Rejected uint64
+	// Connects Successful logins
+	Connects uint64
+	// LastError Error that ended the last connection or connection attempt
+	LastError error
+}
+
+// Client Mines via a pool using a miner.Miner. Jobs are handed to the Miner, which re-initializes its Cache and Dataset
+// on seed hash changes, and shares found by the Miner are submitted to the pool.
+type Client struct {
+	miner *miner.Miner
+	opts  Options
+
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+	connects atomic.Uint64
+
+	errLock sync.Mutex
+	lastErr error
+
+	// connections Number of connection attempts, used to tell apart jobs of different connections
+	connections uint64
+}
+
+// NewClient Creates a Client. Call Run to start mining.
+func NewClient(m *miner.Miner, opts Options) *Client {
+	if opts.Agent == "" {
+		opts.Agent = DefaultAgent
+	}
+	if len(opts.Algo) == 0 {
+		opts.Algo = []string{"rx/0"}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(DefaultMaxBackoff, opts.MinBackoff)
+	}
+	if opts.Dial == nil {
+		var dialer net.Dialer
+		opts.Dial = dialer.DialContext
+	}
+	return &Client{
+		miner: m,
+		opts:  opts,
+	}
+}
+
+// Stats Returns share and connection counters
+func (c *Client) Stats() Stats {
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	return Stats{
+		Accepted:  c.accepted.Load(),
+		Rejected:  c.rejected.Load(),
+		Connects:  c.connects.Load(),
+		LastError: c.lastErr,
+	}
+}
+
+func (c *Client) setErr(err error) {
+	c.errLock.Lock()
+	defer c.errLock.Unlock()
+	c.lastErr = err
+}
+
+// Run Connects to the pool and mines until ctx is cancelled, reconnecting with exponential backoff.
+// The Miner is paused while disconnected. Returns ctx.Err(), or an error if the Miner was closed.
+// Run must not be called concurrently.
+func (c *Client) Run(ctx context.Context) error {
+	backoff := c.opts.MinBackoff
+	for {
+		loggedIn, err := c.connect(ctx)
+		c.miner.Pause()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errMinerClosed) {
+			return err
+		}
+		c.setErr(err)
+
+		if loggedIn {
+			backoff = c.opts.MinBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+var errMinerClosed = errors.New("miner closed")
+
+// session State of a single pool connection
+type session struct {
+	client *Client
+	conn   net.Conn
+	enc    *json.Encoder
+	dec    *json.Decoder
+
+	connection uint64
+	id         string
+	nonceMask  uint32
+
+	lock sync.Mutex
+	// pending methods of requests waiting for a response, by id
+	pending map[uint64]string
+	nextID  uint64
+	// jobs recent pool job ids, indexed by miner job id
+	jobs []jobMapping
+}
+
+type jobMapping struct {
+	minerID string
+	poolID  string
+}
+
+// connect Logs in and mines until the connection fails. Returns whether login succeeded.
+func (c *Client) connect(ctx context.Context) (loggedIn bool, err error) {
+	c.connections++
+
+	conn, err := c.opts.Dial(ctx, "tcp", c.opts.Address)
+	if err != nil {
+		return false, err
+	}
+
+	s := &session{
+		client:     c,
+		conn:       conn,
+		enc:        json.NewEncoder(conn),
+		dec:        json.NewDecoder(conn),
+		connection: c.connections,
+		pending:    make(map[uint64]string),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// unblock reads and writes on cancellation
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	job, err := s.login()
+	if err != nil {
+		return false, err
+	}
+	c.connects.Add(1)
+
+	readErr := make(chan error, 1)
+	go func() {
+		// shares are drained below while the Miner switches over, a seed change waits for workers to send them
+		if err := s.setJob(job); err != nil {
+			readErr <- err
+			return
+		}
+		readErr <- s.read()
+	}()
+	defer func() {
+		cancel()
+		<-readErr
+	}()
+
+	var keepAlive <-chan time.Time
+	if c.opts.KeepAlive > 0 {
+		ticker := time.NewTicker(c.opts.KeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case err := <-readErr:
+			// read returned, make sure the deferred wait does not block
+			readErr <- err
+			return true, err
+		case share, ok := <-c.miner.Shares():
+			if !ok {
+				return true, errMinerClosed
+			}
+			if err := s.submit(share); err != nil {
+				return true, err
+			}
+		case <-keepAlive:
+			if err := s.send(MethodKeepalived, KeepalivedParams{ID: s.id}); err != nil {
+				return true, err
+			}
+		}
+	}
+}
+
+// send Sends a request and records it as pending
+func (s *session) send(method string, params any) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.nextID++
+	id := s.nextID
+	s.pending[id] = method
+	s.lock.Unlock()
+
+	_ = s.conn.SetWriteDeadline(time.Now().Add(s.client.opts.Timeout))
+	return s.enc.Encode(Message{
+		ID:      json.RawMessage(strconv.FormatUint(id, 10)),
+		JSONRPC: "2.0",
+		Method:  method,
+		Params:  p,
+	})
+}
+
+// receive Reads the next message
+func (s *session) receive() (*Message, error) {
+	_ = s.conn.SetReadDeadline(time.Now().Add(s.client.opts.Timeout))
+	var msg Message
+	if err := s.dec.Decode(&msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+func (s *session) login() (*Job, error) {
+	if err := s.send(MethodLogin, LoginParams{
+		Login: s.client.opts.Login,
+		Pass:  s.client.opts.Pass,
+		Agent: s.client.opts.Agent,
+		Algo:  s.client.opts.Algo,
+	}); err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := s.receive()
+		if err != nil {
+			return nil, err
+		}
+		if msg.Method != "" {
+			// ignore notifications before login completes
+			continue
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+
+		var result LoginResult
+		if err := json.Unmarshal(msg.Result, &result); err != nil {
+			return nil, err
+		}
+		if result.Job == nil {
+			return nil, errors.New("login result without job")
+		}
+
+		s.id = result.ID
+		if s.client.opts.NiceHash || slices.Contains(result.Extensions, ExtensionNiceHash) {
+			s.nonceMask = 0x00ffffff
+		}
+		return result.Job, nil
+	}
+}
+
+// read Handles responses and job notifications until the connection fails
+func (s *session) read() error {
+	for {
+		msg, err := s.receive()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case msg.Method == MethodJob:
+			var job Job
+			if err := json.Unmarshal(msg.Params, &job); err != nil {
+				return err
+			}
+			if err := s.setJob(&job); err != nil {
+				return err
+			}
+		case msg.Method == "" && len(msg.ID) > 0:
+			s.response(msg)
+		}
+	}
+}
+
+// response Updates share counters from submit responses
+func (s *session) response(msg *Message) {
+	id, err := strconv.ParseUint(string(msg.ID), 10, 64)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	method, ok := s.pending[id]
+	delete(s.pending, id)
+	s.lock.Unlock()
+
+	if !ok || method != MethodSubmit {
+		return
+	}
+
+	var result StatusResult
+	if msg.Error == nil && json.Unmarshal(msg.Result, &result) == nil && result.Status == StatusOK {
+		s.client.accepted.Add(1)
+	} else {
+		s.client.rejected.Add(1)
+	}
+}
+
+// setJob Hands a pool job to the Miner
+func (s *session) setJob(job *Job) error {
+	blob, target, seedHash, err := job.Decode()
+	if err != nil {
+		return err
+	}
+
+	minerID := fmt.Sprintf("%d/%s", s.connection, job.JobID)
+
+	s.lock.Lock()
+	if len(s.jobs) == recentJobs {
+		s.jobs = slices.Delete(s.jobs, 0, 1)
+	}
+	s.jobs = append(s.jobs, jobMapping{minerID: minerID, poolID: job.JobID})
+	s.lock.Unlock()
+
+	err = s.client.miner.SetJob(miner.Job{
+		ID:          minerID,
+		Blob:        blob,
+		NonceOffset: NonceOffset,
+		NonceMask:   s.nonceMask,
+		Target:      target,
+		SeedHash:    seedHash,
+	})
+	if errors.Is(err, randomx.ErrClosed) || errors.Is(err, context.Canceled) {
+		return errMinerClosed
+	}
+	return err
+}
+
+// submit Sends a share to the pool. Shares of jobs from previous connections or older jobs are dropped.
+func (s *session) submit(share miner.Share) error {
+	var poolID string
+	s.lock.Lock()
+	for _, j := range s.jobs {
+		if j.minerID == share.JobID {
+			poolID = j.poolID
+		}
+	}
+	s.lock.Unlock()
+
+	if poolID == "" {
+		return nil
+	}
+
+	var nonce [4]byte
+	binary.LittleEndian.PutUint32(nonce[:], share.Nonce)
+
+	return s.send(MethodSubmit, SubmitParams{
+		ID:     s.id,
+		JobID:  poolID,
+		Nonce:  hex.EncodeToString(nonce[:]),
+		Result: share.Hash.String(),
+	})
+}
@@ -0,0 +1,486 @@
+package stratum
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/miner"
+)
+
+// testConfig Small configuration so that tests run quickly
+var testConfig = func() randomx.Config {
+	c := randomx.ConfigMonero
+	c.ArgonMemory = 256
+	c.ArgonSalt = "RandomX\x03test"
+	c.DatasetBaseSize = 1 << 20
+	c.DatasetExtraSize = 64 * 7
+	c.ProgramSize = 64
+	c.ProgramIterations = 128
+	c.ProgramCount = 4
+	c.ScratchpadL3 = 1 << 16
+	c.ScratchpadL2 = 1 << 14
+	c.ScratchpadL1 = 1 << 12
+	return c
+}()
+
+// fakePoolConn Connection accepted by fakePool
+type fakePoolConn struct {
+	conn net.Conn
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+// write Sends a message, errors are ignored as the client may have disconnected
+func (c *fakePoolConn) write(msg Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_ = c.enc.Encode(msg)
+}
+
+// fakePoolEvent Request received by fakePool
+type fakePoolEvent struct {
+	conn   *fakePoolConn
+	method string
+	submit SubmitParams
+	valid  bool
+	// rejected Share was answered with an error
+	rejected bool
+}
+
+// fakePool In-process pool that hands out a fixed job on login and verifies submitted shares
+type fakePool struct {
+	t        *testing.T
+	listener net.Listener
+
+	lock sync.Mutex
+	jobs map[string]Job
+	// login job handed out on login
+	login Job
+	// reject rejects valid shares while set
+	reject bool
+
+	events chan fakePoolEvent
+}
+
+func newFakePool(t *testing.T, job Job) *fakePool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakePool{
+		t:        t,
+		listener: listener,
+		jobs:     map[string]Job{job.JobID: job},
+		login:    job,
+		events:   make(chan fakePoolEvent, 1024),
+	}
+	go p.accept()
+	return p
+}
+
+// setLogin Adds a job handed out on following logins
+func (p *fakePool) setLogin(job Job) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.jobs[job.JobID] = job
+	p.login = job
+}
+
+func (p *fakePool) accept() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(&fakePoolConn{conn: conn, enc: json.NewEncoder(conn)})
+	}
+}
+
+func (p *fakePool) handle(c *fakePoolConn) {
+	defer c.conn.Close()
+	dec := json.NewDecoder(c.conn)
+	for {
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+
+		switch msg.Method {
+		case MethodLogin:
+			p.lock.Lock()
+			job := p.login
+			p.lock.Unlock()
+			result, _ := json.Marshal(LoginResult{
+				ID:         "session",
+				Job:        &job,
+				Extensions: []string{ExtensionNiceHash, "keepalive"},
+				Status:     StatusOK,
+			})
+			c.write(Message{ID: msg.ID, JSONRPC: "2.0", Result: result})
+			p.events <- fakePoolEvent{conn: c, method: msg.Method}
+		case MethodSubmit:
+			var params SubmitParams
+			_ = json.Unmarshal(msg.Params, &params)
+			valid := p.verify(params)
+
+			p.lock.Lock()
+			reject := p.reject
+			p.lock.Unlock()
+
+			rejected := !valid || reject
+			if !rejected {
+				result, _ := json.Marshal(StatusResult{Status: StatusOK})
+				c.write(Message{ID: msg.ID, JSONRPC: "2.0", Result: result})
+			} else {
+				c.write(Message{ID: msg.ID, JSONRPC: "2.0", Error: &Error{Code: -1, Message: "Low difficulty share"}})
+			}
+			p.events <- fakePoolEvent{conn: c, method: msg.Method, submit: params, valid: valid, rejected: rejected}
+		case MethodKeepalived:
+			result, _ := json.Marshal(StatusResult{Status: StatusKeepalived})
+			c.write(Message{ID: msg.ID, JSONRPC: "2.0", Result: result})
+			p.events <- fakePoolEvent{conn: c, method: msg.Method}
+		}
+	}
+}
+
+// verify Recalculates the hash of a submitted share
+func (p *fakePool) verify(params SubmitParams) bool {
+	p.lock.Lock()
+	job, ok := p.jobs[params.JobID]
+	p.lock.Unlock()
+	if !ok || params.ID != "session" {
+		return false
+	}
+
+	blob, target, seedHash, err := job.Decode()
+	if err != nil {
+		return false
+	}
+	nonce, err := hex.DecodeString(params.Nonce)
+	if err != nil || len(nonce) != 4 {
+		return false
+	}
+	// nicehash: the most significant nonce byte is reserved for the pool
+	if nonce[3] != blob[NonceOffset+3] {
+		return false
+	}
+	copy(blob[NonceOffset:], nonce)
+
+	cache, err := randomx.NewCacheWithConfig(randomx.GetFlags(), testConfig)
+	if err != nil {
+		return false
+	}
+	defer cache.Close()
+	if err := cache.Init(seedHash); err != nil {
+		return false
+	}
+	vm, err := randomx.NewVM(randomx.GetFlags(), cache, nil)
+	if err != nil {
+		return false
+	}
+	defer vm.Close()
+
+	var hash randomx.Hash
+	if err := vm.CalculateHash(blob, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		return false
+	}
+	return hash.String() == params.Result && hash.MeetsTarget(target)
+}
+
+// next Waits for the next request with the given method
+func (p *fakePool) next(method string) fakePoolEvent {
+	p.t.Helper()
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case e := <-p.events:
+			if e.method == method {
+				return e
+			}
+		case <-timeout:
+			p.t.Fatalf("timed out waiting for %s", method)
+		}
+	}
+}
+
+func testJob(id string, seed string, fill byte) Job {
+	return Job{
+		Blob:     hex.EncodeToString(bytes.Repeat([]byte{fill}, 76)),
+		JobID:    id,
+		Target:   randomx.FormatTarget(randomx.TargetFromDifficulty(4)),
+		Algo:     "rx/0",
+		SeedHash: hex.EncodeToString([]byte(seed)),
+	}
+}
+
+func Test_Client(t *testing.T) {
+	t.Parallel()
+
+	pool := newFakePool(t, testJob("1", "test key 000", 0x11))
+	defer pool.listener.Close()
+
+	m, err := miner.NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	client := NewClient(m, Options{
+		Address:    pool.listener.Addr().String(),
+		Login:      "wallet",
+		Pass:       "x",
+		KeepAlive:  50 * time.Millisecond,
+		MinBackoff: 10 * time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(ctx)
+	}()
+
+	login := pool.next(MethodLogin)
+
+	for i := 0; i < 2; i++ {
+		if e := pool.next(MethodSubmit); !e.valid || e.submit.JobID != "1" {
+			t.Fatalf("unexpected share %+v", e.submit)
+		}
+	}
+	pool.next(MethodKeepalived)
+
+	// rejected shares
+	pool.lock.Lock()
+	pool.reject = true
+	pool.lock.Unlock()
+	// shares sent before reject was set may still be queued
+	for !pool.next(MethodSubmit).rejected {
+	}
+	pool.lock.Lock()
+	pool.reject = false
+	pool.lock.Unlock()
+
+	// new job with a different seed
+	job := testJob("2", "test key 001", 0x22)
+	pool.lock.Lock()
+	pool.jobs[job.JobID] = job
+	pool.lock.Unlock()
+	params, _ := json.Marshal(job)
+	login.conn.write(Message{JSONRPC: "2.0", Method: MethodJob, Params: params})
+
+	for {
+		e := pool.next(MethodSubmit)
+		if e.submit.JobID == "2" {
+			if !e.valid {
+				t.Fatalf("unexpected share %+v", e.submit)
+			}
+			break
+		}
+	}
+
+	// reconnect after the pool drops the connection
+	_ = login.conn.conn.Close()
+	relogin := pool.next(MethodLogin)
+	for {
+		// skip shares that were in flight on the dropped connection
+		e := pool.next(MethodSubmit)
+		if e.conn != relogin.conn {
+			continue
+		}
+		if !e.valid || e.submit.JobID != "1" {
+			t.Fatalf("unexpected share after reconnect %+v", e.submit)
+		}
+		break
+	}
+
+	// wait for responses to be counted
+	deadline := time.Now().Add(time.Minute)
+	for client.Stats().Accepted < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stats := client.Stats()
+	if stats.Accepted < 4 || stats.Rejected < 1 || stats.Connects != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.LastError == nil {
+		t.Error("expected error from dropped connection")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+// holdConn Connection whose writes block while hold is set, then fail once release is closed
+type holdConn struct {
+	net.Conn
+	hold    *atomic.Bool
+	release chan struct{}
+}
+
+func (c *holdConn) Write(b []byte) (int, error) {
+	if c.hold.Load() {
+		<-c.release
+		return 0, net.ErrClosed
+	}
+	return c.Conn.Write(b)
+}
+
+func Test_Client_ReconnectFullShares(t *testing.T) {
+	t.Parallel()
+
+	// every hash is a share
+	job := testJob("1", "test key 000", 0x11)
+	job.Target = randomx.FormatTarget(randomx.TargetFromDifficulty(1))
+	pool := newFakePool(t, job)
+	defer pool.listener.Close()
+
+	m, err := miner.NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var hold atomic.Bool
+	release := make(chan struct{})
+	client := NewClient(m, Options{
+		Address:    pool.listener.Addr().String(),
+		MinBackoff: 10 * time.Millisecond,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			return &holdConn{Conn: conn, hold: &hold, release: release}, nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	pool.next(MethodLogin)
+	pool.next(MethodSubmit)
+
+	// stall submits until the Miner fills Shares
+	hold.Store(true)
+	deadline := time.Now().Add(time.Minute)
+	for len(m.Shares()) < cap(m.Shares()) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for Shares to fill")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// drop the connection, the new one gets a job with a different seed
+	pool.setLogin(testJob("2", "test key 001", 0x22))
+	hold.Store(false)
+	close(release)
+
+	relogin := pool.next(MethodLogin)
+	for {
+		e := pool.next(MethodSubmit)
+		if e.conn != relogin.conn {
+			continue
+		}
+		if !e.valid || e.submit.JobID != "2" {
+			t.Fatalf("unexpected share after reconnect %+v", e.submit)
+		}
+		break
+	}
+}
+
+func Test_Client_Backoff(t *testing.T) {
+	t.Parallel()
+
+	// reserve an address nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+
+	m, err := miner.NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var lock sync.Mutex
+	var attempts []time.Time
+	client := NewClient(m, Options{
+		Address:    address,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 40 * time.Millisecond,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			lock.Lock()
+			attempts = append(attempts, time.Now())
+			lock.Unlock()
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := client.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	// 10 + 20 + 40 + 40 + ... ms
+	if len(attempts) < 4 || len(attempts) > 10 {
+		t.Fatalf("unexpected number of attempts %d", len(attempts))
+	}
+	if gap := attempts[2].Sub(attempts[1]); gap < 20*time.Millisecond {
+		t.Errorf("backoff did not grow: %s", gap)
+	}
+	if client.Stats().LastError == nil {
+		t.Error("expected dial error")
+	}
+}
+
+func Test_Client_MinerClosed(t *testing.T) {
+	t.Parallel()
+
+	pool := newFakePool(t, testJob("1", "test key 000", 0x11))
+	defer pool.listener.Close()
+
+	m, err := miner.NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(m, Options{Address: pool.listener.Addr().String()})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Run(context.Background())
+	}()
+	pool.next(MethodLogin)
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected error")
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("Run did not return after the Miner was closed")
+	}
+}
@@ -0,0 +1,115 @@
+// Package stratum implements the Monero (XMRig dialect) JSON-RPC stratum protocol over newline delimited JSON.
+package stratum
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// Methods used by the protocol
+const (
+	MethodLogin      = "login"
+	MethodJob        = "job"
+	MethodSubmit     = "submit"
+	MethodKeepalived = "keepalived"
+)
+
+// Statuses returned in results
+const (
+	StatusOK         = "OK"
+	StatusKeepalived = "KEEPALIVED"
+)
+
+// ExtensionNiceHash Login extension signalling that the pool reserves the most significant nonce byte
+const ExtensionNiceHash = "nicehash"
+
+// NonceOffset Offset of the nonce in Monero hashing blobs as sent by pools
+const NonceOffset = 39
+
+// Message JSON-RPC request, response or notification. Notifications have no ID.
+type Message struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	JSONRPC string          `json:"jsonrpc,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error JSON-RPC error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("stratum error %d: %s", e.Code, e.Message)
+}
+
+// Job Job notification parameters, also sent in LoginResult
+type Job struct {
+	Blob     string `json:"blob"`
+	JobID    string `json:"job_id"`
+	Target   string `json:"target"`
+	Algo     string `json:"algo,omitempty"`
+	Height   uint64 `json:"height,omitempty"`
+	SeedHash string `json:"seed_hash"`
+}
+
+// Decode Returns the hashing blob, 64-bit target and seed hash of the job
+func (j *Job) Decode() (blob []byte, target uint64, seedHash []byte, err error) {
+	if blob, err = hex.DecodeString(j.Blob); err != nil {
+		return nil, 0, nil, err
+	}
+	if len(blob) < NonceOffset+4 {
+		return nil, 0, nil, errors.New("blob too short")
+	}
+	if target, err = randomx.ParseTarget(j.Target); err != nil {
+		return nil, 0, nil, err
+	}
+	if seedHash, err = hex.DecodeString(j.SeedHash); err != nil {
+		return nil, 0, nil, err
+	}
+	if len(seedHash) == 0 {
+		return nil, 0, nil, errors.New("empty seed hash")
+	}
+	return blob, target, seedHash, nil
+}
+
+// LoginParams Parameters of the login request
+type LoginParams struct {
+	Login string   `json:"login"`
+	Pass  string   `json:"pass"`
+	Agent string   `json:"agent,omitempty"`
+	Algo  []string `json:"algo,omitempty"`
+}
+
+// LoginResult Result of the login request
+type LoginResult struct {
+	ID         string   `json:"id"`
+	Job        *Job     `json:"job"`
+	Extensions []string `json:"extensions,omitempty"`
+	Status     string   `json:"status"`
+}
+
+// SubmitParams Parameters of the submit request. Nonce is 4 bytes and Result 32 bytes, both hex encoded.
+type SubmitParams struct {
+	ID     string `json:"id"`
+	JobID  string `json:"job_id"`
+	Nonce  string `json:"nonce"`
+	Result string `json:"result"`
+}
+
+// KeepalivedParams Parameters of the keepalived request
+type KeepalivedParams struct {
+	ID string `json:"id"`
+}
+
+// StatusResult Result of submit and keepalived requests
+type StatusResult struct {
+	Status string `json:"status"`
+}
@@ -0,0 +1,596 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+)
+
+// Defaults for ServerOptions
+const (
+	DefaultStartDifficulty  = 10000
+	DefaultMinDifficulty    = 1000
+	DefaultTargetTime       = 30 * time.Second
+	DefaultRetargetInterval = 2 * time.Minute
+)
+
+// MaxConnections Maximum number of concurrent connections, each is given a distinct most significant nonce byte
+const MaxConnections = 256
+
+// Error codes and messages sent for rejected requests
+var (
+	ErrUnauthenticated = &Error{Code: -1, Message: "Unauthenticated"}
+	ErrInvalidJobID    = &Error{Code: -1, Message: "Invalid job id"}
+	ErrStaleShare      = &Error{Code: -1, Message: "Block expired"}
+	ErrInvalidNonce    = &Error{Code: -1, Message: "Invalid nonce"}
+	ErrDuplicateShare  = &Error{Code: -1, Message: "Duplicate share"}
+	ErrInvalidResult   = &Error{Code: -1, Message: "Incorrect hash"}
+	ErrLowDifficulty   = &Error{Code: -1, Message: "Low difficulty share"}
+	ErrNoTemplate      = &Error{Code: -1, Message: "No job available"}
+	ErrInternal        = &Error{Code: -1, Message: "Internal error"}
+)
+
+// Template Block template jobs are built from
+type Template struct {
+	// Blob Block hashing blob, with the nonce at NonceOffset. The nonce is overwritten for each connection.
+	Blob   []byte
+	Height uint64
+	// SeedHash RandomX key, the hash of the block at randomx.SeedHeight(Height)
+	SeedHash []byte
+	// NextSeedHash Next RandomX key if known, prepared in the background. See randomx.EpochManager.Update
+	NextSeedHash []byte
+	// Difficulty Network difficulty, shares meeting it raise ServerOptions.OnBlock
+	Difficulty randomx.Difficulty
+}
+
+// Block Share that meets the network difficulty
+type Block struct {
+	Height uint64
+	// Blob Hashing blob including the found nonce
+	Blob  []byte
+	Nonce uint32
+	Hash  randomx.Hash
+	// Login of the connection that found it
+	Login string
+}
+
+// ServerOptions Server settings, zero values are replaced by defaults
+type ServerOptions struct {
+	// StartDifficulty Share difficulty for new connections, see DefaultStartDifficulty
+	StartDifficulty uint64
+	// MinDifficulty and MaxDifficulty bound vardiff, see DefaultMinDifficulty. MaxDifficulty zero means unbounded.
+	MinDifficulty uint64
+	MaxDifficulty uint64
+	// TargetTime Time between shares vardiff aims for, see DefaultTargetTime
+	TargetTime time.Duration
+	// RetargetInterval Minimum time between difficulty changes of a connection, see DefaultRetargetInterval
+	RetargetInterval time.Duration
+	// Timeout Connections are closed when nothing was received for this long, see DefaultTimeout
+	Timeout time.Duration
+
+	// OnBlock Called when a share meets the network difficulty, from the goroutine of the connection that found it
+	OnBlock func(Block)
+}
+
+// ServerStats Server counters
+type ServerStats struct {
+	Connections int
+	Accepted    uint64
+	Rejected    uint64
+	Blocks      uint64
+}
+
+// serverTemplate Template along with the nonces already submitted for it
+type serverTemplate struct {
+	Template
+
+	lock      sync.Mutex
+	submitted map[uint32]struct{}
+}
+
+// Server Minimal stratum pool server. Jobs are built from the Template set via SetTemplate, and shares are verified
+// with VMs obtained from an EpochManager, in light or full mode depending on its flags.
+// Each connection is given a distinct most significant nonce byte via ExtensionNiceHash, so connections never duplicate work.
+type Server struct {
+	epochs *randomx.EpochManager
+	opts   ServerOptions
+
+	lock      sync.Mutex
+	template  *serverTemplate
+	conns     map[*serverConn]struct{}
+	prefixes  [MaxConnections]bool
+	listeners map[net.Listener]struct{}
+	closed    bool
+
+	jobID    atomic.Uint64
+	accepted atomic.Uint64
+	rejected atomic.Uint64
+	blocks   atomic.Uint64
+}
+
+// NewServer Creates a Server verifying shares with VMs from epochs. The EpochManager is not closed by the Server.
+func NewServer(epochs *randomx.EpochManager, opts ServerOptions) *Server {
+	if opts.StartDifficulty == 0 {
+		opts.StartDifficulty = DefaultStartDifficulty
+	}
+	if opts.MinDifficulty == 0 {
+		opts.MinDifficulty = min(DefaultMinDifficulty, opts.StartDifficulty)
+	}
+	if opts.TargetTime <= 0 {
+		opts.TargetTime = DefaultTargetTime
+	}
+	if opts.RetargetInterval <= 0 {
+		opts.RetargetInterval = DefaultRetargetInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	return &Server{
+		epochs:    epochs,
+		opts:      opts,
+		conns:     make(map[*serverConn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+	}
+}
+
+// SetTemplate Switches the EpochManager over to the template seed hash and sends new jobs to all connections.
+// Shares for templates of lower height are rejected as stale from now on.
+func (s *Server) SetTemplate(t Template) error {
+	if len(t.Blob) < NonceOffset+4 {
+		return errors.New("blob too short")
+	}
+	if err := s.epochs.Update(t.Height, t.SeedHash, t.NextSeedHash); err != nil {
+		return err
+	}
+
+	tmpl := &serverTemplate{
+		Template:  t,
+		submitted: make(map[uint32]struct{}),
+	}
+	tmpl.Blob = bytes.Clone(t.Blob)
+	tmpl.SeedHash = bytes.Clone(t.SeedHash)
+
+	s.lock.Lock()
+	s.template = tmpl
+	conns := make([]*serverConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.lock.Unlock()
+
+	for _, c := range conns {
+		c.sendJob(tmpl)
+	}
+	return nil
+}
+
+func (s *Server) currentTemplate() *serverTemplate {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.template
+}
+
+// Serve Accepts connections on l until it is closed or the Server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return randomx.ErrClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.listeners, l)
+		s.lock.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if closed {
+				return randomx.ErrClosed
+			}
+			return err
+		}
+
+		c, ok := s.add(conn)
+		if !ok {
+			_ = conn.Close()
+			continue
+		}
+		go c.serve()
+	}
+}
+
+// add Registers a connection and assigns it a nonce prefix. Returns false if none is available.
+func (s *Server) add(conn net.Conn) (*serverConn, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+	for i, used := range s.prefixes {
+		if !used {
+			s.prefixes[i] = true
+			c := &serverConn{
+				server:     s,
+				conn:       conn,
+				enc:        json.NewEncoder(conn),
+				prefix:     byte(i),
+				difficulty: s.opts.StartDifficulty,
+			}
+			s.conns[c] = struct{}{}
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) remove(c *serverConn) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.conns, c)
+	s.prefixes[c.prefix] = false
+}
+
+// Stats Returns connection and share counters
+func (s *Server) Stats() ServerStats {
+	s.lock.Lock()
+	connections := len(s.conns)
+	s.lock.Unlock()
+	return ServerStats{
+		Connections: connections,
+		Accepted:    s.accepted.Load(),
+		Rejected:    s.rejected.Load(),
+		Blocks:      s.blocks.Load(),
+	}
+}
+
+// Close Closes all listeners passed to Serve and all connections.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	for l := range s.listeners {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for c := range s.conns {
+		_ = c.conn.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// serverJob Job sent to a connection
+type serverJob struct {
+	id         string
+	template   *serverTemplate
+	target     uint64
+	difficulty uint64
+}
+
+// serverConn Connection to a miner
+type serverConn struct {
+	server *Server
+	conn   net.Conn
+	prefix byte
+
+	writeLock sync.Mutex
+	enc       *json.Encoder
+
+	lock    sync.Mutex
+	session string
+	login   string
+	jobs    []serverJob
+
+	// vardiff state
+	difficulty    uint64
+	shares        uint64
+	retargetStart time.Time
+}
+
+func (c *serverConn) write(msg Message) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.server.opts.Timeout))
+	return c.enc.Encode(msg)
+}
+
+func (c *serverConn) reply(id json.RawMessage, result any, rpcErr *Error) error {
+	msg := Message{ID: id, JSONRPC: "2.0", Error: rpcErr}
+	if rpcErr == nil {
+		r, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg.Result = r
+	}
+	return c.write(msg)
+}
+
+// newJob Builds a job for the connection from tmpl at the current difficulty
+func (c *serverConn) newJob(tmpl *serverTemplate) *Job {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	j := serverJob{
+		id:         strconv.FormatUint(c.server.jobID.Add(1), 10),
+		template:   tmpl,
+		target:     randomx.TargetFromDifficulty(c.difficulty),
+		difficulty: c.difficulty,
+	}
+	if len(c.jobs) == recentJobs {
+		c.jobs = c.jobs[1:]
+	}
+	c.jobs = append(c.jobs, j)
+
+	blob := bytes.Clone(tmpl.Blob)
+	binary.LittleEndian.PutUint32(blob[NonceOffset:], uint32(c.prefix)<<24)
+
+	return &Job{
+		Blob:     hex.EncodeToString(blob),
+		JobID:    j.id,
+		Target:   randomx.FormatTarget(j.target),
+		Algo:     "rx/0",
+		Height:   tmpl.Height,
+		SeedHash: hex.EncodeToString(tmpl.SeedHash),
+	}
+}
+
+// sendJob Sends a job notification to a logged in connection
+func (c *serverConn) sendJob(tmpl *serverTemplate) {
+	c.lock.Lock()
+	loggedIn := c.session != ""
+	c.lock.Unlock()
+	if !loggedIn {
+		return
+	}
+
+	params, err := json.Marshal(c.newJob(tmpl))
+	if err != nil {
+		return
+	}
+	if err := c.write(Message{JSONRPC: "2.0", Method: MethodJob, Params: params}); err != nil {
+		_ = c.conn.Close()
+	}
+}
+
+func (c *serverConn) serve() {
+	defer c.server.remove(c)
+	defer c.conn.Close()
+
+	dec := json.NewDecoder(c.conn)
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.server.opts.Timeout))
+		var msg Message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+
+		var err error
+		switch msg.Method {
+		case MethodLogin:
+			err = c.handleLogin(&msg)
+		case MethodSubmit:
+			err = c.handleSubmit(&msg)
+		case MethodKeepalived:
+			err = c.reply(msg.ID, StatusResult{Status: StatusKeepalived}, nil)
+			c.retarget(time.Now())
+		default:
+			err = c.reply(msg.ID, nil, &Error{Code: -1, Message: "Unknown method"})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *serverConn) handleLogin(msg *Message) error {
+	var params LoginParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return c.reply(msg.ID, nil, &Error{Code: -1, Message: "Invalid params"})
+	}
+
+	tmpl := c.server.currentTemplate()
+	if tmpl == nil {
+		return c.reply(msg.ID, nil, ErrNoTemplate)
+	}
+
+	var session [16]byte
+	binary.LittleEndian.PutUint64(session[:], c.server.jobID.Add(1))
+	session[15] = c.prefix
+
+	c.lock.Lock()
+	c.session = hex.EncodeToString(session[:])
+	c.login = params.Login
+	c.retargetStart = time.Now()
+	c.lock.Unlock()
+
+	return c.reply(msg.ID, LoginResult{
+		ID:         c.session,
+		Job:        c.newJob(tmpl),
+		Extensions: []string{ExtensionNiceHash, "keepalive"},
+		Status:     StatusOK,
+	}, nil)
+}
+
+func (c *serverConn) handleSubmit(msg *Message) error {
+	var params SubmitParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return c.reply(msg.ID, nil, &Error{Code: -1, Message: "Invalid params"})
+	}
+
+	block, rpcErr := c.verify(&params)
+	if rpcErr != nil {
+		c.server.rejected.Add(1)
+		return c.reply(msg.ID, nil, rpcErr)
+	}
+	c.server.accepted.Add(1)
+
+	if err := c.reply(msg.ID, StatusResult{Status: StatusOK}, nil); err != nil {
+		return err
+	}
+
+	if block != nil {
+		c.server.blocks.Add(1)
+		if c.server.opts.OnBlock != nil {
+			c.server.opts.OnBlock(*block)
+		}
+	}
+
+	c.lock.Lock()
+	c.shares++
+	c.lock.Unlock()
+	c.retarget(time.Now())
+	return nil
+}
+
+// verify Checks a submitted share. Returns a Block if it also meets the network difficulty.
+func (c *serverConn) verify(params *SubmitParams) (*Block, *Error) {
+	c.lock.Lock()
+	session, login := c.session, c.login
+	var job serverJob
+	for _, j := range c.jobs {
+		if j.id == params.JobID {
+			job = j
+		}
+	}
+	c.lock.Unlock()
+
+	if session == "" || params.ID != session {
+		return nil, ErrUnauthenticated
+	}
+	if job.template == nil {
+		return nil, ErrInvalidJobID
+	}
+
+	tmpl := job.template
+	if current := c.server.currentTemplate(); current.Height > tmpl.Height || !bytes.Equal(current.SeedHash, tmpl.SeedHash) {
+		return nil, ErrStaleShare
+	}
+
+	var nonceBuf [4]byte
+	if n, err := hex.Decode(nonceBuf[:], []byte(params.Nonce)); err != nil || n != len(nonceBuf) || len(params.Nonce) != 8 {
+		return nil, ErrInvalidNonce
+	}
+	nonce := binary.LittleEndian.Uint32(nonceBuf[:])
+	if byte(nonce>>24) != c.prefix {
+		return nil, ErrInvalidNonce
+	}
+
+	tmpl.lock.Lock()
+	_, duplicate := tmpl.submitted[nonce]
+	tmpl.lock.Unlock()
+	if duplicate {
+		return nil, ErrDuplicateShare
+	}
+
+	blob := bytes.Clone(tmpl.Blob)
+	binary.LittleEndian.PutUint32(blob[NonceOffset:], nonce)
+
+	vm, err := c.server.epochs.Get()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	// the EpochManager could have switched keys since the stale check
+	if !bytes.Equal(c.server.epochs.SeedHash(), tmpl.SeedHash) {
+		_ = c.server.epochs.Put(vm)
+		return nil, ErrStaleShare
+	}
+	var hash randomx.Hash
+	err = vm.CalculateHash(blob, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash))
+	_ = c.server.epochs.Put(vm)
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	// only recorded once hashed, so shares rejected before that can be resubmitted
+	tmpl.lock.Lock()
+	_, duplicate = tmpl.submitted[nonce]
+	tmpl.submitted[nonce] = struct{}{}
+	tmpl.lock.Unlock()
+	if duplicate {
+		return nil, ErrDuplicateShare
+	}
+
+	if params.Result != "" && params.Result != hash.String() {
+		return nil, ErrInvalidResult
+	}
+
+	// network difficulty can be below the share difficulty on small pools
+	if !hash.MeetsDifficulty(tmpl.Difficulty) {
+		if !hash.MeetsTarget(job.target) {
+			return nil, ErrLowDifficulty
+		}
+		return nil, nil
+	}
+	return &Block{
+		Height: tmpl.Height,
+		Blob:   blob,
+		Nonce:  nonce,
+		Hash:   hash,
+		Login:  login,
+	}, nil
+}
+
+// retarget Adjusts the connection difficulty so that shares arrive every TargetTime, at most once per RetargetInterval.
+// A new job is sent when the difficulty changes.
+func (c *serverConn) retarget(now time.Time) {
+	opts := &c.server.opts
+
+	c.lock.Lock()
+	elapsed := now.Sub(c.retargetStart)
+	if c.session == "" || elapsed < opts.RetargetInterval {
+		c.lock.Unlock()
+		return
+	}
+
+	// estimated hashrate times target time, halving when no shares were found
+	difficulty := c.difficulty / 2
+	if c.shares > 0 {
+		hashrate := float64(c.shares) * float64(c.difficulty) / elapsed.Seconds()
+		difficulty = uint64(hashrate * opts.TargetTime.Seconds())
+	}
+	difficulty = max(difficulty, opts.MinDifficulty)
+	if opts.MaxDifficulty != 0 {
+		difficulty = min(difficulty, opts.MaxDifficulty)
+	}
+
+	c.shares = 0
+	c.retargetStart = now
+
+	// ignore small changes to avoid resending jobs
+	ratio := float64(difficulty) / float64(c.difficulty)
+	changed := ratio < 0.9 || ratio > 1.1
+	if changed {
+		c.difficulty = difficulty
+	}
+	c.lock.Unlock()
+
+	if changed {
+		if tmpl := c.server.currentTemplate(); tmpl != nil {
+			c.sendJob(tmpl)
+		}
+	}
+}
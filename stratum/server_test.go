@@ -0,0 +1,357 @@
+package stratum
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"git.gammaspectra.live/P2Pool/go-randomx/v3"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/miner"
+)
+
+func newTestServer(t *testing.T, opts ServerOptions) (*Server, net.Listener) {
+	epochs, err := randomx.NewEpochManagerWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = epochs.Close()
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(epochs, opts)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return server, listener
+}
+
+func testTemplate(height uint64, seed string, difficulty uint64) Template {
+	return Template{
+		Blob:       bytes.Repeat([]byte{byte(height)}, 76),
+		Height:     height,
+		SeedHash:   []byte(seed),
+		Difficulty: randomx.NewDifficulty(difficulty),
+	}
+}
+
+// rawClient Minimal stratum client sending requests by hand
+type rawClient struct {
+	t    *testing.T
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+	id   uint64
+
+	session string
+	// jobs received, most recent last
+	jobs []Job
+}
+
+func dialRaw(t *testing.T, address string) *rawClient {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return &rawClient{t: t, conn: conn, enc: json.NewEncoder(conn), dec: json.NewDecoder(conn)}
+}
+
+// call Sends a request and returns its response, recording job notifications received meanwhile
+func (c *rawClient) call(method string, params any) *Message {
+	c.t.Helper()
+
+	c.id++
+	p, _ := json.Marshal(params)
+	if err := c.enc.Encode(Message{ID: json.RawMessage(strconv.FormatUint(c.id, 10)), Method: method, Params: p}); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.receive()
+		if msg.Method == "" {
+			return msg
+		}
+	}
+}
+
+func (c *rawClient) receive() *Message {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Minute))
+	var msg Message
+	if err := c.dec.Decode(&msg); err != nil {
+		c.t.Fatal(err)
+	}
+	if msg.Method == MethodJob {
+		var job Job
+		if err := json.Unmarshal(msg.Params, &job); err != nil {
+			c.t.Fatal(err)
+		}
+		c.jobs = append(c.jobs, job)
+	}
+	return &msg
+}
+
+func (c *rawClient) login() {
+	c.t.Helper()
+
+	msg := c.call(MethodLogin, LoginParams{Login: "wallet", Pass: "x"})
+	if msg.Error != nil {
+		c.t.Fatal(msg.Error)
+	}
+	var result LoginResult
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		c.t.Fatal(err)
+	}
+	c.session = result.ID
+	c.jobs = append(c.jobs, *result.Job)
+}
+
+// share Calculates the result for a nonce of a job
+func (c *rawClient) share(job Job, nonce uint32) SubmitParams {
+	c.t.Helper()
+
+	blob, _, seedHash, err := job.Decode()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(blob[NonceOffset:], nonce)
+
+	cache, err := randomx.NewCacheWithConfig(randomx.GetFlags(), testConfig)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer cache.Close()
+	if err := cache.Init(seedHash); err != nil {
+		c.t.Fatal(err)
+	}
+	vm, err := randomx.NewVM(randomx.GetFlags(), cache, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer vm.Close()
+
+	var hash randomx.Hash
+	if err := vm.CalculateHash(blob, (*[randomx.RANDOMX_HASH_SIZE]byte)(&hash)); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var nonceBuf [4]byte
+	binary.LittleEndian.PutUint32(nonceBuf[:], nonce)
+	return SubmitParams{ID: c.session, JobID: job.JobID, Nonce: hex.EncodeToString(nonceBuf[:]), Result: hash.String()}
+}
+
+func (c *rawClient) expect(params SubmitParams, expected *Error) {
+	c.t.Helper()
+
+	msg := c.call(MethodSubmit, params)
+	if expected == nil {
+		if msg.Error != nil {
+			c.t.Fatalf("expected share to be accepted, got %s", msg.Error)
+		}
+		return
+	}
+	if msg.Error == nil || msg.Error.Message != expected.Message {
+		c.t.Fatalf("expected %s, got %v", expected, msg.Error)
+	}
+}
+
+func Test_Server_Shares(t *testing.T) {
+	t.Parallel()
+
+	blocks := make(chan Block, 16)
+	server, listener := newTestServer(t, ServerOptions{
+		StartDifficulty: 1,
+		MinDifficulty:   1,
+		OnBlock: func(b Block) {
+			blocks <- b
+		},
+	})
+
+	c := dialRaw(t, listener.Addr().String())
+	if msg := c.call(MethodLogin, LoginParams{Login: "wallet"}); msg.Error == nil || msg.Error.Message != ErrNoTemplate.Message {
+		t.Fatalf("expected %s, got %v", ErrNoTemplate, msg.Error)
+	}
+
+	// network difficulty 1, so every share is a block
+	if err := server.SetTemplate(testTemplate(100, "test key 000", 1)); err != nil {
+		t.Fatal(err)
+	}
+	c.login()
+	job := c.jobs[0]
+	blob, _, _, err := job.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := uint32(blob[NonceOffset+3]) << 24
+
+	share := c.share(job, prefix|1)
+	c.expect(share, nil)
+	select {
+	case b := <-blocks:
+		if b.Height != 100 || b.Nonce != prefix|1 || b.Hash.String() != share.Result || b.Login != "wallet" {
+			t.Errorf("unexpected block %+v", b)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("no block event")
+	}
+
+	c.expect(share, ErrDuplicateShare)
+
+	invalid := c.share(job, prefix|2)
+	invalid.JobID = "unknown"
+	c.expect(invalid, ErrInvalidJobID)
+
+	invalid = c.share(job, prefix|2)
+	invalid.ID = "other session"
+	c.expect(invalid, ErrUnauthenticated)
+
+	invalid = c.share(job, (prefix+1<<24)|2)
+	c.expect(invalid, ErrInvalidNonce)
+
+	invalid = c.share(job, prefix|3)
+	invalid.Result = share.Result
+	c.expect(invalid, ErrInvalidResult)
+
+	// raise the connection difficulty so that shares are too weak
+	server.lock.Lock()
+	for conn := range server.conns {
+		conn.lock.Lock()
+		conn.difficulty = 1 << 62
+		conn.lock.Unlock()
+	}
+	server.lock.Unlock()
+
+	// new height, with a new seed
+	if err := server.SetTemplate(testTemplate(101, "test key 001", 1)); err != nil {
+		t.Fatal(err)
+	}
+	for len(c.jobs) < 2 {
+		c.receive()
+	}
+	c.expect(c.share(job, prefix|4), ErrStaleShare)
+
+	// network difficulty is still 1, so the share is a block even though it misses the job target
+	c.expect(c.share(c.jobs[1], prefix|5), nil)
+	select {
+	case b := <-blocks:
+		if b.Height != 101 || b.Nonce != prefix|5 {
+			t.Errorf("unexpected block %+v", b)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("no block event")
+	}
+
+	if err := server.SetTemplate(testTemplate(102, "test key 001", 1<<62)); err != nil {
+		t.Fatal(err)
+	}
+	for len(c.jobs) < 3 {
+		c.receive()
+	}
+	c.expect(c.share(c.jobs[2], prefix|6), ErrLowDifficulty)
+
+	stats := server.Stats()
+	if stats.Accepted != 2 || stats.Rejected != 7 || stats.Blocks != 2 || stats.Connections != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func Test_Server_Client(t *testing.T) {
+	t.Parallel()
+
+	blocks := make(chan Block, 64)
+	server, listener := newTestServer(t, ServerOptions{
+		StartDifficulty:  2,
+		MinDifficulty:    1,
+		TargetTime:       time.Second,
+		RetargetInterval: 200 * time.Millisecond,
+		OnBlock: func(b Block) {
+			select {
+			case blocks <- b:
+			default:
+			}
+		},
+	})
+	if err := server.SetTemplate(testTemplate(100, "test key 000", 8)); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := miner.NewWithConfig(randomx.GetFlags(), testConfig, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	client := NewClient(m, Options{
+		Address:    listener.Addr().String(),
+		Login:      "wallet",
+		MinBackoff: 10 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.Run(ctx)
+
+	select {
+	case b := <-blocks:
+		if b.Height != 100 {
+			t.Errorf("unexpected block %+v", b)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("no block found")
+	}
+
+	// vardiff raises difficulty as shares arrive much faster than TargetTime
+	deadline := time.Now().Add(time.Minute)
+	for {
+		var difficulty uint64
+		server.lock.Lock()
+		for conn := range server.conns {
+			conn.lock.Lock()
+			difficulty = conn.difficulty
+			conn.lock.Unlock()
+		}
+		server.lock.Unlock()
+		if difficulty > 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("difficulty did not increase")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// new height with a new seed
+	if err := server.SetTemplate(testTemplate(101, "test key 001", 8)); err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(time.Minute)
+	for {
+		select {
+		case b := <-blocks:
+			if b.Height == 101 {
+				if stats := client.Stats(); stats.Accepted == 0 {
+					t.Errorf("unexpected client stats %+v", stats)
+				}
+				if stats := server.Stats(); stats.Accepted == 0 || stats.Blocks < 2 {
+					t.Errorf("unexpected server stats %+v", stats)
+				}
+				return
+			}
+		case <-time.After(time.Until(deadline)):
+			t.Fatal("no block found at new height")
+		}
+	}
+}
@@ -295,7 +295,6 @@ func FetchNextDecoder(ins *Instruction, cycle int, mulcount int, gen *blake2.Gen
 	}
 
 	panic("can never reach")
-	return Decoder484
 }
 
 type SuperScalarProgram []SuperScalarInstruction
@@ -311,7 +310,14 @@ func (p SuperScalarProgram) Program() []SuperScalarInstruction {
 	return p[1:]
 }
 
+// BuildSuperScalarProgram Generates a superscalar program with the default target latency
 func BuildSuperScalarProgram(gen *blake2.Generator) SuperScalarProgram {
+	return buildSuperScalarProgram(gen, RANDOMX_SUPERSCALAR_LATENCY)
+}
+
+// buildSuperScalarProgram Generates a superscalar program with the given target latency, see Config.SuperscalarLatency
+func buildSuperScalarProgram(gen *blake2.Generator, latency int) SuperScalarProgram {
+	maxSize := 3*latency + 2
 	cycle := 0
 	depcycle := 0
 	//retire_cycle := 0
@@ -330,14 +336,14 @@ func BuildSuperScalarProgram(gen *blake2.Generator) SuperScalarProgram {
 	sins := &SuperScalarInstruction{}
 	sins.ins = &Instruction{Opcode: S_NOP}
 
-	portbusy := make([][]int, CYCLE_MAP_SIZE)
+	portbusy := make([][]int, latency+CYCLE_MAP_EXTRA)
 	for i := range portbusy {
 		portbusy[i] = make([]int, 3)
 	}
 
 	done := 0
 
-	for decode_cycle := 0; decode_cycle < RANDOMX_SUPERSCALAR_LATENCY && !ports_saturated && program_size < SuperscalarMaxSize; decode_cycle++ {
+	for decode_cycle := 0; decode_cycle < latency && !ports_saturated && program_size < maxSize; decode_cycle++ {
 
 		decoder := FetchNextDecoder(sins.ins, decode_cycle, mulcount, gen)
 
@@ -351,7 +357,7 @@ func BuildSuperScalarProgram(gen *blake2.Generator) SuperScalarProgram {
 			top_cycle := cycle
 
 			if macro_op_index >= sins.ins.GetUOPCount() {
-				if ports_saturated || program_size >= SuperscalarMaxSize {
+				if ports_saturated || program_size >= maxSize {
 					break
 				}
 				CreateSuperScalarInstruction(sins, gen, decoderToInstructionSize[decoder][buffer_index], decoder, len(decoderToInstructionSize[decoder]) == (buffer_index+1), buffer_index == 0)
@@ -427,7 +433,7 @@ func BuildSuperScalarProgram(gen *blake2.Generator) SuperScalarProgram {
 			macro_op_count++
 
 			// terminating condition for 99% case
-			if scheduleCycle >= RANDOMX_SUPERSCALAR_LATENCY {
+			if scheduleCycle >= latency {
 				ports_saturated = true
 			}
 			cycle = top_cycle
@@ -479,13 +485,14 @@ func BuildSuperScalarProgram(gen *blake2.Generator) SuperScalarProgram {
 	return program
 }
 
-const CYCLE_MAP_SIZE int = RANDOMX_SUPERSCALAR_LATENCY + 4
+const CYCLE_MAP_SIZE int = RANDOMX_SUPERSCALAR_LATENCY + CYCLE_MAP_EXTRA
+const CYCLE_MAP_EXTRA int = 4
 const LOOK_FORWARD_CYCLES int = 4
 const MAX_THROWAWAY_COUNT int = 256
 
 // ScheduleUop schedule the uop as early as possible
 func ScheduleUop(uop ExecutionPort, portbusy [][]int, cycle int, commit bool) int {
-	for ; cycle < CYCLE_MAP_SIZE; cycle++ { // since cycle is value based, its restored on return
+	for ; cycle < len(portbusy); cycle++ { // since cycle is value based, its restored on return
 		if (uop&P5) != 0 && portbusy[cycle][2] == 0 {
 			if commit {
 				portbusy[cycle][2] = int(uop)
@@ -520,7 +527,7 @@ func ScheduleMop(mop *MacroOP, portbusy [][]int, cycle int, depcycle int, commit
 	} else if mop.IsSimple() {
 		return ScheduleUop(mop.GetUOP1(), portbusy, cycle, commit)
 	} else {
-		for ; cycle < CYCLE_MAP_SIZE; cycle++ { // since cycle is value based, its restored on return
+		for ; cycle < len(portbusy); cycle++ { // since cycle is value based, its restored on return
 			cycle1 := ScheduleUop(mop.GetUOP1(), portbusy, cycle, false)
 			cycle2 := ScheduleUop(mop.GetUOP2(), portbusy, cycle, false)
 
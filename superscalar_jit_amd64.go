@@ -4,26 +4,113 @@ package randomx
 
 import (
 	"encoding/binary"
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/keys"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
 	"unsafe"
 )
 
 //go:noescape
-func superscalar_run(rf, jmp uintptr)
+func superscalar_dataset_init(cache *MemoryBlock, dataset *RegisterLine, startItem, endItem uint64, jmp uintptr)
 
-func (f SuperScalarProgramFunc) Execute(rf uintptr) {
+// initDataset Generates the dataset items from startItem onwards into dataset, reading cache memory.
+// No bounds are checked, cache must hold all blocks of the Cache it was compiled for.
+func (f SuperScalarProgramFunc) initDataset(cache []MemoryBlock, dataset []RegisterLine, startItem uint64) {
 	if f == nil {
 		panic("program is nil")
 	}
+	if len(dataset) == 0 {
+		return
+	}
+
+	superscalar_dataset_init(unsafe.SliceData(cache), unsafe.SliceData(dataset), startItem, startItem+uint64(len(dataset)), uintptr(unsafe.Pointer(unsafe.SliceData(f))))
+}
 
-	superscalar_run(rf, uintptr(unsafe.Pointer(unsafe.SliceData(f))))
+// superscalarHash Address of the item generator, taking the item number in rbx and returning the item in r8-r15.
+// rax and rdx are clobbered, rdi must point to cache memory.
+func (f SuperScalarProgramFunc) superscalarHash() uintptr {
+	return uintptr(unsafe.Pointer(unsafe.SliceData(f))) + uintptr(datasetInitHashOffset)
 }
 
-// generateSuperscalarCode
-func generateSuperscalarCode(scalarProgram SuperScalarProgram) SuperScalarProgramFunc {
+/*
+	REGISTER ALLOCATION:
 
-	var program []byte
+	; rax -> temporary
+	; rbx -> item number, then cache line address
+	; rcx -> item number of the loop
+	; rdx -> temporary, end item number is kept on the stack
+	; rsi -> dataset pointer
+	; rdi -> cache memory pointer
+	; r8-r15 -> superscalar registers
+
+	The loop at offset 0 initializes items [rcx, rdx) into rsi, calling the item
+	generator at datasetInitHashOffset for each of them.
+	The item generator takes the item number in rbx and returns the item in r8-r15.
+*/
+
+/*
+push rdx
+init_item:
+prefetchw byte ptr [rsi]
+mov rbx, rcx
+call superscalar_hash
+mov qword ptr [rsi+0], r8
+mov qword ptr [rsi+8], r9
+mov qword ptr [rsi+16], r10
+mov qword ptr [rsi+24], r11
+mov qword ptr [rsi+32], r12
+mov qword ptr [rsi+40], r13
+mov qword ptr [rsi+48], r14
+mov qword ptr [rsi+56], r15
+add rcx, 1
+add rsi, 64
+cmp rcx, qword ptr [rsp]
+jb init_item
+pop rdx
+ret
+*/
+var datasetInitLoopBegin = []byte{0x52, 0x0F, 0x0D, 0x0E, 0x48, 0x89, 0xCB, 0xE8}
+
+var datasetInitLoopEnd = []byte{0x4C, 0x89, 0x06, 0x4C, 0x89, 0x4E, 0x08, 0x4C, 0x89, 0x56, 0x10, 0x4C, 0x89, 0x5E, 0x18, 0x4C, 0x89, 0x66, 0x20, 0x4C, 0x89, 0x6E, 0x28, 0x4C, 0x89, 0x76, 0x30, 0x4C, 0x89, 0x7E, 0x38, 0x48, 0x83, 0xC1, 0x01, 0x48, 0x83, 0xC6, 0x40, 0x48, 0x3B, 0x0C, 0x24, 0x72}
 
+var datasetInitLoopExit = []byte{0x5A, 0xC3}
+
+// datasetInitHashOffset Offset of the item generator within the code generated by generateDatasetInitCode
+var datasetInitHashOffset = len(datasetInitLoopBegin) + 4 + len(datasetInitLoopEnd) + 1 + len(datasetInitLoopExit)
+
+/*
+lea r8, [rbx+1]
+mov rax, SuperScalar_Constants[0]
+imul r8, rax
+*/
+var superscalarHashInitBegin = []byte{0x4C, 0x8D, 0x43, 0x01}
+
+/*
+shl rbx, 6
+add rbx, rdi
+prefetchnta byte ptr [rbx]
+*/
+var superscalarHashCacheLine = []byte{0x48, 0xC1, 0xE3, 0x06, 0x48, 0x01, 0xFB, 0x0F, 0x18, 0x03}
+
+/*
+xor r8, qword ptr [rbx+0]
+xor r9, qword ptr [rbx+8]
+xor r10, qword ptr [rbx+16]
+xor r11, qword ptr [rbx+24]
+xor r12, qword ptr [rbx+32]
+xor r13, qword ptr [rbx+40]
+xor r14, qword ptr [rbx+48]
+xor r15, qword ptr [rbx+56]
+*/
+var superscalarHashXorCacheLine = []byte{0x4C, 0x33, 0x03, 0x4C, 0x33, 0x4B, 0x08, 0x4C, 0x33, 0x53, 0x10, 0x4C, 0x33, 0x5B, 0x18, 0x4C, 0x33, 0x63, 0x20, 0x4C, 0x33, 0x6B, 0x28, 0x4C, 0x33, 0x73, 0x30, 0x4C, 0x33, 0x7B, 0x38}
+
+var REX_AND_RBX_I = []byte{0x48, 0x81, 0xe3}
+var REX_AND_RBX_RAX = []byte{0x48, 0x21, 0xc3}
+var REX_MOV_RBX_R = []byte{0x4c, 0x89}
+var REX_MOV_R_R8 = []byte{0x4d, 0x89}
+var REX_XOR_R_RAX = []byte{0x49, 0x31}
+
+// appendSuperscalarProgram appends the machine code of a single superscalar program
+func appendSuperscalarProgram(program []byte, scalarProgram SuperScalarProgram) []byte {
 	p := scalarProgram.Program()
 	for i := range p {
 		instr := &p[i]
@@ -88,6 +175,57 @@ func generateSuperscalarCode(scalarProgram SuperScalarProgram) SuperScalarProgra
 			panic("unreachable")
 		}
 	}
+	return program
+}
+
+// generateDatasetInitCode Generates a single routine computing dataset items, like the reference generateDatasetInitCode.
+// It covers the register seeding, all programs with their cache line mixing and a loop over an item range.
+func generateDatasetInitCode(scalarPrograms []SuperScalarProgram, cacheMask uint64) SuperScalarProgramFunc {
+	var program []byte
+
+	// item range loop, calls the item generator placed right after it
+	program = append(program, datasetInitLoopBegin...)
+	program = binary.LittleEndian.AppendUint32(program, uint32(datasetInitHashOffset-(len(program)+4)))
+	program = append(program, datasetInitLoopEnd...)
+	program = append(program, byte(1-(len(program)+1)))
+	program = append(program, datasetInitLoopExit...)
+
+	// item generator
+	program = append(program, superscalarHashInitBegin...)
+	program = append(program, MOV_RAX_I...)
+	program = binary.LittleEndian.AppendUint64(program, keys.SuperScalar_Constants[0])
+	program = append(program, REX_IMUL_RM...)
+	program = append(program, 0xc0)
+	for i := byte(1); i < RegistersCount; i++ {
+		program = append(program, REX_MOV_R_R8...)
+		program = append(program, 0xc0+i)
+		program = append(program, MOV_RAX_I...)
+		program = binary.LittleEndian.AppendUint64(program, keys.SuperScalar_Constants[i])
+		program = append(program, REX_XOR_R_RAX...)
+		program = append(program, 0xc0+i)
+	}
+
+	for i, p := range scalarPrograms {
+		if cacheMask <= 0x7fffffff {
+			program = append(program, REX_AND_RBX_I...)
+			program = binary.LittleEndian.AppendUint32(program, uint32(cacheMask))
+		} else {
+			program = append(program, MOV_RAX_I...)
+			program = binary.LittleEndian.AppendUint64(program, cacheMask)
+			program = append(program, REX_AND_RBX_RAX...)
+		}
+		program = append(program, superscalarHashCacheLine...)
+
+		program = appendSuperscalarProgram(program, p)
+
+		program = append(program, superscalarHashXorCacheLine...)
+
+		if i < len(scalarPrograms)-1 {
+			// address register for the next cache line
+			program = append(program, REX_MOV_RBX_R...)
+			program = append(program, 0xc3+8*p.AddressRegister())
+		}
+	}
 
 	program = append(program, RET)
 
@@ -2,11 +2,11 @@
 
 package randomx
 
-func (f SuperScalarProgramFunc) Execute(rf uintptr) {
+func (f SuperScalarProgramFunc) initDataset(cache []MemoryBlock, dataset []RegisterLine, startItem uint64) {
 
 }
 
-// generateSuperscalarCode
-func generateSuperscalarCode(scalarProgram SuperScalarProgram) SuperScalarProgramFunc {
+// generateDatasetInitCode
+func generateDatasetInitCode(scalarPrograms []SuperScalarProgram, cacheMask uint64) SuperScalarProgramFunc {
 	return nil
 }
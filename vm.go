@@ -31,21 +31,23 @@ package randomx
 
 import (
 	"errors"
+	"fmt"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/aes"
 	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/memory"
-	"math"
 	"runtime"
 	"unsafe"
 )
 import "golang.org/x/crypto/blake2b"
 
 type VM struct {
-	pad *ScratchPad
+	pad scratchPad
 
 	flags Flags
 
+	config *params
+
 	// buffer first 128 bytes are entropy below rest are program bytes
-	buffer [16*8 + RANDOMX_PROGRAM_SIZE*8]byte
+	buffer []byte
 
 	hashState [blake2b.Size]byte
 
@@ -56,8 +58,21 @@ type VM struct {
 	Cache   *Cache
 	Dataset *Dataset
 
-	program    ByteCode
+	// cacheGeneration Cache generation at the time it was set on the VM
+	cacheGeneration uint64
+
+	closed bool
+
+	// commitmentInput copy of the input of the pending hash, see CalculateCommitmentFirst
+	// commitmentPending is cleared by any plain CalculateHash* call, as those replace the pending hash
+	commitmentInput   []byte
+	commitmentPending bool
+
+	program    byteCode
 	jitProgram VMProgramFunc
+
+	// itemWorker Helper for RANDOMX_FLAG_LIGHT_CONCURRENT, started on first use and stopped by Close
+	itemWorker datasetItemWorker
 }
 
 // NewVM  Creates and initializes a RandomX virtual machine.
@@ -69,6 +84,9 @@ type VM struct {
 // *        RANDOMX_FLAG_JIT - virtual machine will use a JIT compiler
 // *        RANDOMX_FLAG_SECURE - when combined with RANDOMX_FLAG_JIT, the JIT pages are never
 // *                              writable and executable at the same time (W^X policy)
+// *        RANDOMX_FLAG_LIGHT_CONCURRENT - in light mode, Dataset items are computed on a helper goroutine
+// *                                        while the program runs (not part of the reference flags).
+// *                                        Ignored when the JIT Cache lets the VM run the whole loop compiled
 // *        The numeric values of the first 4 flags are ordered so that a higher value will provide
 // *        faster hash calculation and a lower numeric value will provide higher portability.
 // *        Using RANDOMX_FLAG_DEFAULT (all flags not set) works on all platforms, but is the slowest.
@@ -83,6 +101,8 @@ type VM struct {
 // *         (2) The requested initialization flags are not supported on the current platform.
 // *         (3) cache parameter is NULL and RANDOMX_FLAG_FULL_MEM is not set
 // *         (4) dataset parameter is NULL and RANDOMX_FLAG_FULL_MEM is set
+// *
+// * The RandomX parameters are taken from the cache or dataset, which must have been created with the same Config.
 // */
 func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 	if cache == nil && !flags.Has(RANDOMX_FLAG_FULL_MEM) {
@@ -92,7 +112,22 @@ func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 		return nil, errors.New("nil dataset in full mode")
 	}
 
-	pad, err := memory.Allocate[ScratchPad](cacheLineAlignedAllocator)
+	var config *params
+	if cache != nil {
+		config = cache.config
+	}
+	if dataset != nil {
+		if config != nil && config.Config != dataset.config.Config {
+			return nil, ErrConfigMismatch
+		}
+		config = dataset.config
+	}
+
+	if (cache != nil && cache.closed.Load()) || (dataset != nil && dataset.closed.Load()) {
+		return nil, ErrClosed
+	}
+
+	pad, err := memory.AllocateSlice[byte](cacheLineAlignedAllocator, config.ScratchpadL3)
 	if err != nil {
 		return nil, err
 	}
@@ -100,15 +135,20 @@ func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 	if err != nil {
 		return nil, err
 	}
-	_ = pad
-	_ = registerFile
 
 	vm := &VM{
 		Cache:        cache,
 		Dataset:      dataset,
 		flags:        flags,
-		pad:          new(ScratchPad),
-		registerFile: new(RegisterFile),
+		config:       config,
+		pad:          pad,
+		buffer:       make([]byte, 16*8+config.ProgramSize*8),
+		registerFile: registerFile,
+		program:      make(byteCode, config.ProgramSize),
+	}
+
+	if cache != nil {
+		vm.cacheGeneration = cache.Generation()
 	}
 
 	if flags.Has(RANDOMX_FLAG_HARD_AES) {
@@ -120,7 +160,7 @@ func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 	}
 
 	if flags.HasJIT() {
-		vm.jitProgram, err = memory.AllocateSlice[byte](pageAllocator, int(RandomXCodeSize))
+		vm.jitProgram, err = memory.AllocateSlice[byte](pageAllocator, int(randomXCodeSize(config.ProgramSize)))
 		if err != nil {
 			return nil, err
 		}
@@ -129,7 +169,7 @@ func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 			err = memory.PageReadWriteExecute(vm.jitProgram)
 			if err != nil {
 				vm.jitProgram.Close()
-				return nil, err
+				return nil, fmt.Errorf("%w: %w", ErrJITUnavailable, err)
 			}
 		}
 	}
@@ -141,12 +181,16 @@ func NewVM(flags Flags, cache *Cache, dataset *Dataset) (*VM, error) {
 // Warning: Underlying callers will run float64 SetRoundingMode directly
 // It is the caller's responsibility to set and restore the mode to IEEE 754 roundTiesToEven between full executions
 // Additionally, runtime.LockOSThread and defer runtime.UnlockOSThread is recommended to prevent other goroutines sharing these changes
-func (vm *VM) run() {
+func (vm *VM) run() error {
+
+	config := vm.config
 
 	// buffer first 128 bytes are entropy below rest are program bytes
-	vm.AES.FillAes4Rx4(vm.hashState, vm.buffer[:])
+	if err := vm.AES.FillAes4Rx4(vm.hashState, &config.fillAes4Rx4Keys, vm.buffer); err != nil {
+		return err
+	}
 
-	entropy := (*[16]uint64)(unsafe.Pointer(&vm.buffer))
+	entropy := (*[16]uint64)(unsafe.Pointer(unsafe.SliceData(vm.buffer)))
 
 	// do more initialization before we run
 
@@ -161,7 +205,7 @@ func (vm *VM) run() {
 	// memory registers
 	var ma, mx uint32
 
-	ma = uint32(entropy[8] & CacheLineAlignMask)
+	ma = uint32(entropy[8] & config.cacheLineAlignMask)
 	mx = uint32(entropy[10])
 
 	addressRegisters := entropy[12]
@@ -172,48 +216,57 @@ func (vm *VM) run() {
 		addressRegisters >>= 1
 	}
 
-	datasetOffset := (entropy[13] % (DatasetExtraItems + 1)) * CacheLineSize
+	datasetOffset := (entropy[13] % (config.datasetExtraItems + 1)) * CacheLineSize
 
 	eMask := [2]uint64{ExponentMask(entropy[14]), ExponentMask(entropy[15])}
 
 	prog := vm.buffer[len(entropy)*8:]
-	CompileProgramToByteCode(prog, &vm.program)
+	compileProgramToByteCode(config, prog, vm.program)
 
 	var jitProgram VMProgramFunc
 
 	if vm.jitProgram != nil {
-		if vm.Dataset == nil { //light mode
+		if vm.Dataset == nil && !vm.Cache.hasInitializedJIT() { //light mode without the full loop
 			if vm.flags.Has(RANDOMX_FLAG_SECURE) {
 				err := memory.PageReadWrite(vm.jitProgram)
 				if err != nil {
-					panic(err)
+					return fmt.Errorf("%w: %w", ErrJITUnavailable, err)
 				}
-				jitProgram = vm.program.generateCode(vm.jitProgram, nil)
+				jitProgram = vm.program.generateCode(vm.jitProgram, nil, config, nil, 0)
 				err = memory.PageReadExecute(vm.jitProgram)
 				if err != nil {
-					panic(err)
+					return fmt.Errorf("%w: %w", ErrJITUnavailable, err)
 				}
 			} else {
-				jitProgram = vm.program.generateCode(vm.jitProgram, nil)
+				jitProgram = vm.program.generateCode(vm.jitProgram, nil, config, nil, 0)
 			}
 		} else {
-			// full mode and we have JIT
+			// full mode, or light mode generating items with the compiled superscalar code
+			var datasetInit SuperScalarProgramFunc
+			if vm.Dataset == nil {
+				datasetInit = vm.Cache.jitDatasetInit
+			}
+
 			if vm.flags.Has(RANDOMX_FLAG_SECURE) {
 				err := memory.PageReadWrite(vm.jitProgram)
 				if err != nil {
-					panic(err)
+					return fmt.Errorf("%w: %w", ErrJITUnavailable, err)
 				}
-				jitProgram = vm.program.generateCode(vm.jitProgram, &readReg)
+				jitProgram = vm.program.generateCode(vm.jitProgram, &readReg, config, datasetInit, datasetOffset)
 				err = memory.PageReadExecute(vm.jitProgram)
 				if err != nil {
-					panic(err)
+					return fmt.Errorf("%w: %w", ErrJITUnavailable, err)
 				}
 			} else {
-				jitProgram = vm.program.generateCode(vm.jitProgram, &readReg)
+				jitProgram = vm.program.generateCode(vm.jitProgram, &readReg, config, datasetInit, datasetOffset)
 			}
 
-			vm.jitProgram.ExecuteFull(reg, vm.pad, &vm.Dataset.Memory()[datasetOffset/CacheLineSize], RANDOMX_PROGRAM_ITERATIONS, ma, mx, eMask)
-			return
+			if datasetInit != nil {
+				vm.jitProgram.executeLight(reg, vm.pad, vm.Cache.blocks, uint64(config.ProgramIterations), ma, mx, eMask)
+			} else {
+				vm.jitProgram.executeFull(reg, vm.pad, &vm.Dataset.Memory()[datasetOffset/CacheLineSize], uint64(config.ProgramIterations), ma, mx, eMask)
+			}
+			return nil
 		}
 	}
 
@@ -222,26 +275,28 @@ func (vm *VM) run() {
 
 	var rlCache RegisterLine
 
-	for ic := 0; ic < RANDOMX_PROGRAM_ITERATIONS; ic++ {
+	var itemWorker *datasetItemWorker
+	if vm.Dataset == nil && vm.flags.Has(RANDOMX_FLAG_LIGHT_CONCURRENT) {
+		// the item of each iteration is computed while its program runs.
+		// Not used by the full loop JIT, where the channel round trip costs more than the item
+		itemWorker = &vm.itemWorker
+		itemWorker.requestItem(vm.Cache, (datasetOffset+uint64(ma))/CacheLineSize)
+	}
+
+	for ic := uint32(0); ic < config.ProgramIterations; ic++ {
 		spMix := reg.R[readReg[0]] ^ reg.R[readReg[1]]
 
 		spAddr0 ^= spMix
-		spAddr0 &= ScratchpadL3Mask64
+		spAddr0 &= uint64(config.scratchpadL3Mask64)
 		spAddr1 ^= spMix >> 32
-		spAddr1 &= ScratchpadL3Mask64
+		spAddr1 &= uint64(config.scratchpadL3Mask64)
 
-		//TODO: optimize these loads!
-		for i := uint64(0); i < RegistersCount; i++ {
-			reg.R[i] ^= vm.pad.Load64(uint32(spAddr0 + 8*i))
-		}
+		vm.pad.XorLine(uint32(spAddr0), &reg.R)
 
-		for i := uint64(0); i < RegistersCountFloat; i++ {
-			reg.F[i] = vm.pad.Load32FA(uint32(spAddr1 + 8*i))
-		}
+		// F and E are contiguous, loaded from a single line
+		vm.pad.Load32FLine(uint32(spAddr1), (*[RegistersCountFloat * 2][2]float64)(unsafe.Pointer(&reg.F)))
 
 		for i := uint64(0); i < RegistersCountFloat; i++ {
-			reg.E[i] = vm.pad.Load32FA(uint32(spAddr1 + 8*(i+RegistersCountFloat)))
-
 			reg.E[i][LOW] = MaskRegisterExponentMantissa(reg.E[i][LOW], eMask[LOW])
 			reg.E[i][HIGH] = MaskRegisterExponentMantissa(reg.E[i][HIGH], eMask[HIGH])
 		}
@@ -249,19 +304,25 @@ func (vm *VM) run() {
 		// run the actual bytecode
 		if jitProgram != nil {
 			// light mode
-			jitProgram.Execute(reg, vm.pad, eMask)
+			jitProgram.execute(reg, vm.pad, eMask)
 		} else {
-			vm.program.Execute(reg, vm.pad, eMask)
+			vm.program.execute(reg, vm.pad, eMask)
 		}
 
 		mx ^= uint32(reg.R[readReg[2]] ^ reg.R[readReg[3]])
-		mx &= uint32(CacheLineAlignMask)
+		mx &= uint32(config.cacheLineAlignMask)
 
 		if vm.Dataset != nil {
 			// full mode
 			vm.Dataset.prefetchDataset(datasetOffset + uint64(mx))
 			// load output from superscalar program to get dataset 64 bytes
 			vm.Dataset.readDataset(datasetOffset+uint64(ma), &reg.R)
+		} else if itemWorker != nil {
+			// light mode, item requested on the previous iteration
+			item := itemWorker.wait()
+			for i := range reg.R {
+				reg.R[i] ^= item[i]
+			}
 		} else {
 			// light mode
 			// execute output from superscalar program to get dataset 64 bytes
@@ -274,30 +335,54 @@ func (vm *VM) run() {
 		// swap the elements
 		mx, ma = ma, mx
 
-		for i := uint64(0); i < RegistersCount; i++ {
-			vm.pad.Store64(uint32(spAddr1+8*i), reg.R[i])
+		if itemWorker != nil && ic+1 < config.ProgramIterations {
+			itemWorker.requestItem(vm.Cache, (datasetOffset+uint64(ma))/CacheLineSize)
 		}
 
+		vm.pad.StoreLine(uint32(spAddr1), &reg.R)
+
 		for i := uint64(0); i < RegistersCountFloat; i++ {
 			reg.F[i][LOW] = Xor(reg.F[i][LOW], reg.E[i][LOW])
 			reg.F[i][HIGH] = Xor(reg.F[i][HIGH], reg.E[i][HIGH])
-
-			vm.pad.Store64(uint32(spAddr0+16*i), math.Float64bits(reg.F[i][LOW]))
-			vm.pad.Store64(uint32(spAddr0+16*i+8), math.Float64bits(reg.F[i][HIGH]))
 		}
 
+		// F as stored by Float64bits
+		vm.pad.StoreLine(uint32(spAddr0), (*RegisterLine)(unsafe.Pointer(&reg.F)))
+
 		spAddr0 = 0
 		spAddr1 = 0
 
 	}
+
+	return nil
 }
 
-func (vm *VM) initScratchpad(seed *[64]byte) {
-	clear(vm.pad[:])
-	vm.AES.FillAes1Rx4(seed, vm.pad[:])
+func (vm *VM) initScratchpad(seed *[64]byte) error {
+	clear(vm.pad)
+	return vm.AES.FillAes1Rx4(seed, vm.pad)
 }
 
-func (vm *VM) runLoops() {
+// check Verifies the VM and its Cache or Dataset can be used
+func (vm *VM) check() error {
+	if vm.closed {
+		return ErrClosed
+	}
+	if vm.flags.Has(RANDOMX_FLAG_FULL_MEM) {
+		if vm.Dataset.closed.Load() {
+			return ErrClosed
+		}
+	} else {
+		if vm.Cache.closed.Load() {
+			return ErrClosed
+		}
+		if vm.Cache.Generation() != vm.cacheGeneration {
+			return ErrCacheChanged
+		}
+	}
+	return nil
+}
+
+func (vm *VM) runLoops() error {
 	if lockThreadDueToRoundingMode {
 		// Lock thread due to rounding mode flags
 		runtime.LockOSThread()
@@ -310,48 +395,83 @@ func (vm *VM) runLoops() {
 	// restore rounding mode at the end
 	defer ResetRoundingMode(vm.registerFile)
 
-	for chain := 0; chain < RANDOMX_PROGRAM_COUNT-1; chain++ {
-		vm.run()
+	for chain := uint32(0); chain < vm.config.ProgramCount-1; chain++ {
+		if err := vm.run(); err != nil {
+			return err
+		}
 
 		// write R, F, E, A registers
 		vm.hashState = blake2b.Sum512(vm.registerFile.Memory()[:])
 	}
 
 	// final loop executes here
-	vm.run()
+	if err := vm.run(); err != nil {
+		return err
+	}
+
+	// Cache was re-initialized while in use
+	return vm.check()
 }
 
 // SetCache Reinitializes a virtual machine with a new Cache.
 // This function should be called anytime the Cache is reinitialized with a new key.
 // Does nothing if called with a Cache containing the same key value as already set.
-// VM must be initialized without RANDOMX_FLAG_FULL_MEM.
-func (vm *VM) SetCache(cache *Cache) {
+// VM must be initialized without RANDOMX_FLAG_FULL_MEM, otherwise ErrModeMismatch is returned.
+// Cache must have been created with the same Config as the VM, otherwise ErrConfigMismatch is returned.
+func (vm *VM) SetCache(cache *Cache) error {
+	if vm.closed || cache.closed.Load() {
+		return ErrClosed
+	}
 	if vm.flags.Has(RANDOMX_FLAG_FULL_MEM) {
-		panic("unsupported")
+		return ErrModeMismatch
+	}
+	if cache.config.Config != vm.config.Config {
+		return ErrConfigMismatch
 	}
 	vm.Cache = cache
-	//todo
+	vm.cacheGeneration = cache.Generation()
+	return nil
 }
 
 // SetDataset Reinitializes a virtual machine with a new Dataset.
-// VM must be initialized with RANDOMX_FLAG_FULL_MEM.
-func (vm *VM) SetDataset(dataset *Dataset) {
+// VM must be initialized with RANDOMX_FLAG_FULL_MEM, otherwise ErrModeMismatch is returned.
+// Dataset must have been created with the same Config as the VM, otherwise ErrConfigMismatch is returned.
+func (vm *VM) SetDataset(dataset *Dataset) error {
+	if vm.closed || dataset.closed.Load() {
+		return ErrClosed
+	}
 	if !vm.flags.Has(RANDOMX_FLAG_FULL_MEM) {
-		panic("unsupported")
+		return ErrModeMismatch
+	}
+	if dataset.config.Config != vm.config.Config {
+		return ErrConfigMismatch
 	}
 	vm.Dataset = dataset
+	return nil
 }
 
 // CalculateHash Calculates a RandomX hash value.
-func (vm *VM) CalculateHash(input []byte, output *[RANDOMX_HASH_SIZE]byte) {
+func (vm *VM) CalculateHash(input []byte, output *[RANDOMX_HASH_SIZE]byte) error {
+	vm.commitmentPending = false
+
+	if err := vm.check(); err != nil {
+		return err
+	}
+
 	vm.hashState = blake2b.Sum512(input)
 
-	vm.initScratchpad(&vm.hashState)
+	if err := vm.initScratchpad(&vm.hashState); err != nil {
+		return err
+	}
 
-	vm.runLoops()
+	if err := vm.runLoops(); err != nil {
+		return err
+	}
 
 	// now hash the scratch pad as it will act as register A
-	vm.AES.HashAes1Rx4(vm.pad[:], &vm.hashState)
+	if err := vm.AES.HashAes1Rx4(vm.pad, &vm.hashState); err != nil {
+		return err
+	}
 
 	regMem := vm.registerFile.Memory()
 	// write hash onto register A
@@ -359,39 +479,65 @@ func (vm *VM) CalculateHash(input []byte, output *[RANDOMX_HASH_SIZE]byte) {
 
 	// write R, F, E, A registers
 	*output = blake2b.Sum256(regMem[:])
+	return nil
 }
 
 // CalculateHashFirst will begin a hash calculation.
-func (vm *VM) CalculateHashFirst(input []byte) {
+func (vm *VM) CalculateHashFirst(input []byte) error {
+	vm.commitmentPending = false
+
+	if err := vm.check(); err != nil {
+		return err
+	}
+
 	vm.hashState = blake2b.Sum512(input)
 
-	vm.initScratchpad(&vm.hashState)
+	return vm.initScratchpad(&vm.hashState)
 }
 
 // CalculateHashNext will output the hash value of the previous input and begin the calculation of the next hash.
-func (vm *VM) CalculateHashNext(nextInput []byte, output *[RANDOMX_HASH_SIZE]byte) {
-	vm.runLoops()
+func (vm *VM) CalculateHashNext(nextInput []byte, output *[RANDOMX_HASH_SIZE]byte) error {
+	vm.commitmentPending = false
 
-	// now hash the scratch pad as it will act as register A
-	vm.AES.HashAes1Rx4(vm.pad[:], &vm.hashState)
+	if err := vm.check(); err != nil {
+		return err
+	}
+
+	if err := vm.runLoops(); err != nil {
+		return err
+	}
 
 	// Finish current hash and fill the scratchpad for the next hash at the same time
 	regMem := vm.registerFile.Memory()
 	vm.hashState = blake2b.Sum512(nextInput)
 	// write hash onto register A
-	vm.AES.HashAndFillAes1Rx4(vm.pad[:], (*[64]byte)(unsafe.Pointer(unsafe.SliceData(regMem[RegisterFileSize-RegistersCountFloat*2*8:]))), &vm.hashState)
+	err := vm.AES.HashAndFillAes1Rx4(vm.pad, (*[64]byte)(unsafe.Pointer(unsafe.SliceData(regMem[RegisterFileSize-RegistersCountFloat*2*8:]))), &vm.hashState)
 	runtime.KeepAlive(regMem)
+	if err != nil {
+		return err
+	}
 
 	// write R, F, E, A registers
 	*output = blake2b.Sum256(regMem[:])
+	return nil
 }
 
 // CalculateHashLast will output the hash value of the previous input.
-func (vm *VM) CalculateHashLast(output *[RANDOMX_HASH_SIZE]byte) {
-	vm.runLoops()
+func (vm *VM) CalculateHashLast(output *[RANDOMX_HASH_SIZE]byte) error {
+	vm.commitmentPending = false
+
+	if err := vm.check(); err != nil {
+		return err
+	}
+
+	if err := vm.runLoops(); err != nil {
+		return err
+	}
 
 	// now hash the scratch pad as it will act as register A
-	vm.AES.HashAes1Rx4(vm.pad[:], &vm.hashState)
+	if err := vm.AES.HashAes1Rx4(vm.pad, &vm.hashState); err != nil {
+		return err
+	}
 
 	regMem := vm.registerFile.Memory()
 	// write hash onto register A
@@ -399,12 +545,22 @@ func (vm *VM) CalculateHashLast(output *[RANDOMX_HASH_SIZE]byte) {
 
 	// write R, F, E, A registers
 	*output = blake2b.Sum256(regMem[:])
+	return nil
 }
 
 // Close Releases all memory occupied by the structure.
+// Returns ErrClosed if called more than once.
 func (vm *VM) Close() error {
-	memory.Free(cacheLineAlignedAllocator, vm.pad)
+	if vm.closed {
+		return ErrClosed
+	}
+	vm.closed = true
+
+	vm.itemWorker.close()
+
+	memory.FreeSlice(cacheLineAlignedAllocator, vm.pad)
 	memory.Free(cacheLineAlignedAllocator, vm.registerFile)
+	vm.pad, vm.registerFile = nil, nil
 
 	if vm.jitProgram != nil {
 		return vm.jitProgram.Close()
@@ -1,33 +1,71 @@
 package randomx
 
+import "unsafe"
+
 type ByteCodeInstruction struct {
 	Dst, Src byte
 	ImmB     uint8
-	Opcode   ByteCodeInstructionOp
 	MemMask  uint32
+	Opcode   ByteCodeInstructionOp
 	Imm      uint64
 	EMask    uint64
-	/*
-		union {
-			int_reg_t* idst;
-			rx_vec_f128* fdst;
-		};
-		union {
-			int_reg_t* isrc;
-			rx_vec_f128* fsrc;
-		};
-		union {
-			uint64_t imm;
-			int64_t simm;
-		};
-		InstructionType type;
-		union {
-			int16_t target;
-			uint16_t shift;
-		};
-		uint32_t memMask;
-	*/
 
+	// dst, src Byte offsets of the operand registers within RegisterFile, resolved from Dst and Src on compilation
+	dst, src uintptr
+}
+
+var (
+	registerFileOffsetR = unsafe.Offsetof(RegisterFile{}.R)
+	registerFileOffsetF = unsafe.Offsetof(RegisterFile{}.F)
+	registerFileOffsetE = unsafe.Offsetof(RegisterFile{}.E)
+	registerFileOffsetA = unsafe.Offsetof(RegisterFile{}.A)
+)
+
+// resolve Sets the operands of the instruction to the offsets of its registers, so they are not indexed on execution
+func (i *ByteCodeInstruction) resolve() {
+	const intSize, floatSize = 8, 16
+	intReg := func(r byte) uintptr {
+		return registerFileOffsetR + uintptr(r%RegistersCount)*intSize
+	}
+	floatReg := func(offset uintptr, r byte) uintptr {
+		return offset + uintptr(r%RegistersCountFloat)*floatSize
+	}
+
+	switch i.Opcode {
+	case VM_FSWAP_RF, VM_FSCAL_R:
+		i.dst, i.src = floatReg(registerFileOffsetF, i.Dst), 0
+	case VM_FSWAP_RE, VM_FSQRT_R:
+		i.dst, i.src = floatReg(registerFileOffsetE, i.Dst), 0
+	case VM_FADD_R, VM_FSUB_R:
+		i.dst, i.src = floatReg(registerFileOffsetF, i.Dst), floatReg(registerFileOffsetA, i.Src)
+	case VM_FMUL_R:
+		i.dst, i.src = floatReg(registerFileOffsetE, i.Dst), floatReg(registerFileOffsetA, i.Src)
+	case VM_FADD_M, VM_FSUB_M:
+		i.dst, i.src = floatReg(registerFileOffsetF, i.Dst), intReg(i.Src)
+	case VM_FDIV_M:
+		i.dst, i.src = floatReg(registerFileOffsetE, i.Dst), intReg(i.Src)
+	case VM_CBRANCH:
+		// Src holds part of the jump target
+		i.dst, i.src = intReg(i.Dst), 0
+	default:
+		i.dst, i.src = intReg(i.Dst), intReg(i.Src)
+	}
+}
+
+func (i *ByteCodeInstruction) idst(f *RegisterFile) *uint64 {
+	return (*uint64)(unsafe.Add(unsafe.Pointer(f), i.dst))
+}
+
+func (i *ByteCodeInstruction) isrc(f *RegisterFile) *uint64 {
+	return (*uint64)(unsafe.Add(unsafe.Pointer(f), i.src))
+}
+
+func (i *ByteCodeInstruction) fdst(f *RegisterFile) *[2]float64 {
+	return (*[2]float64)(unsafe.Add(unsafe.Pointer(f), i.dst))
+}
+
+func (i *ByteCodeInstruction) fsrc(f *RegisterFile) *[2]float64 {
+	return (*[2]float64)(unsafe.Add(unsafe.Pointer(f), i.src))
 }
 
 func (i ByteCodeInstruction) jumpTarget() int {
@@ -42,8 +80,12 @@ func (i ByteCodeInstruction) getScratchpadZeroAddress() uint32 {
 	return uint32(i.Imm) & i.MemMask
 }
 
+// ByteCode Program compiled with the default configuration, see CompileProgramToByteCode
 type ByteCode [RANDOMX_PROGRAM_SIZE]ByteCodeInstruction
 
+// byteCode Program compiled for a Config, sized by its ProgramSize
+type byteCode []ByteCodeInstruction
+
 type ByteCodeInstructionOp int
 
 const (
@@ -9,10 +9,10 @@ import (
 )
 
 //go:noescape
-func vm_run(rf *RegisterFile, pad *ScratchPad, eMask [2]uint64, jmp uintptr)
+func vm_run(rf *RegisterFile, pad *byte, eMask [2]uint64, jmp uintptr)
 
 //go:noescape
-func vm_run_full(rf *RegisterFile, pad *ScratchPad, dataset *RegisterLine, iterations, memoryRegisters uint64, eMask [2]uint64, jmp uintptr)
+func vm_run_full(rf *RegisterFile, pad *byte, dataset *RegisterLine, iterations, memoryRegisters uint64, eMask [2]uint64, jmp uintptr)
 
 /*
 #define RANDOMX_DATASET_BASE_SIZE 2147483648
@@ -36,8 +36,57 @@ xor r13, qword ptr [rdi+rcx+40]
 xor r14, qword ptr [rdi+rcx+48]
 xor r15, qword ptr [rdi+rcx+56]
 */
+// programReadDatasetMask offsets of RANDOMX_DATASET_BASE_MASK immediates within programReadDataset
+var programReadDatasetMask = [2]int{4, 23}
+
 var programReadDataset = []byte{0x89, 0xE9, 0x81, 0xE1, 0xC0, 0xFF, 0xFF, 0x7F, 0x4C, 0x33, 0x04, 0x0F, 0x48, 0xC1, 0xCD, 0x20, 0x48, 0x31, 0xC5, 0x89, 0xEA, 0x81, 0xE2, 0xC0, 0xFF, 0xFF, 0x7F, 0x0F, 0x18, 0x04, 0x17, 0x4C, 0x33, 0x4C, 0x0F, 0x08, 0x4C, 0x33, 0x54, 0x0F, 0x10, 0x4C, 0x33, 0x5C, 0x0F, 0x18, 0x4C, 0x33, 0x64, 0x0F, 0x20, 0x4C, 0x33, 0x6C, 0x0F, 0x28, 0x4C, 0x33, 0x74, 0x0F, 0x30, 0x4C, 0x33, 0x7C, 0x0F, 0x38}
 
+/*
+mov ecx, ebp                       ;# ecx = ma
+;#and ecx, RANDOMX_DATASET_BASE_MASK
+and ecx, 2147483584
+ror rbp, 32                        ;# swap "ma" and "mx"
+xor rbp, rax                       ;# modify "mx"
+push rbx
+push r8
+push r9
+push r10
+push r11
+push r12
+push r13
+push r14
+push r15
+mov ebx, ecx
+shr ebx, 6                         ;# ebx = Dataset item number
+add rbx, datasetOffset / 64
+mov rax, superscalar_hash
+call rax                           ;# r8-r15 = Dataset item
+pop rax
+xor r15, rax
+pop rax
+xor r14, rax
+pop rax
+xor r13, rax
+pop rax
+xor r12, rax
+pop rax
+xor r11, rax
+pop rax
+xor r10, rax
+pop rax
+xor r9, rax
+pop rax
+xor r8, rax
+pop rbx
+*/
+// programReadDatasetLight Light mode counterpart of programReadDataset, computing the item with the superscalar hash on rdi = cache memory.
+// Offsets of RANDOMX_DATASET_BASE_MASK, datasetOffset / 64 and superscalar_hash immediates are in programReadDatasetLightMask, programReadDatasetLightItem and programReadDatasetLightCall
+var programReadDatasetLight = []byte{0x89, 0xE9, 0x81, 0xE1, 0xC0, 0xFF, 0xFF, 0x7F, 0x48, 0xC1, 0xCD, 0x20, 0x48, 0x31, 0xC5, 0x53, 0x41, 0x50, 0x41, 0x51, 0x41, 0x52, 0x41, 0x53, 0x41, 0x54, 0x41, 0x55, 0x41, 0x56, 0x41, 0x57, 0x89, 0xCB, 0xC1, 0xEB, 0x06, 0x48, 0x81, 0xC3, 0x00, 0x00, 0x00, 0x00, 0x48, 0xB8, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xFF, 0xD0, 0x58, 0x49, 0x31, 0xC7, 0x58, 0x49, 0x31, 0xC6, 0x58, 0x49, 0x31, 0xC5, 0x58, 0x49, 0x31, 0xC4, 0x58, 0x49, 0x31, 0xC3, 0x58, 0x49, 0x31, 0xC2, 0x58, 0x49, 0x31, 0xC1, 0x58, 0x49, 0x31, 0xC0, 0x5B}
+
+const programReadDatasetLightMask = 4
+const programReadDatasetLightItem = 40
+const programReadDatasetLightCall = 46
+
 /*
 lea rcx, [rsi+rax]
 push rcx
@@ -104,39 +153,68 @@ ror rdx, 32
 ;#and edx, RANDOMX_SCRATCHPAD_MASK
 and edx, 2097088
 */
+// programCalculateSpAddrsMask offsets of RANDOMX_SCRATCHPAD_MASK immediates within programCalculateSpAddrs
+var programCalculateSpAddrsMask = [2]int{4, 14}
+
 var programCalculateSpAddrs = []byte{0x48, 0x89, 0xC2, 0x25, 0xC0, 0xFF, 0x1F, 0x00, 0x48, 0xC1, 0xCA, 0x20, 0x81, 0xE2, 0xC0, 0xFF, 0x1F, 0x00}
 
-func (f VMProgramFunc) ExecuteFull(rf *RegisterFile, pad *ScratchPad, dataset *RegisterLine, iterations uint64, ma, mx uint32, eMask [2]uint64) {
+func (f VMProgramFunc) executeFull(rf *RegisterFile, pad scratchPad, dataset *RegisterLine, iterations uint64, ma, mx uint32, eMask [2]uint64) {
+	if f == nil {
+		panic("program is nil")
+	}
+
+	jmpPtr := uintptr(unsafe.Pointer(unsafe.SliceData(f)))
+	vm_run_full(rf, unsafe.SliceData(pad), dataset, iterations, (uint64(ma)<<32)|uint64(mx), eMask, jmpPtr)
+}
+
+// executeLight Runs all iterations like executeFull, generating Dataset items from cache memory with the superscalar hash
+func (f VMProgramFunc) executeLight(rf *RegisterFile, pad scratchPad, cache []MemoryBlock, iterations uint64, ma, mx uint32, eMask [2]uint64) {
 	if f == nil {
 		panic("program is nil")
 	}
 
 	jmpPtr := uintptr(unsafe.Pointer(unsafe.SliceData(f)))
-	vm_run_full(rf, pad, dataset, iterations, (uint64(ma)<<32)|uint64(mx), eMask, jmpPtr)
+	vm_run_full(rf, unsafe.SliceData(pad), (*RegisterLine)(unsafe.Pointer(unsafe.SliceData(cache))), iterations, (uint64(ma)<<32)|uint64(mx), eMask, jmpPtr)
 }
 
-func (f VMProgramFunc) Execute(rf *RegisterFile, pad *ScratchPad, eMask [2]uint64) {
+func (f VMProgramFunc) execute(rf *RegisterFile, pad scratchPad, eMask [2]uint64) {
 	if f == nil {
 		panic("program is nil")
 	}
 
 	jmpPtr := uintptr(unsafe.Pointer(unsafe.SliceData(f)))
-	vm_run(rf, pad, eMask, jmpPtr)
+	vm_run(rf, unsafe.SliceData(pad), eMask, jmpPtr)
 }
 
-func (c *ByteCode) generateCode(program []byte, readReg *[4]uint64) []byte {
+// appendMasked appends code and replaces the 32-bit immediates at offsets with mask
+func appendMasked(program, code []byte, offsets [2]int, mask uint32) []byte {
+	pos := len(program)
+	program = append(program, code...)
+	for _, offset := range offsets {
+		binary.LittleEndian.PutUint32(program[pos+offset:], mask)
+	}
+	return program
+}
+
+// generateCode Generates the program body, or the whole program loop when readReg is set.
+// The loop reads Dataset items from memory, or generates them with datasetInit in light mode when it is set.
+func (c byteCode) generateCode(program []byte, readReg *[4]uint64, config *params, datasetInit SuperScalarProgramFunc, datasetOffset uint64) []byte {
 	program = program[:0]
 
 	isFullMode := readReg != nil
 
 	if isFullMode {
 
-		program = append(program, programCalculateSpAddrs...)
+		program = appendMasked(program, programCalculateSpAddrs, programCalculateSpAddrsMask, config.scratchpadL3Mask64)
 		// prologue
 		program = append(program, programLoopLoad...)
 	}
 
-	var instructionOffsets [RANDOMX_PROGRAM_SIZE]int32
+	var instructionOffsetsBuf [RANDOMX_PROGRAM_SIZE]int32
+	instructionOffsets := instructionOffsetsBuf[:]
+	if len(c) > len(instructionOffsets) {
+		instructionOffsets = make([]int32, len(c))
+	}
 
 	for ix := range c {
 		instructionOffsets[ix] = int32(len(program))
@@ -427,7 +505,15 @@ func (c *ByteCode) generateCode(program []byte, readReg *[4]uint64) []byte {
 
 		// read dataset
 
-		program = append(program, programReadDataset...)
+		if datasetInit != nil {
+			pos := len(program)
+			program = append(program, programReadDatasetLight...)
+			binary.LittleEndian.PutUint32(program[pos+programReadDatasetLightMask:], uint32(config.cacheLineAlignMask))
+			binary.LittleEndian.PutUint32(program[pos+programReadDatasetLightItem:], uint32(datasetOffset/CacheLineSize))
+			binary.LittleEndian.PutUint64(program[pos+programReadDatasetLightCall:], uint64(datasetInit.superscalarHash()))
+		} else {
+			program = appendMasked(program, programReadDataset, programReadDatasetMask, uint32(config.cacheLineAlignMask))
+		}
 
 		// epilogue
 		program = append(program, REX_MOV_RR64...)
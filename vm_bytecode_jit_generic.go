@@ -2,13 +2,16 @@
 
 package randomx
 
-func (c *ByteCode) generateCode(program []byte, readReg *[4]uint64) []byte {
+func (c byteCode) generateCode(program []byte, readReg *[4]uint64, config *params, datasetInit SuperScalarProgramFunc, datasetOffset uint64) []byte {
 	return nil
 }
 
-func (f VMProgramFunc) Execute(rf *RegisterFile, pad *ScratchPad, eMask [2]uint64) {
+func (f VMProgramFunc) execute(rf *RegisterFile, pad scratchPad, eMask [2]uint64) {
 
 }
-func (f VMProgramFunc) ExecuteFull(rf *RegisterFile, pad *ScratchPad, dataset *RegisterLine, iterations uint64, ma, mx uint32, eMask [2]uint64) {
+func (f VMProgramFunc) executeFull(rf *RegisterFile, pad scratchPad, dataset *RegisterLine, iterations uint64, ma, mx uint32, eMask [2]uint64) {
+
+}
+func (f VMProgramFunc) executeLight(rf *RegisterFile, pad scratchPad, cache []MemoryBlock, iterations uint64, ma, mx uint32, eMask [2]uint64) {
 
 }
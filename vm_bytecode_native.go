@@ -13,110 +13,114 @@ import (
 // It is the caller's responsibility to set and restore the mode to softfloat64.RoundingModeToNearest between full executions
 // Additionally, runtime.LockOSThread and defer runtime.UnlockOSThread is recommended to prevent other goroutines sharing these changes
 func (c *ByteCode) Execute(f *RegisterFile, pad *ScratchPad, eMask [2]uint64) {
+	byteCode(c[:]).execute(f, pad[:], eMask)
+}
+
+// execute Runs a program of any size on a scratchpad of any size, see ByteCode.Execute
+func (c byteCode) execute(f *RegisterFile, pad scratchPad, eMask [2]uint64) {
 	for pc := 0; pc < len(c); pc++ {
 		i := &c[pc]
 		switch i.Opcode {
 		case VM_NOP: // we do nothing
 		case VM_IADD_RS:
-			f.R[i.Dst] += (f.R[i.Src] << i.ImmB) + i.Imm
+			*i.idst(f) += (*i.isrc(f) << i.ImmB) + i.Imm
 		case VM_IADD_M:
-			f.R[i.Dst] += pad.Load64(i.getScratchpadAddress(f.R[i.Src]))
+			*i.idst(f) += pad.Load64(i.getScratchpadAddress(*i.isrc(f)))
 		case VM_IADD_MZ:
-			f.R[i.Dst] += pad.Load64(uint32(i.Imm))
+			*i.idst(f) += pad.Load64(uint32(i.Imm))
 		case VM_ISUB_R:
-			f.R[i.Dst] -= f.R[i.Src]
+			*i.idst(f) -= *i.isrc(f)
 		case VM_ISUB_I:
-			f.R[i.Dst] -= i.Imm
+			*i.idst(f) -= i.Imm
 		case VM_ISUB_M:
-			f.R[i.Dst] -= pad.Load64(i.getScratchpadAddress(f.R[i.Src]))
+			*i.idst(f) -= pad.Load64(i.getScratchpadAddress(*i.isrc(f)))
 		case VM_ISUB_MZ:
-			f.R[i.Dst] -= pad.Load64(uint32(i.Imm))
+			*i.idst(f) -= pad.Load64(uint32(i.Imm))
 		case VM_IMUL_R:
-			f.R[i.Dst] *= f.R[i.Src]
+			*i.idst(f) *= *i.isrc(f)
 		case VM_IMUL_I:
 			// also handles imul_rcp
-			f.R[i.Dst] *= i.Imm
+			*i.idst(f) *= i.Imm
 		case VM_IMUL_M:
-			f.R[i.Dst] *= pad.Load64(i.getScratchpadAddress(f.R[i.Src]))
+			*i.idst(f) *= pad.Load64(i.getScratchpadAddress(*i.isrc(f)))
 		case VM_IMUL_MZ:
-			f.R[i.Dst] *= pad.Load64(uint32(i.Imm))
+			*i.idst(f) *= pad.Load64(uint32(i.Imm))
 		case VM_IMULH_R:
-			f.R[i.Dst], _ = bits.Mul64(f.R[i.Dst], f.R[i.Src])
+			*i.idst(f), _ = bits.Mul64(*i.idst(f), *i.isrc(f))
 		case VM_IMULH_M:
-			f.R[i.Dst], _ = bits.Mul64(f.R[i.Dst], pad.Load64(i.getScratchpadAddress(f.R[i.Src])))
+			*i.idst(f), _ = bits.Mul64(*i.idst(f), pad.Load64(i.getScratchpadAddress(*i.isrc(f))))
 		case VM_IMULH_MZ:
-			f.R[i.Dst], _ = bits.Mul64(f.R[i.Dst], pad.Load64(uint32(i.Imm)))
+			*i.idst(f), _ = bits.Mul64(*i.idst(f), pad.Load64(uint32(i.Imm)))
 		case VM_ISMULH_R:
-			f.R[i.Dst] = smulh(int64(f.R[i.Dst]), int64(f.R[i.Src]))
+			*i.idst(f) = smulh(int64(*i.idst(f)), int64(*i.isrc(f)))
 		case VM_ISMULH_M:
-			f.R[i.Dst] = smulh(int64(f.R[i.Dst]), int64(pad.Load64(i.getScratchpadAddress(f.R[i.Src]))))
+			*i.idst(f) = smulh(int64(*i.idst(f)), int64(pad.Load64(i.getScratchpadAddress(*i.isrc(f)))))
 		case VM_ISMULH_MZ:
-			f.R[i.Dst] = smulh(int64(f.R[i.Dst]), int64(pad.Load64(uint32(i.Imm))))
+			*i.idst(f) = smulh(int64(*i.idst(f)), int64(pad.Load64(uint32(i.Imm))))
 		case VM_INEG_R:
-			f.R[i.Dst] = -f.R[i.Dst]
+			*i.idst(f) = -*i.idst(f)
 		case VM_IXOR_R:
-			f.R[i.Dst] ^= f.R[i.Src]
+			*i.idst(f) ^= *i.isrc(f)
 		case VM_IXOR_I:
-			f.R[i.Dst] ^= i.Imm
+			*i.idst(f) ^= i.Imm
 		case VM_IXOR_M:
-			f.R[i.Dst] ^= pad.Load64(i.getScratchpadAddress(f.R[i.Src]))
+			*i.idst(f) ^= pad.Load64(i.getScratchpadAddress(*i.isrc(f)))
 		case VM_IXOR_MZ:
-			f.R[i.Dst] ^= pad.Load64(uint32(i.Imm))
+			*i.idst(f) ^= pad.Load64(uint32(i.Imm))
 		case VM_IROR_R:
-			f.R[i.Dst] = bits.RotateLeft64(f.R[i.Dst], 0-int(f.R[i.Src]&63))
+			*i.idst(f) = bits.RotateLeft64(*i.idst(f), 0-int(*i.isrc(f)&63))
 		case VM_IROR_I:
 			//todo: can merge into VM_IROL_I
-			f.R[i.Dst] = bits.RotateLeft64(f.R[i.Dst], 0-int(i.Imm&63))
+			*i.idst(f) = bits.RotateLeft64(*i.idst(f), 0-int(i.Imm&63))
 		case VM_IROL_R:
-			f.R[i.Dst] = bits.RotateLeft64(f.R[i.Dst], int(f.R[i.Src]&63))
+			*i.idst(f) = bits.RotateLeft64(*i.idst(f), int(*i.isrc(f)&63))
 		case VM_IROL_I:
-			f.R[i.Dst] = bits.RotateLeft64(f.R[i.Dst], int(i.Imm&63))
+			*i.idst(f) = bits.RotateLeft64(*i.idst(f), int(i.Imm&63))
 		case VM_ISWAP_R:
-			f.R[i.Dst], f.R[i.Src] = f.R[i.Src], f.R[i.Dst]
+			*i.idst(f), *i.isrc(f) = *i.isrc(f), *i.idst(f)
 
-		case VM_FSWAP_RF:
-			f.F[i.Dst][HIGH], f.F[i.Dst][LOW] = f.F[i.Dst][LOW], f.F[i.Dst][HIGH]
-		case VM_FSWAP_RE:
-			f.E[i.Dst][HIGH], f.E[i.Dst][LOW] = f.E[i.Dst][LOW], f.E[i.Dst][HIGH]
+		case VM_FSWAP_RF, VM_FSWAP_RE:
+			// F or E register, as resolved
+			i.fdst(f)[HIGH], i.fdst(f)[LOW] = i.fdst(f)[LOW], i.fdst(f)[HIGH]
 		case VM_FADD_R:
-			f.F[i.Dst][LOW] += f.A[i.Src][LOW]
-			f.F[i.Dst][HIGH] += f.A[i.Src][HIGH]
+			i.fdst(f)[LOW] += i.fsrc(f)[LOW]
+			i.fdst(f)[HIGH] += i.fsrc(f)[HIGH]
 		case VM_FADD_M:
-			lo, hi := pad.Load32F(i.getScratchpadAddress(f.R[i.Src]))
-			f.F[i.Dst][LOW] += lo
-			f.F[i.Dst][HIGH] += hi
+			lo, hi := pad.Load32F(i.getScratchpadAddress(*i.isrc(f)))
+			i.fdst(f)[LOW] += lo
+			i.fdst(f)[HIGH] += hi
 		case VM_FSUB_R:
-			f.F[i.Dst][LOW] -= f.A[i.Src][LOW]
-			f.F[i.Dst][HIGH] -= f.A[i.Src][HIGH]
+			i.fdst(f)[LOW] -= i.fsrc(f)[LOW]
+			i.fdst(f)[HIGH] -= i.fsrc(f)[HIGH]
 		case VM_FSUB_M:
-			lo, hi := pad.Load32F(i.getScratchpadAddress(f.R[i.Src]))
-			f.F[i.Dst][LOW] -= lo
-			f.F[i.Dst][HIGH] -= hi
+			lo, hi := pad.Load32F(i.getScratchpadAddress(*i.isrc(f)))
+			i.fdst(f)[LOW] -= lo
+			i.fdst(f)[HIGH] -= hi
 		case VM_FSCAL_R:
 			// no dependent on rounding modes
-			f.F[i.Dst][LOW] = ScaleNegate(f.F[i.Dst][LOW])
-			f.F[i.Dst][HIGH] = ScaleNegate(f.F[i.Dst][HIGH])
+			i.fdst(f)[LOW] = ScaleNegate(i.fdst(f)[LOW])
+			i.fdst(f)[HIGH] = ScaleNegate(i.fdst(f)[HIGH])
 		case VM_FMUL_R:
-			f.E[i.Dst][LOW] *= f.A[i.Src][LOW]
-			f.E[i.Dst][HIGH] *= f.A[i.Src][HIGH]
+			i.fdst(f)[LOW] *= i.fsrc(f)[LOW]
+			i.fdst(f)[HIGH] *= i.fsrc(f)[HIGH]
 		case VM_FDIV_M:
-			lo, hi := pad.Load32F(i.getScratchpadAddress(f.R[i.Src]))
-			f.E[i.Dst][LOW] /= MaskRegisterExponentMantissa(lo, eMask[LOW])
-			f.E[i.Dst][HIGH] /= MaskRegisterExponentMantissa(hi, eMask[HIGH])
+			lo, hi := pad.Load32F(i.getScratchpadAddress(*i.isrc(f)))
+			i.fdst(f)[LOW] /= MaskRegisterExponentMantissa(lo, eMask[LOW])
+			i.fdst(f)[HIGH] /= MaskRegisterExponentMantissa(hi, eMask[HIGH])
 		case VM_FSQRT_R:
-			f.E[i.Dst][LOW] = math.Sqrt(f.E[i.Dst][LOW])
-			f.E[i.Dst][HIGH] = math.Sqrt(f.E[i.Dst][HIGH])
+			i.fdst(f)[LOW] = math.Sqrt(i.fdst(f)[LOW])
+			i.fdst(f)[HIGH] = math.Sqrt(i.fdst(f)[HIGH])
 		case VM_CFROUND:
-			tmp := (bits.RotateLeft64(f.R[i.Src], 0-int(i.Imm))) % 4 // rotate right
+			tmp := (bits.RotateLeft64(*i.isrc(f), 0-int(i.Imm))) % 4 // rotate right
 			SetRoundingMode(f, uint8(tmp))
 
 		case VM_CBRANCH:
-			f.R[i.Dst] += i.Imm
-			if (f.R[i.Dst] & uint64(i.MemMask)) == 0 {
+			*i.idst(f) += i.Imm
+			if (*i.idst(f) & uint64(i.MemMask)) == 0 {
 				pc = i.jumpTarget()
 			}
 		case VM_ISTORE:
-			pad.Store64(i.getScratchpadAddress(f.R[i.Dst]), f.R[i.Src])
+			pad.Store64(i.getScratchpadAddress(*i.idst(f)), *i.isrc(f))
 		}
 	}
 }
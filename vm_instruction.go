@@ -60,9 +60,14 @@ func (ins VM_Instruction) Opcode() byte {
 	return ins[0]
 }
 
-// CompileProgramToByteCode this will interpret single vm instruction into executable opcodes
-// reference https://github.com/tevador/RandomX/blob/master/doc/specs.md#52-integer-instructions
+// CompileProgramToByteCode this will interpret single vm instruction into executable opcodes, with the default configuration
 func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
+	compileProgramToByteCode(defaultParams, prog, bc[:])
+}
+
+// compileProgramToByteCode this will interpret single vm instruction into executable opcodes
+// reference https://github.com/tevador/RandomX/blob/master/doc/specs.md#52-integer-instructions
+func compileProgramToByteCode(config *params, prog []byte, bc byteCode) {
 
 	var registerUsage [RegistersCount]int
 	for i := range registerUsage {
@@ -73,13 +78,13 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 		instr := VM_Instruction(prog[i*8:])
 		ibc := &bc[i]
 
-		opcode := instr.Opcode()
+		opcode := config.opcodes[instr.Opcode()]
 		dst := instr.Dst() % RegistersCount // bit shift optimization
 		src := instr.Src() % RegistersCount
 		ibc.Dst = dst
 		ibc.Src = src
 		switch opcode {
-		case 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15: // 16 frequency
+		case instrIADD_RS:
 			ibc.Opcode = VM_IADD_RS
 			if dst != RegisterNeedsDisplacement {
 				//shift
@@ -92,22 +97,22 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 			}
 			registerUsage[dst] = i
 
-		case 16, 17, 18, 19, 20, 21, 22: // 7
+		case instrIADD_M:
 			ibc.Opcode = VM_IADD_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_IADD_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38: // 16
+		case instrISUB_R:
 			ibc.Opcode = VM_ISUB_R
 
 			if src == dst {
@@ -115,22 +120,22 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 				ibc.Opcode = VM_ISUB_I
 			}
 			registerUsage[dst] = i
-		case 39, 40, 41, 42, 43, 44, 45: // 7
+		case instrISUB_M:
 			ibc.Opcode = VM_ISUB_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_ISUB_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61: // 16
+		case instrIMUL_R:
 			ibc.Opcode = VM_IMUL_R
 
 			if src == dst {
@@ -138,58 +143,58 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 				ibc.Opcode = VM_IMUL_I
 			}
 			registerUsage[dst] = i
-		case 62, 63, 64, 65: //4
+		case instrIMUL_M:
 			ibc.Opcode = VM_IMUL_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_IMUL_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 66, 67, 68, 69: //4
+		case instrIMULH_R:
 			ibc.Opcode = VM_IMULH_R
 			registerUsage[dst] = i
-		case 70: //1
+		case instrIMULH_M:
 			ibc.Opcode = VM_IMULH_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_IMULH_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 71, 72, 73, 74: //4
+		case instrISMULH_R:
 			ibc.Opcode = VM_ISMULH_R
 			registerUsage[dst] = i
-		case 75: //1
+		case instrISMULH_M:
 			ibc.Opcode = VM_ISMULH_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_ISMULH_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 76, 77, 78, 79, 80, 81, 82, 83: // 8
+		case instrIMUL_RCP:
 			divisor := instr.IMM()
 			if !isZeroOrPowerOf2(divisor) {
 				ibc.Opcode = VM_IMUL_I
@@ -199,10 +204,10 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 				ibc.Opcode = VM_NOP
 			}
 
-		case 84, 85: //2
+		case instrINEG_R:
 			ibc.Opcode = VM_INEG_R
 			registerUsage[dst] = i
-		case 86, 87, 88, 89, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100: //15
+		case instrIXOR_R:
 			ibc.Opcode = VM_IXOR_R
 
 			if src == dst {
@@ -210,29 +215,29 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 				ibc.Opcode = VM_IXOR_I
 			}
 			registerUsage[dst] = i
-		case 101, 102, 103, 104, 105: //5
+		case instrIXOR_M:
 			ibc.Opcode = VM_IXOR_M
 			ibc.Imm = instr.IMM64()
 			if src != dst {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 			} else {
 				ibc.Opcode = VM_IXOR_MZ
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 				ibc.Imm = uint64(ibc.getScratchpadZeroAddress())
 			}
 			registerUsage[dst] = i
-		case 106, 107, 108, 109, 110, 111, 112, 113: //8
+		case instrIROR_R:
 			ibc.Opcode = VM_IROR_R
 			if src == dst {
 				ibc.Imm = instr.IMM64()
 				ibc.Opcode = VM_IROR_I
 			}
 			registerUsage[dst] = i
-		case 114, 115: // 2 IROL_R
+		case instrIROL_R:
 			ibc.Opcode = VM_IROL_R
 
 			if src == dst {
@@ -241,7 +246,7 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 			}
 			registerUsage[dst] = i
 
-		case 116, 117, 118, 119: //4
+		case instrISWAP_R:
 			if src != dst {
 				ibc.Opcode = VM_ISWAP_R
 				registerUsage[dst] = i
@@ -252,7 +257,7 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 			}
 
 		// below are floating point instructions
-		case 120, 121, 122, 123: // 4
+		case instrFSWAP_R:
 			//ibc.Opcode = VM_FSWAP_R
 			if dst < RegistersCountFloat {
 				ibc.Opcode = VM_FSWAP_RF
@@ -260,56 +265,56 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 				ibc.Opcode = VM_FSWAP_RE
 				ibc.Dst = dst - RegistersCountFloat
 			}
-		case 124, 125, 126, 127, 128, 129, 130, 131, 132, 133, 134, 135, 136, 137, 138, 139: //16
+		case instrFADD_R:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Src = instr.Src() % RegistersCountFloat
 			ibc.Opcode = VM_FADD_R
 
-		case 140, 141, 142, 143, 144: //5
+		case instrFADD_M:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Opcode = VM_FADD_M
 			if (instr.Mod() % 4) != 0 {
-				ibc.MemMask = ScratchpadL1Mask
+				ibc.MemMask = config.scratchpadL1Mask
 			} else {
-				ibc.MemMask = ScratchpadL2Mask
+				ibc.MemMask = config.scratchpadL2Mask
 			}
 			ibc.Imm = instr.IMM64()
 
-		case 145, 146, 147, 148, 149, 150, 151, 152, 153, 154, 155, 156, 157, 158, 159, 160: //16
+		case instrFSUB_R:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Src = instr.Src() % RegistersCountFloat
 			ibc.Opcode = VM_FSUB_R
-		case 161, 162, 163, 164, 165: //5
+		case instrFSUB_M:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Opcode = VM_FSUB_M
 			if (instr.Mod() % 4) != 0 {
-				ibc.MemMask = ScratchpadL1Mask
+				ibc.MemMask = config.scratchpadL1Mask
 			} else {
-				ibc.MemMask = ScratchpadL2Mask
+				ibc.MemMask = config.scratchpadL2Mask
 			}
 			ibc.Imm = instr.IMM64()
 
-		case 166, 167, 168, 169, 170, 171: //6
+		case instrFSCAL_R:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Opcode = VM_FSCAL_R
-		case 172, 173, 174, 175, 176, 177, 178, 179, 180, 181, 182, 183, 184, 185, 186, 187, 188, 189, 190, 191, 192, 193, 194, 195, 196, 197, 198, 199, 200, 201, 202, 203: //32
+		case instrFMUL_R:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Src = instr.Src() % RegistersCountFloat
 			ibc.Opcode = VM_FMUL_R
-		case 204, 205, 206, 207: //4
+		case instrFDIV_M:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Opcode = VM_FDIV_M
 			if (instr.Mod() % 4) != 0 {
-				ibc.MemMask = ScratchpadL1Mask
+				ibc.MemMask = config.scratchpadL1Mask
 			} else {
-				ibc.MemMask = ScratchpadL2Mask
+				ibc.MemMask = config.scratchpadL2Mask
 			}
 			ibc.Imm = instr.IMM64()
-		case 208, 209, 210, 211, 212, 213: //6
+		case instrFSQRT_R:
 			ibc.Dst = instr.Dst() % RegistersCountFloat // bit shift optimization
 			ibc.Opcode = VM_FSQRT_R
 
-		case 214, 215, 216, 217, 218, 219, 220, 221, 222, 223, 224, 225, 226, 227, 228, 229, 230, 231, 232, 233, 234, 235, 236, 237, 238: //25  // CBRANCH and CFROUND are interchanged
+		case instrCBRANCH: // CBRANCH and CFROUND are interchanged
 			ibc.Opcode = VM_CBRANCH
 			//TODO:??? it's +1 on other
 			ibc.Dst = instr.Dst() % RegistersCount
@@ -319,53 +324,99 @@ func CompileProgramToByteCode(prog []byte, bc *ByteCode) {
 			ibc.Src = uint8(target)
 			ibc.ImmB = uint8(target >> 8)
 
-			shift := uint64(instr.Mod()>>4) + CONDITIONOFFSET
+			shift := uint64(instr.Mod()>>4) + uint64(config.JumpOffset)
 			//conditionmask := CONDITIONMASK << shift
 			ibc.Imm = instr.IMM64() | (uint64(1) << shift)
-			if CONDITIONOFFSET > 0 || shift > 0 {
+			if config.JumpOffset > 0 || shift > 0 {
 				ibc.Imm &= ^(uint64(1) << (shift - 1))
 			}
-			ibc.MemMask = CONDITIONMASK << shift
+			ibc.MemMask = config.conditionMask << shift
 
 			for j := 0; j < RegistersCount; j++ {
 				registerUsage[j] = i
 			}
 
-		case 239: //1
+		case instrCFROUND:
 			ibc.Opcode = VM_CFROUND
 			ibc.Imm = uint64(instr.IMM() & 63)
 
-		case 240, 241, 242, 243, 244, 245, 246, 247, 248, 249, 250, 251, 252, 253, 254, 255: //16
+		case instrISTORE:
 			ibc.Opcode = VM_ISTORE
 			ibc.Imm = instr.IMM64()
 			if (instr.Mod() >> 4) < STOREL3CONDITION {
 				if (instr.Mod() % 4) != 0 {
-					ibc.MemMask = ScratchpadL1Mask
+					ibc.MemMask = config.scratchpadL1Mask
 				} else {
-					ibc.MemMask = ScratchpadL2Mask
+					ibc.MemMask = config.scratchpadL2Mask
 				}
 
 			} else {
-				ibc.MemMask = ScratchpadL3Mask
+				ibc.MemMask = config.scratchpadL3Mask
 			}
 
+		case instrNOP:
+			ibc.Opcode = VM_NOP
+
 		default:
 			panic("unreachable")
 
 		}
+
+		ibc.resolve()
 	}
 }
 
+// ScratchPad Scratchpad sized for the default configuration
 type ScratchPad [ScratchpadSize]byte
 
 func (pad *ScratchPad) Store64(addr uint32, val uint64) {
+	scratchPad(pad[:]).Store64(addr, val)
+}
+
+func (pad *ScratchPad) Load64(addr uint32) uint64 {
+	return scratchPad(pad[:]).Load64(addr)
+}
+func (pad *ScratchPad) Load32(addr uint32) uint32 {
+	return scratchPad(pad[:]).Load32(addr)
+}
+
+func (pad *ScratchPad) Load32F(addr uint32) (lo, hi float64) {
+	return scratchPad(pad[:]).Load32F(addr)
+}
+
+func (pad *ScratchPad) Load32FA(addr uint32) [2]float64 {
+	return scratchPad(pad[:]).Load32FA(addr)
+}
+
+// scratchPad Scratchpad of a Config, sized by its ScratchpadL3
+type scratchPad []byte
+
+func (pad scratchPad) Store64(addr uint32, val uint64) {
 	*(*uint64)(unsafe.Pointer(&pad[addr])) = val
 	//binary.LittleEndian.PutUint64(pad[addr:], val)
 }
 
-func (pad *ScratchPad) Load64(addr uint32) uint64 {
+func (pad scratchPad) Load64(addr uint32) uint64 {
 	return *(*uint64)(unsafe.Pointer(&pad[addr]))
 }
-func (pad *ScratchPad) Load32(addr uint32) uint32 {
+func (pad scratchPad) Load32(addr uint32) uint32 {
 	return *(*uint32)(unsafe.Pointer(&pad[addr]))
 }
+
+// line Returns the 64 bytes at addr, with a single bounds check
+func (pad scratchPad) line(addr uint32) *RegisterLine {
+	return (*RegisterLine)(unsafe.Pointer(unsafe.SliceData(pad[addr : addr+uint32(CacheLineSize)])))
+}
+
+// XorLine XORs the 64 bytes at addr into r
+func (pad scratchPad) XorLine(addr uint32, r *RegisterLine) {
+	line := pad.line(addr)
+	for i := range r {
+		r[i] ^= line[i]
+	}
+}
+
+// StoreLine Stores r into the 64 bytes at addr
+func (pad scratchPad) StoreLine(addr uint32, r *RegisterLine) {
+	*pad.line(addr) = *r
+}
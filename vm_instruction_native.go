@@ -2,14 +2,22 @@
 
 package randomx
 
-import "unsafe"
+import (
+	"git.gammaspectra.live/P2Pool/go-randomx/v3/internal/asm"
+	"unsafe"
+)
 
-func (pad *ScratchPad) Load32F(addr uint32) (lo, hi float64) {
+func (pad scratchPad) Load32F(addr uint32) (lo, hi float64) {
 	a := *(*[2]int32)(unsafe.Pointer(&pad[addr]))
 	return float64(a[LOW]), float64(a[HIGH])
 }
 
-func (pad *ScratchPad) Load32FA(addr uint32) [2]float64 {
+func (pad scratchPad) Load32FA(addr uint32) [2]float64 {
 	a := *(*[2]int32)(unsafe.Pointer(&pad[addr]))
 	return [2]float64{float64(a[LOW]), float64(a[HIGH])}
 }
+
+// Load32FLine Converts the 16 int32 values at addr into f
+func (pad scratchPad) Load32FLine(addr uint32, f *[RegistersCountFloat * 2][2]float64) {
+	asm.ConvertInt32Line(f, (*[16]int32)(unsafe.Pointer(pad.line(addr))))
+}
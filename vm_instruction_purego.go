@@ -7,12 +7,20 @@ import (
 	"unsafe"
 )
 
-func (pad *ScratchPad) Load32F(addr uint32) (lo, hi float64) {
+func (pad scratchPad) Load32F(addr uint32) (lo, hi float64) {
 	a := *(*[2]int32)(unsafe.Pointer(&pad[addr]))
 	return softfloat64.Int32ToFloat64(a[LOW]), softfloat64.Int32ToFloat64(a[HIGH])
 }
 
-func (pad *ScratchPad) Load32FA(addr uint32) [2]float64 {
+func (pad scratchPad) Load32FA(addr uint32) [2]float64 {
 	a := *(*[2]int32)(unsafe.Pointer(&pad[addr]))
 	return [2]float64{softfloat64.Int32ToFloat64(a[LOW]), softfloat64.Int32ToFloat64(a[HIGH])}
 }
+
+// Load32FLine Converts the 16 int32 values at addr into f
+func (pad scratchPad) Load32FLine(addr uint32, f *[RegistersCountFloat * 2][2]float64) {
+	a := (*[16]int32)(unsafe.Pointer(pad.line(addr)))
+	for i := range f {
+		f[i] = [2]float64{softfloat64.Int32ToFloat64(a[i*2+LOW]), softfloat64.Int32ToFloat64(a[i*2+HIGH])}
+	}
+}